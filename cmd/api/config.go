@@ -0,0 +1,766 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/irensaltali/object-storage-gateway/internal/discovery"
+	"github.com/irensaltali/object-storage-gateway/internal/ratelimit"
+	"github.com/irensaltali/object-storage-gateway/internal/storage"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultCacheMaxObjectSize = 256 << 10
+
+// config is the gateway configuration. It is layered: defaults, then an
+// optional YAML or JSON file, then environment variables, then command-line
+// flags, each overriding the one before.
+type config struct {
+	Server    serverConfig    `json:"server" yaml:"server"`
+	Discovery discoveryConfig `json:"discovery" yaml:"discovery"`
+	Storage   storageConfig   `json:"storage" yaml:"storage"`
+}
+
+type serverConfig struct {
+	Addr                string        `json:"addr" yaml:"addr"`
+	ReadHeaderTimeout   time.Duration `json:"readHeaderTimeout" yaml:"readHeaderTimeout"`
+	ShutdownGracePeriod time.Duration `json:"shutdownGracePeriod" yaml:"shutdownGracePeriod"`
+	// RateLimits enables per-client rate limiting when set.
+	RateLimits *ratelimit.Config `json:"rateLimits,omitempty" yaml:"rateLimits,omitempty"`
+	// APIKeysFile maps the API keys clients may present to client names.
+	// Requests without a listed key are limited by address.
+	APIKeysFile string `json:"apiKeysFile" yaml:"apiKeysFile"`
+}
+
+const (
+	providerDocker = "docker"
+	providerStatic = "static"
+	providerDNS    = "dns"
+	providerK8s    = "kubernetes"
+	providerFile   = "file"
+
+	// fileResyncInterval rereads a watched instance file even when it looks
+	// unchanged.
+	fileResyncInterval = 5 * time.Minute
+)
+
+type discoveryConfig struct {
+	// Provider selects where instances come from: "docker", "static", "file",
+	// "dns" or "kubernetes".
+	Provider string `json:"provider" yaml:"provider"`
+	// Timeout limits each discovery attempt.
+	Timeout    time.Duration             `json:"timeout" yaml:"timeout"`
+	Startup    startupConfig             `json:"startup" yaml:"startup"`
+	Docker     dockerDiscoveryConfig     `json:"docker" yaml:"docker"`
+	Static     staticDiscoveryConfig     `json:"static" yaml:"static"`
+	File       fileDiscoveryConfig       `json:"file" yaml:"file"`
+	DNS        dnsDiscoveryConfig        `json:"dns" yaml:"dns"`
+	Kubernetes kubernetesDiscoveryConfig `json:"kubernetes" yaml:"kubernetes"`
+}
+
+// startupConfig controls how long the gateway waits for its storage nodes
+// when it starts.
+type startupConfig struct {
+	// MinInstances is how many instances must be found before the gateway
+	// serves objects; erasure coding raises it to the shard count.
+	MinInstances int `json:"minInstances" yaml:"minInstances"`
+	// Timeout gives up and exits after this long; zero waits forever.
+	Timeout time.Duration `json:"timeout" yaml:"timeout"`
+	// InitialBackoff is the delay after the first failed attempt, doubled
+	// after each further one up to MaxBackoff.
+	InitialBackoff time.Duration `json:"initialBackoff" yaml:"initialBackoff"`
+	MaxBackoff     time.Duration `json:"maxBackoff" yaml:"maxBackoff"`
+	// ServeWhileWaiting starts the HTTP server right away, reporting not
+	// ready until enough instances are found.
+	ServeWhileWaiting bool `json:"serveWhileWaiting" yaml:"serveWhileWaiting"`
+}
+
+type dockerDiscoveryConfig struct {
+	// ContainerNamePattern and LabelSelectors select the Minio containers.
+	// When both are empty the compose container names are matched.
+	ContainerNamePattern string `json:"containerNamePattern" yaml:"containerNamePattern"`
+	// LabelSelectors are "key" or "key=value" labels a container must carry.
+	LabelSelectors []string `json:"labelSelectors" yaml:"labelSelectors"`
+	APIPort        string   `json:"apiPort" yaml:"apiPort"`
+	// Host is the daemon address, unix:///path or tcp://host:port, and
+	// takes precedence over Socket. When both are empty the Docker socket is
+	// used, or Podman's if only that exists.
+	Host   string `json:"host" yaml:"host"`
+	Socket string `json:"socket" yaml:"socket"`
+	// TLSVerify and CertPath configure TLS for tcp:// hosts as
+	// DOCKER_TLS_VERIFY and DOCKER_CERT_PATH do for the docker CLI. With
+	// TLSVerify and no CertPath, $DOCKER_CONFIG or ~/.docker is used.
+	TLSVerify bool   `json:"tlsVerify" yaml:"tlsVerify"`
+	CertPath  string `json:"certPath" yaml:"certPath"`
+	// SecretsDir is a host directory holding the containers' /run/secrets,
+	// read instead of copying *_FILE credentials out of the containers.
+	SecretsDir string `json:"secretsDir" yaml:"secretsDir"`
+	// CredentialsFile lists credentials by container name, for containers
+	// whose environment does not hold them.
+	CredentialsFile string `json:"credentialsFile" yaml:"credentialsFile"`
+	// RefreshInterval lists the containers again so ones that stop or turn
+	// unhealthy are dropped; zero disables it.
+	RefreshInterval time.Duration `json:"refreshInterval" yaml:"refreshInterval"`
+	// Quarantine keeps a container out this long after it was last seen
+	// stopped or unhealthy.
+	Quarantine time.Duration `json:"quarantine" yaml:"quarantine"`
+	// Network names the container network to connect through, or "auto"
+	// for the one shared with the gateway's own container.
+	Network string `json:"network" yaml:"network"`
+	// PublishedPorts connects to the host ports the containers publish,
+	// for a gateway outside Docker. PublishedHost reaches ports published
+	// on all interfaces; it defaults to the tcp:// daemon or 127.0.0.1.
+	PublishedPorts bool   `json:"publishedPorts" yaml:"publishedPorts"`
+	PublishedHost  string `json:"publishedHost" yaml:"publishedHost"`
+	// ComposeProject limits discovery to the containers of one compose
+	// project, or of the gateway's own with "auto".
+	ComposeProject string `json:"composeProject" yaml:"composeProject"`
+}
+
+type staticDiscoveryConfig struct {
+	// File lists the instances and their credentials.
+	File string `json:"file" yaml:"file"`
+}
+
+type fileDiscoveryConfig struct {
+	// Path lists the instances in the format of the static provider and is
+	// watched for changes.
+	Path         string        `json:"path" yaml:"path"`
+	PollInterval time.Duration `json:"pollInterval" yaml:"pollInterval"`
+}
+
+type dnsDiscoveryConfig struct {
+	// Name is resolved for SRV records, then A and AAAA records.
+	Name    string `json:"name" yaml:"name"`
+	Service string `json:"service" yaml:"service"`
+	Proto   string `json:"proto" yaml:"proto"`
+	// Port applies to instances found through A and AAAA records.
+	Port string `json:"port" yaml:"port"`
+	// Server replaces the system resolver when set, as host:port.
+	Server          string        `json:"server" yaml:"server"`
+	SecretsFile     string        `json:"secretsFile" yaml:"secretsFile"`
+	RefreshInterval time.Duration `json:"refreshInterval" yaml:"refreshInterval"`
+}
+
+type kubernetesDiscoveryConfig struct {
+	// Kubeconfig is used instead of the in-cluster service account when set.
+	Kubeconfig    string `json:"kubeconfig" yaml:"kubeconfig"`
+	Namespace     string `json:"namespace" yaml:"namespace"`
+	LabelSelector string `json:"labelSelector" yaml:"labelSelector"`
+	// Port is the Minio container or endpoint port, by name or number.
+	Port string `json:"port" yaml:"port"`
+	// Endpoints reads Endpoints objects instead of Pods. It needs
+	// CredentialsSecret, since Endpoints carry no environment.
+	Endpoints bool `json:"endpoints" yaml:"endpoints"`
+	// CredentialsSecret replaces the MINIO_* variables of the Pods when set.
+	CredentialsSecret credentialsSecretConfig `json:"credentialsSecret" yaml:"credentialsSecret"`
+	// ResyncInterval lists the instances again even without watch events.
+	ResyncInterval time.Duration `json:"resyncInterval" yaml:"resyncInterval"`
+}
+
+type credentialsSecretConfig struct {
+	Name         string `json:"name" yaml:"name"`
+	AccessKeyKey string `json:"accessKeyKey" yaml:"accessKeyKey"`
+	SecretKeyKey string `json:"secretKeyKey" yaml:"secretKeyKey"`
+}
+
+type storageConfig struct {
+	Bucket            string            `json:"bucket" yaml:"bucket"`
+	Compression       string            `json:"compression" yaml:"compression"`
+	Deduplication     bool              `json:"deduplication" yaml:"deduplication"`
+	RequestCoalescing bool              `json:"requestCoalescing" yaml:"requestCoalescing"`
+	Erasure           erasureConfig     `json:"erasure" yaml:"erasure"`
+	Cache             cacheConfig       `json:"cache" yaml:"cache"`
+	DiskCache         diskCacheConfig   `json:"diskCache" yaml:"diskCache"`
+	Keys              storage.KeyPolicy `json:"keys" yaml:"keys"`
+	// Quotas enables usage tracking when set, even without limits.
+	Quotas *storage.QuotaConfig `json:"quotas,omitempty" yaml:"quotas,omitempty"`
+}
+
+type erasureConfig struct {
+	DataShards   int `json:"dataShards" yaml:"dataShards"`
+	ParityShards int `json:"parityShards" yaml:"parityShards"`
+}
+
+type cacheConfig struct {
+	// MaxBytes enables the in-memory object cache when positive.
+	MaxBytes      int64 `json:"maxBytes" yaml:"maxBytes"`
+	MaxObjectSize int64 `json:"maxObjectSize" yaml:"maxObjectSize"`
+}
+
+type diskCacheConfig struct {
+	// Dir enables the on-disk cache when set.
+	Dir      string `json:"dir" yaml:"dir"`
+	MaxBytes int64  `json:"maxBytes" yaml:"maxBytes"`
+}
+
+func defaultConfig() config {
+	return config{
+		Server: serverConfig{
+			Addr:                ":3000",
+			ReadHeaderTimeout:   5 * time.Second,
+			ShutdownGracePeriod: 10 * time.Second,
+		},
+		Discovery: discoveryConfig{
+			Provider: providerDocker,
+			Timeout:  10 * time.Second,
+			Startup: startupConfig{
+				MinInstances:   1,
+				Timeout:        2 * time.Minute,
+				InitialBackoff: time.Second,
+				MaxBackoff:     30 * time.Second,
+			},
+			Docker: dockerDiscoveryConfig{
+				APIPort:         discovery.DefaultAPIPort,
+				RefreshInterval: 30 * time.Second,
+			},
+			File: fileDiscoveryConfig{
+				PollInterval: 2 * time.Second,
+			},
+			DNS: dnsDiscoveryConfig{
+				Service:         "minio",
+				Proto:           "tcp",
+				Port:            discovery.DefaultAPIPort,
+				RefreshInterval: 30 * time.Second,
+			},
+			Kubernetes: kubernetesDiscoveryConfig{
+				LabelSelector: "app=minio",
+				Port:          discovery.DefaultAPIPort,
+				CredentialsSecret: credentialsSecretConfig{
+					AccessKeyKey: "accesskey",
+					SecretKeyKey: "secretkey",
+				},
+				ResyncInterval: 5 * time.Minute,
+			},
+		},
+		Storage: storageConfig{
+			Bucket: "objects",
+			Cache:  cacheConfig{MaxObjectSize: defaultCacheMaxObjectSize},
+			Keys:   storage.DefaultKeyPolicy(),
+		},
+	}
+}
+
+// setting is a single value that can be set from the environment and from a
+// command-line flag.
+type setting struct {
+	env     string
+	flag    string
+	usage   string
+	boolean bool
+	set     func(cfg *config, value string) error
+	// setEnv replaces set for the environment variable when its values are
+	// read differently from the flag's.
+	setEnv func(cfg *config, value string) error
+}
+
+func field[T any](parse func(string) (T, error), target func(cfg *config) *T) func(*config, string) error {
+	return func(cfg *config, value string) error {
+		parsed, err := parse(value)
+		if err != nil {
+			return err
+		}
+		*target(cfg) = parsed
+		return nil
+	}
+}
+
+func parseString(value string) (string, error) { return value, nil }
+
+func parseInt64(value string) (int64, error) { return strconv.ParseInt(value, 10, 64) }
+
+func parseFloat(value string) (float64, error) { return strconv.ParseFloat(value, 64) }
+
+// parseNonEmpty treats any value as set, as the docker CLI reads its
+// DOCKER_TLS_VERIFY.
+func parseNonEmpty(value string) (bool, error) { return value != "", nil }
+
+// parseList splits a comma-separated list, dropping empty entries.
+func parseList(value string) ([]string, error) {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list, nil
+}
+
+func (c *config) rateLimits() *ratelimit.Config {
+	if c.Server.RateLimits == nil {
+		c.Server.RateLimits = &ratelimit.Config{}
+	}
+	return c.Server.RateLimits
+}
+
+func (c *config) quotas() *storage.QuotaConfig {
+	if c.Storage.Quotas == nil {
+		c.Storage.Quotas = &storage.QuotaConfig{}
+	}
+	return c.Storage.Quotas
+}
+
+var settings = []setting{
+	{env: "SERVER_ADDR", flag: "addr", usage: "HTTP listen address",
+		set: field(parseString, func(c *config) *string { return &c.Server.Addr })},
+	{env: "READ_HEADER_TIMEOUT", flag: "read-header-timeout", usage: "time allowed to read request headers",
+		set: field(time.ParseDuration, func(c *config) *time.Duration { return &c.Server.ReadHeaderTimeout })},
+	{env: "SHUTDOWN_GRACE_PERIOD", flag: "shutdown-grace-period", usage: "time allowed for in-flight requests on shutdown",
+		set: field(time.ParseDuration, func(c *config) *time.Duration { return &c.Server.ShutdownGracePeriod })},
+	{env: "RATE_LIMIT_RPS", flag: "rate-limit-rps", usage: "default requests per second per client",
+		set: field(parseFloat, func(c *config) *float64 { return &c.rateLimits().Default.RequestsPerSecond })},
+	{env: "RATE_LIMIT_BURST", flag: "rate-limit-burst", usage: "default request burst per client",
+		set: field(strconv.Atoi, func(c *config) *int { return &c.rateLimits().Default.Burst })},
+	{env: "RATE_LIMIT_BYTES_PER_SECOND", flag: "rate-limit-bytes-per-second", usage: "default bandwidth per client",
+		set: field(parseInt64, func(c *config) *int64 { return &c.rateLimits().Default.BytesPerSecond })},
+	{env: "API_KEYS_FILE", flag: "api-keys-file", usage: "YAML or JSON file mapping client API keys to client names",
+		set: field(parseString, func(c *config) *string { return &c.Server.APIKeysFile })},
+
+	{env: "DISCOVERY_PROVIDER", flag: "discovery-provider", usage: `instance source: "docker", "static", "file", "dns" or "kubernetes"`,
+		set: field(parseString, func(c *config) *string { return &c.Discovery.Provider })},
+	{env: "DISCOVERY_TIMEOUT", flag: "discovery-timeout", usage: "time allowed for each discovery attempt",
+		set: field(time.ParseDuration, func(c *config) *time.Duration { return &c.Discovery.Timeout })},
+	{env: "DISCOVERY_MIN_INSTANCES", flag: "discovery-min-instances", usage: "instances to wait for before serving objects",
+		set: field(strconv.Atoi, func(c *config) *int { return &c.Discovery.Startup.MinInstances })},
+	{env: "DISCOVERY_STARTUP_TIMEOUT", flag: "discovery-startup-timeout", usage: "how long to wait for instances at startup, 0 to wait forever",
+		set: field(time.ParseDuration, func(c *config) *time.Duration { return &c.Discovery.Startup.Timeout })},
+	{env: "DISCOVERY_INITIAL_BACKOFF", flag: "discovery-initial-backoff", usage: "delay after the first failed discovery attempt",
+		set: field(time.ParseDuration, func(c *config) *time.Duration { return &c.Discovery.Startup.InitialBackoff })},
+	{env: "DISCOVERY_MAX_BACKOFF", flag: "discovery-max-backoff", usage: "longest delay between discovery attempts",
+		set: field(time.ParseDuration, func(c *config) *time.Duration { return &c.Discovery.Startup.MaxBackoff })},
+	{env: "DISCOVERY_SERVE_WHILE_WAITING", flag: "discovery-serve-while-waiting", usage: "serve as not ready while waiting for instances", boolean: true,
+		set: field(strconv.ParseBool, func(c *config) *bool { return &c.Discovery.Startup.ServeWhileWaiting })},
+	{env: "MINIO_CONTAINER_NAME_PATTERN", flag: "container-name-pattern", usage: "substring of Minio container names",
+		set: field(parseString, func(c *config) *string { return &c.Discovery.Docker.ContainerNamePattern })},
+	{env: "DOCKER_LABEL_SELECTOR", flag: "docker-label-selector", usage: `comma-separated "key" or "key=value" labels of Minio containers`,
+		set: field(parseList, func(c *config) *[]string { return &c.Discovery.Docker.LabelSelectors })},
+	{env: "MINIO_API_PORT", flag: "minio-api-port", usage: "port of the Minio S3 API",
+		set: field(parseString, func(c *config) *string { return &c.Discovery.Docker.APIPort })},
+	{env: "DOCKER_HOST", flag: "docker-host", usage: "Docker daemon address, unix:///path or tcp://host:port",
+		set: field(parseString, func(c *config) *string { return &c.Discovery.Docker.Host })},
+	{env: "DOCKER_SOCKET", flag: "docker-socket", usage: "path of the Docker or Podman daemon socket",
+		set: field(parseString, func(c *config) *string { return &c.Discovery.Docker.Socket })},
+	{env: "DOCKER_TLS_VERIFY", flag: "docker-tls-verify", usage: "verify the certificate of a tcp:// Docker daemon; any non-empty DOCKER_TLS_VERIFY enables it, as for the docker CLI", boolean: true,
+		set:    field(strconv.ParseBool, func(c *config) *bool { return &c.Discovery.Docker.TLSVerify }),
+		setEnv: field(parseNonEmpty, func(c *config) *bool { return &c.Discovery.Docker.TLSVerify })},
+	{env: "DOCKER_CERT_PATH", flag: "docker-cert-path", usage: "directory holding ca.pem, cert.pem and key.pem for a tcp:// Docker daemon",
+		set: field(parseString, func(c *config) *string { return &c.Discovery.Docker.CertPath })},
+	{env: "DOCKER_SECRETS_DIR", flag: "docker-secrets-dir", usage: "host directory holding the /run/secrets files of Minio containers",
+		set: field(parseString, func(c *config) *string { return &c.Discovery.Docker.SecretsDir })},
+	{env: "DOCKER_CREDENTIALS_FILE", flag: "docker-credentials-file", usage: "YAML or JSON file of Minio credentials by container name",
+		set: field(parseString, func(c *config) *string { return &c.Discovery.Docker.CredentialsFile })},
+	{env: "DOCKER_REFRESH_INTERVAL", flag: "docker-refresh-interval", usage: "how often Minio containers are listed again, 0 to disable",
+		set: field(time.ParseDuration, func(c *config) *time.Duration { return &c.Discovery.Docker.RefreshInterval })},
+	{env: "DOCKER_QUARANTINE", flag: "docker-quarantine", usage: "how long a container stays out after it was last seen stopped or unhealthy",
+		set: field(time.ParseDuration, func(c *config) *time.Duration { return &c.Discovery.Docker.Quarantine })},
+	{env: "DOCKER_NETWORK", flag: "docker-network", usage: `container network to reach Minio through, or "auto" for the gateway's own`,
+		set: field(parseString, func(c *config) *string { return &c.Discovery.Docker.Network })},
+	{env: "DOCKER_PUBLISHED_PORTS", flag: "docker-published-ports", usage: "reach Minio through the host ports its containers publish", boolean: true,
+		set: field(strconv.ParseBool, func(c *config) *bool { return &c.Discovery.Docker.PublishedPorts })},
+	{env: "DOCKER_PUBLISHED_HOST", flag: "docker-published-host", usage: "host serving ports published on all interfaces",
+		set: field(parseString, func(c *config) *string { return &c.Discovery.Docker.PublishedHost })},
+	{env: "DOCKER_COMPOSE_PROJECT", flag: "docker-compose-project", usage: `compose project of the Minio containers, or "auto" for the gateway's own`,
+		set: field(parseString, func(c *config) *string { return &c.Discovery.Docker.ComposeProject })},
+	{env: "STATIC_INSTANCES_FILE", flag: "static-instances-file", usage: "YAML or JSON file listing the instances of the static provider",
+		set: field(parseString, func(c *config) *string { return &c.Discovery.Static.File })},
+	{env: "INSTANCES_FILE", flag: "instances-file", usage: "YAML or JSON instance file watched by the file provider",
+		set: field(parseString, func(c *config) *string { return &c.Discovery.File.Path })},
+	{env: "INSTANCES_FILE_POLL_INTERVAL", flag: "instances-file-poll-interval", usage: "how often the file provider checks the instance file",
+		set: field(time.ParseDuration, func(c *config) *time.Duration { return &c.Discovery.File.PollInterval })},
+	{env: "DNS_NAME", flag: "dns-name", usage: "service name resolved by the dns provider",
+		set: field(parseString, func(c *config) *string { return &c.Discovery.DNS.Name })},
+	{env: "DNS_SRV_SERVICE", flag: "dns-srv-service", usage: "SRV service queried by the dns provider",
+		set: field(parseString, func(c *config) *string { return &c.Discovery.DNS.Service })},
+	{env: "DNS_SRV_PROTO", flag: "dns-srv-proto", usage: "SRV protocol queried by the dns provider",
+		set: field(parseString, func(c *config) *string { return &c.Discovery.DNS.Proto })},
+	{env: "DNS_PORT", flag: "dns-port", usage: "Minio port of instances found through A and AAAA records",
+		set: field(parseString, func(c *config) *string { return &c.Discovery.DNS.Port })},
+	{env: "DNS_SERVER", flag: "dns-server", usage: "DNS server as host:port instead of the system resolver",
+		set: field(parseString, func(c *config) *string { return &c.Discovery.DNS.Server })},
+	{env: "DNS_SECRETS_FILE", flag: "dns-secrets-file", usage: "YAML or JSON file with the credentials of DNS discovered instances",
+		set: field(parseString, func(c *config) *string { return &c.Discovery.DNS.SecretsFile })},
+	{env: "DNS_REFRESH_INTERVAL", flag: "dns-refresh-interval", usage: "how often the dns provider resolves the service again",
+		set: field(time.ParseDuration, func(c *config) *time.Duration { return &c.Discovery.DNS.RefreshInterval })},
+	{env: "KUBECONFIG", flag: "kubeconfig", usage: "kubeconfig used instead of the in-cluster service account",
+		set: field(parseString, func(c *config) *string { return &c.Discovery.Kubernetes.Kubeconfig })},
+	{env: "KUBERNETES_NAMESPACE", flag: "kubernetes-namespace", usage: "namespace searched by the kubernetes provider",
+		set: field(parseString, func(c *config) *string { return &c.Discovery.Kubernetes.Namespace })},
+	{env: "KUBERNETES_LABEL_SELECTOR", flag: "kubernetes-label-selector", usage: "label selector of the Minio pods or endpoints",
+		set: field(parseString, func(c *config) *string { return &c.Discovery.Kubernetes.LabelSelector })},
+	{env: "KUBERNETES_PORT_NAME", flag: "kubernetes-port", usage: "Minio port of the pods or endpoints, by name or number",
+		set: field(parseString, func(c *config) *string { return &c.Discovery.Kubernetes.Port })},
+	{env: "KUBERNETES_ENDPOINTS", flag: "kubernetes-endpoints", usage: "read Endpoints instead of Pods; needs a credentials Secret", boolean: true,
+		set: field(strconv.ParseBool, func(c *config) *bool { return &c.Discovery.Kubernetes.Endpoints })},
+	{env: "KUBERNETES_CREDENTIALS_SECRET", flag: "kubernetes-credentials-secret", usage: "Secret holding the credentials of every instance",
+		set: field(parseString, func(c *config) *string { return &c.Discovery.Kubernetes.CredentialsSecret.Name })},
+	{env: "KUBERNETES_RESYNC_INTERVAL", flag: "kubernetes-resync-interval", usage: "how often the kubernetes provider lists instances without watch events",
+		set: field(time.ParseDuration, func(c *config) *time.Duration { return &c.Discovery.Kubernetes.ResyncInterval })},
+
+	{env: "BUCKET_NAME", flag: "bucket", usage: "default bucket",
+		set: field(parseString, func(c *config) *string { return &c.Storage.Bucket })},
+	{env: "COMPRESSION_CODEC", flag: "compression", usage: "compression codec for stored objects",
+		set: field(parseString, func(c *config) *string { return &c.Storage.Compression })},
+	{env: "DEDUPLICATION", flag: "deduplication", usage: "store identical content once", boolean: true,
+		set: field(strconv.ParseBool, func(c *config) *bool { return &c.Storage.Deduplication })},
+	{env: "REQUEST_COALESCING", flag: "request-coalescing", usage: "share concurrent reads of one object", boolean: true,
+		set: field(strconv.ParseBool, func(c *config) *bool { return &c.Storage.RequestCoalescing })},
+	{env: "ERASURE_DATA_SHARDS", flag: "erasure-data-shards", usage: "data shards per erasure-coded object",
+		set: field(strconv.Atoi, func(c *config) *int { return &c.Storage.Erasure.DataShards })},
+	{env: "ERASURE_PARITY_SHARDS", flag: "erasure-parity-shards", usage: "parity shards per erasure-coded object",
+		set: field(strconv.Atoi, func(c *config) *int { return &c.Storage.Erasure.ParityShards })},
+	{env: "CACHE_MAX_BYTES", flag: "cache-max-bytes", usage: "size of the in-memory object cache",
+		set: field(parseInt64, func(c *config) *int64 { return &c.Storage.Cache.MaxBytes })},
+	{env: "CACHE_MAX_OBJECT_SIZE", flag: "cache-max-object-size", usage: "largest object kept in memory",
+		set: field(parseInt64, func(c *config) *int64 { return &c.Storage.Cache.MaxObjectSize })},
+	{env: "DISK_CACHE_DIR", flag: "disk-cache-dir", usage: "directory of the on-disk cache",
+		set: field(parseString, func(c *config) *string { return &c.Storage.DiskCache.Dir })},
+	{env: "DISK_CACHE_MAX_BYTES", flag: "disk-cache-max-bytes", usage: "size of the on-disk cache",
+		set: field(parseInt64, func(c *config) *int64 { return &c.Storage.DiskCache.MaxBytes })},
+	{env: "OBJECT_KEY_MAX_LENGTH", flag: "object-key-max-length", usage: "maximum object key length",
+		set: field(strconv.Atoi, func(c *config) *int { return &c.Storage.Keys.MaxLength })},
+	{env: "OBJECT_KEY_CHARACTERS", flag: "object-key-characters", usage: `punctuation allowed in object keys, for example "/.-_"`,
+		set: setKeyCharacters},
+	{env: "QUOTA_TENANT_BYTES", flag: "quota-tenant-bytes", usage: "bytes stored per tenant",
+		set: field(parseInt64, func(c *config) *int64 { return &c.quotas().Tenant.MaxBytes })},
+	{env: "QUOTA_TENANT_OBJECTS", flag: "quota-tenant-objects", usage: "objects stored per tenant",
+		set: field(parseInt64, func(c *config) *int64 { return &c.quotas().Tenant.MaxObjects })},
+	{env: "QUOTA_INSTANCE_BYTES", flag: "quota-instance-bytes", usage: "bytes stored per instance",
+		set: field(parseInt64, func(c *config) *int64 { return &c.quotas().Instance.MaxBytes })},
+	{env: "QUOTA_INSTANCE_OBJECTS", flag: "quota-instance-objects", usage: "objects stored per instance",
+		set: field(parseInt64, func(c *config) *int64 { return &c.quotas().Instance.MaxObjects })},
+	{env: "QUOTA_TENANT_PREFIX_LENGTH", flag: "quota-tenant-prefix-length", usage: "key prefix length identifying the tenant",
+		set: field(strconv.Atoi, func(c *config) *int { return &c.quotas().TenantPrefixLength })},
+}
+
+// setKeyCharacters replaces the punctuation allowed in object keys with the
+// characters in value.
+func setKeyCharacters(cfg *config, value string) error {
+	keys := &cfg.Storage.Keys
+	keys.AllowSlashes, keys.AllowDots, keys.AllowDashes, keys.AllowUnderscores = false, false, false, false
+	for _, c := range value {
+		switch c {
+		case '/':
+			keys.AllowSlashes = true
+		case '.':
+			keys.AllowDots = true
+		case '-':
+			keys.AllowDashes = true
+		case '_':
+			keys.AllowUnderscores = true
+		default:
+			return fmt.Errorf("%q cannot be allowed", c)
+		}
+	}
+	return nil
+}
+
+// loadConfig builds the configuration from args and the environment. It
+// reports whether the configuration should be printed instead of served.
+func loadConfig(args []string, getenv func(string) string) (config, bool, error) {
+	flags := flag.NewFlagSet("gateway", flag.ContinueOnError)
+	configPath := flags.String("config", getenv("CONFIG_FILE"), "YAML or JSON configuration file (env CONFIG_FILE)")
+	printConfig := flags.Bool("print-config", false, "print the effective configuration and exit")
+
+	type flagValue struct {
+		setting setting
+		value   string
+	}
+	var flagValues []flagValue
+	for _, s := range settings {
+		usage := fmt.Sprintf("%s (env %s)", s.usage, s.env)
+		record := func(value string) error {
+			flagValues = append(flagValues, flagValue{setting: s, value: value})
+			return nil
+		}
+		if s.boolean {
+			flags.BoolFunc(s.flag, usage, record)
+		} else {
+			flags.Func(s.flag, usage, record)
+		}
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return config{}, false, err
+	}
+	if flags.NArg() > 0 {
+		return config{}, false, fmt.Errorf("unexpected arguments: %v", flags.Args())
+	}
+
+	cfg := defaultConfig()
+	if *configPath != "" {
+		if err := cfg.loadFile(*configPath); err != nil {
+			return config{}, false, err
+		}
+	}
+
+	for _, s := range settings {
+		value := getenv(s.env)
+		if value == "" {
+			continue
+		}
+		set := s.set
+		if s.setEnv != nil {
+			set = s.setEnv
+		}
+		if err := set(&cfg, value); err != nil {
+			return config{}, false, fmt.Errorf("invalid %s: %w", s.env, err)
+		}
+	}
+
+	for _, fv := range flagValues {
+		if err := fv.setting.set(&cfg, fv.value); err != nil {
+			return config{}, false, fmt.Errorf("invalid -%s: %w", fv.setting.flag, err)
+		}
+	}
+
+	if err := cfg.validate(); err != nil {
+		return config{}, false, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return cfg, *printConfig, nil
+}
+
+// loadFile overlays the file at path. JSON is read as YAML, of which it is a
+// subset, so durations are written as strings such as "10s" in both.
+func (c *config) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func (c config) validate() error {
+	var errs []error
+
+	if c.Server.Addr == "" {
+		errs = append(errs, errors.New("server.addr is required"))
+	}
+	if c.Server.ReadHeaderTimeout <= 0 {
+		errs = append(errs, errors.New("server.readHeaderTimeout must be positive"))
+	}
+	if c.Server.ShutdownGracePeriod <= 0 {
+		errs = append(errs, errors.New("server.shutdownGracePeriod must be positive"))
+	}
+
+	if c.Discovery.Timeout <= 0 {
+		errs = append(errs, errors.New("discovery.timeout must be positive"))
+	}
+	startup := c.Discovery.Startup
+	if startup.MinInstances < 1 {
+		errs = append(errs, errors.New("discovery.startup.minInstances must be positive"))
+	}
+	if startup.Timeout < 0 {
+		errs = append(errs, errors.New("discovery.startup.timeout cannot be negative"))
+	}
+	if startup.InitialBackoff <= 0 || startup.MaxBackoff < startup.InitialBackoff {
+		errs = append(errs, errors.New("discovery.startup.initialBackoff must be positive and not above maxBackoff"))
+	}
+	switch c.Discovery.Provider {
+	case providerDocker:
+		if port, err := strconv.Atoi(c.Discovery.Docker.APIPort); err != nil || port < 1 || port > 65535 {
+			errs = append(errs, fmt.Errorf("discovery.docker.apiPort %q is not a valid port", c.Discovery.Docker.APIPort))
+		}
+		if c.Discovery.Docker.RefreshInterval < 0 || c.Discovery.Docker.Quarantine < 0 {
+			errs = append(errs, errors.New("discovery.docker.refreshInterval and quarantine cannot be negative"))
+		}
+		if c.Discovery.Docker.PublishedPorts && c.Discovery.Docker.Network != "" {
+			errs = append(errs, errors.New("discovery.docker.network cannot be combined with publishedPorts"))
+		}
+	case providerStatic:
+		if c.Discovery.Static.File == "" {
+			errs = append(errs, errors.New("discovery.static.file is required"))
+		}
+	case providerFile:
+		if c.Discovery.File.Path == "" {
+			errs = append(errs, errors.New("discovery.file.path is required"))
+		}
+		if c.Discovery.File.PollInterval <= 0 {
+			errs = append(errs, errors.New("discovery.file.pollInterval must be positive"))
+		}
+	case providerDNS:
+		if c.Discovery.DNS.Name == "" {
+			errs = append(errs, errors.New("discovery.dns.name is required"))
+		}
+		if port, err := strconv.Atoi(c.Discovery.DNS.Port); err != nil || port < 1 || port > 65535 {
+			errs = append(errs, fmt.Errorf("discovery.dns.port %q is not a valid port", c.Discovery.DNS.Port))
+		}
+		if c.Discovery.DNS.SecretsFile == "" {
+			errs = append(errs, errors.New("discovery.dns.secretsFile is required"))
+		}
+		if c.Discovery.DNS.RefreshInterval <= 0 {
+			errs = append(errs, errors.New("discovery.dns.refreshInterval must be positive"))
+		}
+	case providerK8s:
+		k8s := c.Discovery.Kubernetes
+		if k8s.Port == "" {
+			errs = append(errs, errors.New("discovery.kubernetes.port is required"))
+		}
+		if k8s.CredentialsSecret.Name != "" && (k8s.CredentialsSecret.AccessKeyKey == "" || k8s.CredentialsSecret.SecretKeyKey == "") {
+			errs = append(errs, errors.New("discovery.kubernetes.credentialsSecret needs accessKeyKey and secretKeyKey"))
+		}
+		if k8s.Endpoints && k8s.CredentialsSecret.Name == "" {
+			errs = append(errs, errors.New("discovery.kubernetes.endpoints needs credentialsSecret.name"))
+		}
+		if k8s.ResyncInterval <= 0 {
+			errs = append(errs, errors.New("discovery.kubernetes.resyncInterval must be positive"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("discovery.provider %q is not supported", c.Discovery.Provider))
+	}
+
+	if err := storage.ValidateBucketName(c.Storage.Bucket); err != nil {
+		errs = append(errs, fmt.Errorf("storage.bucket: %w", err))
+	}
+	if (c.Storage.Erasure.DataShards == 0) != (c.Storage.Erasure.ParityShards == 0) {
+		errs = append(errs, errors.New("storage.erasure needs both dataShards and parityShards"))
+	}
+	if c.Storage.Cache.MaxBytes < 0 {
+		errs = append(errs, errors.New("storage.cache.maxBytes cannot be negative"))
+	}
+	if c.Storage.Cache.MaxBytes > 0 && c.Storage.Cache.MaxObjectSize <= 0 {
+		errs = append(errs, errors.New("storage.cache.maxObjectSize must be positive"))
+	}
+	if c.Storage.DiskCache.Dir != "" && c.Storage.DiskCache.MaxBytes <= 0 {
+		errs = append(errs, errors.New("storage.diskCache.maxBytes must be positive"))
+	}
+	if c.Storage.Keys.MaxLength < 1 {
+		errs = append(errs, errors.New("storage.keys.maxLength must be positive"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// print writes the configuration as YAML.
+func (c config) print(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	return encoder.Close()
+}
+
+// discoveryProvider returns the provider selected by the configuration.
+func (c config) discoveryProvider() (discovery.Provider, error) {
+	switch c.Discovery.Provider {
+	case providerStatic:
+		return discovery.NewStaticProvider(c.Discovery.Static.File), nil
+	case providerFile:
+		return discovery.NewFileProvider(c.Discovery.File.Path, c.Discovery.File.PollInterval), nil
+	case providerDNS:
+		dns := c.Discovery.DNS
+		return discovery.NewDNSProvider(dns.Name, dns.SecretsFile,
+			discovery.WithSRVService(dns.Service, dns.Proto),
+			discovery.WithDNSPort(dns.Port),
+			discovery.WithDNSServer(dns.Server),
+		), nil
+	case providerK8s:
+		k8s := c.Discovery.Kubernetes
+		opts := []discovery.KubernetesOption{
+			discovery.WithKubeconfig(k8s.Kubeconfig),
+			discovery.WithNamespace(k8s.Namespace),
+			discovery.WithKubernetesPort(k8s.Port),
+		}
+		if k8s.Endpoints {
+			opts = append(opts, discovery.WithEndpoints())
+		}
+		if secret := k8s.CredentialsSecret; secret.Name != "" {
+			opts = append(opts, discovery.WithCredentialsSecret(secret.Name, secret.AccessKeyKey, secret.SecretKeyKey))
+		}
+		return discovery.NewKubernetesProvider(k8s.LabelSelector, opts...)
+	default:
+		opts := []discovery.DockerOption{
+			discovery.WithContainerNamePattern(c.Discovery.Docker.ContainerNamePattern),
+			discovery.WithLabelSelectors(c.Discovery.Docker.LabelSelectors...),
+			discovery.WithAPIPort(c.Discovery.Docker.APIPort),
+			discovery.WithDockerSocket(c.Discovery.Docker.Socket),
+			discovery.WithDockerHost(c.Discovery.Docker.Host),
+			discovery.WithDockerTLS(c.Discovery.Docker.CertPath, c.Discovery.Docker.TLSVerify),
+			discovery.WithSecretsDir(c.Discovery.Docker.SecretsDir),
+			discovery.WithCredentialsFile(c.Discovery.Docker.CredentialsFile),
+			discovery.WithQuarantine(c.Discovery.Docker.Quarantine),
+			discovery.WithNetwork(c.Discovery.Docker.Network),
+			discovery.WithComposeProject(c.Discovery.Docker.ComposeProject),
+		}
+		if c.Discovery.Docker.PublishedPorts {
+			opts = append(opts, discovery.WithPublishedPorts(c.Discovery.Docker.PublishedHost))
+		}
+		return discovery.NewDockerProvider(opts...)
+	}
+}
+
+// waitOptions returns how discovery waits for instances at startup.
+func (c config) waitOptions() []discovery.WaitOption {
+	startup := c.Discovery.Startup
+	minInstances := startup.MinInstances
+	if erasure := c.Storage.Erasure; erasure.DataShards > 0 {
+		minInstances = max(minInstances, erasure.DataShards+erasure.ParityShards)
+	}
+	return []discovery.WaitOption{
+		discovery.WithMinInstances(minInstances),
+		discovery.WithAttemptTimeout(c.Discovery.Timeout),
+		discovery.WithBackoff(startup.InitialBackoff, startup.MaxBackoff),
+	}
+}
+
+// refreshInterval returns how often discovery runs again after startup, or
+// zero when the instances are only discovered once.
+func (c config) refreshInterval() time.Duration {
+	switch c.Discovery.Provider {
+	case providerStatic:
+		return 0
+	case providerFile:
+		return fileResyncInterval
+	case providerDNS:
+		return c.Discovery.DNS.RefreshInterval
+	case providerK8s:
+		return c.Discovery.Kubernetes.ResyncInterval
+	default:
+		return c.Discovery.Docker.RefreshInterval
+	}
+}
+
+func (c config) gatewayOptions() []storage.GatewayOption {
+	sc := c.Storage
+	opts := []storage.GatewayOption{
+		storage.WithBucketName(sc.Bucket),
+		storage.WithKeyPolicy(sc.Keys),
+	}
+	if sc.Compression != "" {
+		opts = append(opts, storage.WithCompression(sc.Compression))
+	}
+	if sc.Deduplication {
+		opts = append(opts, storage.WithDeduplication())
+	}
+	if sc.RequestCoalescing {
+		opts = append(opts, storage.WithRequestCoalescing())
+	}
+	if sc.Erasure.DataShards > 0 {
+		opts = append(opts, storage.WithErasureCoding(sc.Erasure.DataShards, sc.Erasure.ParityShards))
+	}
+	if sc.Cache.MaxBytes > 0 {
+		opts = append(opts, storage.WithObjectCache(sc.Cache.MaxBytes, sc.Cache.MaxObjectSize))
+	}
+	if sc.DiskCache.Dir != "" {
+		opts = append(opts, storage.WithDiskCache(sc.DiskCache.Dir, sc.DiskCache.MaxBytes))
+	}
+	if sc.Quotas != nil {
+		opts = append(opts, storage.WithQuotas(*sc.Quotas))
+	}
+	return opts
+}
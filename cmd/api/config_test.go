@@ -0,0 +1,454 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/irensaltali/object-storage-gateway/internal/ratelimit"
+)
+
+func TestLoadConfig_Precedence(t *testing.T) {
+	file := writeConfigFile(t, `
+server:
+  addr: ":4000"
+discovery:
+  timeout: 20s
+storage:
+  bucket: from-file
+`)
+
+	tests := []struct {
+		name        string
+		args        []string
+		env         map[string]string
+		wantAddr    string
+		wantTimeout time.Duration
+		wantBucket  string
+	}{
+		{
+			name:        "defaults",
+			wantAddr:    ":3000",
+			wantTimeout: 10 * time.Second,
+			wantBucket:  "objects",
+		},
+		{
+			name:        "file over defaults",
+			args:        []string{"-config", file},
+			wantAddr:    ":4000",
+			wantTimeout: 20 * time.Second,
+			wantBucket:  "from-file",
+		},
+		{
+			name:        "file from environment",
+			env:         map[string]string{"CONFIG_FILE": file},
+			wantAddr:    ":4000",
+			wantTimeout: 20 * time.Second,
+			wantBucket:  "from-file",
+		},
+		{
+			name:        "environment over file",
+			args:        []string{"-config", file},
+			env:         map[string]string{"SERVER_ADDR": ":5000", "DISCOVERY_TIMEOUT": "30s"},
+			wantAddr:    ":5000",
+			wantTimeout: 30 * time.Second,
+			wantBucket:  "from-file",
+		},
+		{
+			name:        "flags over environment",
+			args:        []string{"-config", file, "-addr", ":6000", "-bucket", "from-flag"},
+			env:         map[string]string{"SERVER_ADDR": ":5000", "BUCKET_NAME": "from-env"},
+			wantAddr:    ":6000",
+			wantTimeout: 20 * time.Second,
+			wantBucket:  "from-flag",
+		},
+		{
+			name:        "last flag wins",
+			args:        []string{"-addr", ":6000", "-addr", ":7000"},
+			wantAddr:    ":7000",
+			wantTimeout: 10 * time.Second,
+			wantBucket:  "objects",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, printOnly, err := loadConfig(tt.args, mapEnv(tt.env))
+			if err != nil {
+				t.Fatalf("loadConfig() error = %v", err)
+			}
+			if printOnly {
+				t.Fatal("loadConfig() asked to print without -print-config")
+			}
+			if cfg.Server.Addr != tt.wantAddr {
+				t.Fatalf("addr = %q, want %q", cfg.Server.Addr, tt.wantAddr)
+			}
+			if cfg.Discovery.Timeout != tt.wantTimeout {
+				t.Fatalf("discovery timeout = %v, want %v", cfg.Discovery.Timeout, tt.wantTimeout)
+			}
+			if cfg.Storage.Bucket != tt.wantBucket {
+				t.Fatalf("bucket = %q, want %q", cfg.Storage.Bucket, tt.wantBucket)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_BooleanSettings(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		want bool
+	}{
+		{name: "unset", want: false},
+		{name: "bare flag", args: []string{"-deduplication"}, want: true},
+		{name: "flag value", args: []string{"-deduplication=false"}, env: map[string]string{"DEDUPLICATION": "true"}, want: false},
+		{name: "environment", env: map[string]string{"DEDUPLICATION": "1"}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _, err := loadConfig(tt.args, mapEnv(tt.env))
+			if err != nil {
+				t.Fatalf("loadConfig() error = %v", err)
+			}
+			if cfg.Storage.Deduplication != tt.want {
+				t.Fatalf("deduplication = %v, want %v", cfg.Storage.Deduplication, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_DockerTLSVerify(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		want bool
+	}{
+		{name: "unset", want: false},
+		// Any non-empty DOCKER_TLS_VERIFY enables verification, as for the docker CLI.
+		{name: "environment zero", env: map[string]string{"DOCKER_TLS_VERIFY": "0"}, want: true},
+		{name: "environment false", env: map[string]string{"DOCKER_TLS_VERIFY": "false"}, want: true},
+		{name: "flag", args: []string{"-docker-tls-verify"}, want: true},
+		{name: "flag false over environment", args: []string{"-docker-tls-verify=false"}, env: map[string]string{"DOCKER_TLS_VERIFY": "1"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _, err := loadConfig(tt.args, mapEnv(tt.env))
+			if err != nil {
+				t.Fatalf("loadConfig() error = %v", err)
+			}
+			if cfg.Discovery.Docker.TLSVerify != tt.want {
+				t.Fatalf("tls verify = %v, want %v", cfg.Discovery.Docker.TLSVerify, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		file    string
+		wantErr string
+	}{
+		{name: "unknown flag", args: []string{"-no-such-flag"}, wantErr: "no-such-flag"},
+		{name: "positional argument", args: []string{"extra"}, wantErr: "unexpected arguments"},
+		{name: "invalid environment value", env: map[string]string{"DISCOVERY_TIMEOUT": "soon"}, wantErr: "invalid DISCOVERY_TIMEOUT"},
+		{name: "invalid flag value", args: []string{"-cache-max-bytes", "lots"}, wantErr: "invalid -cache-max-bytes"},
+		{name: "missing file", args: []string{"-config", filepath.Join(t.TempDir(), "missing.yaml")}, wantErr: "failed to open config file"},
+		{name: "unknown file field", file: "server:\n  port: 80\n", wantErr: "failed to parse config file"},
+		{name: "invalid result", env: map[string]string{"SERVER_ADDR": "", "DISCOVERY_PROVIDER": "zookeeper"}, wantErr: "invalid configuration"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.file != "" {
+				args = append(args, "-config", writeConfigFile(t, tt.file))
+			}
+			_, _, err := loadConfig(args, mapEnv(tt.env))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("loadConfig() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(cfg *config)
+		wantErr string
+	}{
+		{name: "defaults", modify: func(cfg *config) {}},
+		{name: "no address", modify: func(cfg *config) { cfg.Server.Addr = "" }, wantErr: "server.addr is required"},
+		{name: "zero shutdown grace period", modify: func(cfg *config) { cfg.Server.ShutdownGracePeriod = 0 }, wantErr: "server.shutdownGracePeriod"},
+		{name: "zero discovery timeout", modify: func(cfg *config) { cfg.Discovery.Timeout = 0 }, wantErr: "discovery.timeout"},
+		{name: "no instances required", modify: func(cfg *config) { cfg.Discovery.Startup.MinInstances = 0 }, wantErr: "minInstances"},
+		{
+			name:    "backoff above maximum",
+			modify:  func(cfg *config) { cfg.Discovery.Startup.InitialBackoff = time.Minute },
+			wantErr: "initialBackoff",
+		},
+		{name: "unknown provider", modify: func(cfg *config) { cfg.Discovery.Provider = "zookeeper" }, wantErr: `"zookeeper" is not supported`},
+		{name: "invalid docker port", modify: func(cfg *config) { cfg.Discovery.Docker.APIPort = "70000" }, wantErr: "discovery.docker.apiPort"},
+		{
+			name: "network with published ports",
+			modify: func(cfg *config) {
+				cfg.Discovery.Docker.Network = "minio"
+				cfg.Discovery.Docker.PublishedPorts = true
+			},
+			wantErr: "cannot be combined with publishedPorts",
+		},
+		{name: "static without file", modify: func(cfg *config) { cfg.Discovery.Provider = providerStatic }, wantErr: "discovery.static.file"},
+		{
+			name: "static with file",
+			modify: func(cfg *config) {
+				cfg.Discovery.Provider = providerStatic
+				cfg.Discovery.Static.File = "instances.yaml"
+			},
+		},
+		{name: "file without path", modify: func(cfg *config) { cfg.Discovery.Provider = providerFile }, wantErr: "discovery.file.path"},
+		{
+			name: "dns without name or secrets",
+			modify: func(cfg *config) {
+				cfg.Discovery.Provider = providerDNS
+				cfg.Discovery.DNS.Port = "minio"
+			},
+			wantErr: "discovery.dns.name",
+		},
+		{
+			name: "kubernetes secret without keys",
+			modify: func(cfg *config) {
+				cfg.Discovery.Provider = providerK8s
+				cfg.Discovery.Kubernetes.CredentialsSecret = credentialsSecretConfig{Name: "minio"}
+			},
+			wantErr: "accessKeyKey and secretKeyKey",
+		},
+		{
+			name: "kubernetes endpoints without secret",
+			modify: func(cfg *config) {
+				cfg.Discovery.Provider = providerK8s
+				cfg.Discovery.Kubernetes.Endpoints = true
+			},
+			wantErr: "discovery.kubernetes.endpoints",
+		},
+		{name: "invalid bucket", modify: func(cfg *config) { cfg.Storage.Bucket = "Not_Valid" }, wantErr: "storage.bucket"},
+		{name: "data shards only", modify: func(cfg *config) { cfg.Storage.Erasure.DataShards = 4 }, wantErr: "storage.erasure"},
+		{
+			name: "cache without object size",
+			modify: func(cfg *config) {
+				cfg.Storage.Cache.MaxBytes = 1 << 20
+				cfg.Storage.Cache.MaxObjectSize = 0
+			},
+			wantErr: "storage.cache.maxObjectSize",
+		},
+		{name: "disk cache without size", modify: func(cfg *config) { cfg.Storage.DiskCache.Dir = "/var/cache/gateway" }, wantErr: "storage.diskCache.maxBytes"},
+		{name: "zero key length", modify: func(cfg *config) { cfg.Storage.Keys.MaxLength = 0 }, wantErr: "storage.keys.maxLength"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultConfig()
+			tt.modify(&cfg)
+			err := cfg.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validate() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigValidate_ReportsEveryError(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Server.Addr = ""
+	cfg.Storage.Keys.MaxLength = 0
+
+	err := cfg.validate()
+	if err == nil {
+		t.Fatal("validate() accepted an invalid configuration")
+	}
+	for _, want := range []string{"server.addr", "storage.keys.maxLength"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("validate() error = %v, want it to mention %s", err, want)
+		}
+	}
+}
+
+func TestLoadConfig_PrintConfig(t *testing.T) {
+	env := map[string]string{
+		"RATE_LIMIT_RPS":     "5",
+		"QUOTA_TENANT_BYTES": "1024",
+		"DOCKER_NETWORK":     "minio",
+	}
+	cfg, printOnly, err := loadConfig([]string{"-print-config", "-addr", ":8080"}, mapEnv(env))
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	if !printOnly {
+		t.Fatal("loadConfig() did not ask to print with -print-config")
+	}
+
+	var out bytes.Buffer
+	if err := cfg.print(&out); err != nil {
+		t.Fatalf("print() error = %v", err)
+	}
+	if !strings.Contains(out.String(), `addr: :8080`) {
+		t.Fatalf("printed configuration lacks the flag value:\n%s", out.String())
+	}
+
+	// The printed configuration loads back to one that prints the same.
+	reloaded, _, err := loadConfig([]string{"-config", writeConfigFile(t, out.String())}, mapEnv(nil))
+	if err != nil {
+		t.Fatalf("loading the printed configuration failed: %v", err)
+	}
+	var again bytes.Buffer
+	if err := reloaded.print(&again); err != nil {
+		t.Fatalf("print() error = %v", err)
+	}
+	if again.String() != out.String() {
+		t.Fatalf("reloaded configuration prints as\n%s\nwant\n%s", again.String(), out.String())
+	}
+}
+
+func TestSettings(t *testing.T) {
+	envs := make(map[string]bool)
+	flags := make(map[string]bool)
+	for _, s := range settings {
+		if s.env == "" || s.flag == "" || s.usage == "" || s.set == nil {
+			t.Fatalf("setting %+v is incomplete", s)
+		}
+		if envs[s.env] || flags[s.flag] {
+			t.Fatalf("setting %s/-%s is declared twice", s.env, s.flag)
+		}
+		envs[s.env], flags[s.flag] = true, true
+	}
+}
+
+func TestSettings_Parsers(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		check   func(cfg config) bool
+		wantErr bool
+	}{
+		{
+			name: "list",
+			env:  map[string]string{"DOCKER_LABEL_SELECTOR": " app=minio, ,tier "},
+			check: func(cfg config) bool {
+				return slices.Equal(cfg.Discovery.Docker.LabelSelectors, []string{"app=minio", "tier"})
+			},
+		},
+		{
+			name:  "duration",
+			env:   map[string]string{"DOCKER_QUARANTINE": "90s"},
+			check: func(cfg config) bool { return cfg.Discovery.Docker.Quarantine == 90*time.Second },
+		},
+		{
+			name:  "int64",
+			env:   map[string]string{"DISK_CACHE_DIR": "/tmp/cache", "DISK_CACHE_MAX_BYTES": "1048576"},
+			check: func(cfg config) bool { return cfg.Storage.DiskCache.MaxBytes == 1<<20 },
+		},
+		{name: "invalid int64", env: map[string]string{"CACHE_MAX_BYTES": "1e6"}, wantErr: true},
+		{name: "invalid int", env: map[string]string{"OBJECT_KEY_MAX_LENGTH": "long"}, wantErr: true},
+		{name: "invalid float", env: map[string]string{"RATE_LIMIT_RPS": "fast"}, wantErr: true},
+		{name: "invalid bool", env: map[string]string{"DEDUPLICATION": "maybe"}, wantErr: true},
+		{
+			name: "rate limits allocated on first use",
+			env:  map[string]string{"RATE_LIMIT_RPS": "2.5", "RATE_LIMIT_BURST": "10"},
+			check: func(cfg config) bool {
+				want := ratelimit.Limit{RequestsPerSecond: 2.5, Burst: 10}
+				return cfg.Server.RateLimits != nil && cfg.Server.RateLimits.Default == want
+			},
+		},
+		{
+			name:  "rate limits left unset",
+			check: func(cfg config) bool { return cfg.Server.RateLimits == nil && cfg.Storage.Quotas == nil },
+		},
+		{
+			name: "quotas allocated on first use",
+			env:  map[string]string{"QUOTA_INSTANCE_OBJECTS": "100"},
+			check: func(cfg config) bool {
+				return cfg.Storage.Quotas != nil && cfg.Storage.Quotas.Instance.MaxObjects == 100
+			},
+		},
+		{
+			name: "key characters replace the defaults",
+			env:  map[string]string{"OBJECT_KEY_CHARACTERS": "/-"},
+			check: func(cfg config) bool {
+				keys := cfg.Storage.Keys
+				return keys.AllowSlashes && keys.AllowDashes && !keys.AllowDots && !keys.AllowUnderscores
+			},
+		},
+		{name: "unsupported key character", env: map[string]string{"OBJECT_KEY_CHARACTERS": "/*"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _, err := loadConfig(nil, mapEnv(tt.env))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("loadConfig() accepted an invalid value")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadConfig() error = %v", err)
+			}
+			if !tt.check(cfg) {
+				t.Fatalf("unexpected configuration %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestConfigRefreshInterval(t *testing.T) {
+	tests := []struct {
+		provider string
+		want     time.Duration
+	}{
+		{provider: providerDocker, want: 30 * time.Second},
+		{provider: providerStatic, want: 0},
+		{provider: providerFile, want: fileResyncInterval},
+		{provider: providerDNS, want: 30 * time.Second},
+		{provider: providerK8s, want: 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.provider, func(t *testing.T) {
+			cfg := defaultConfig()
+			cfg.Discovery.Provider = tt.provider
+			if got := cfg.refreshInterval(); got != tt.want {
+				t.Fatalf("refreshInterval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	return path
+}
+
+func mapEnv(env map[string]string) func(string) string {
+	return func(key string) string { return env[key] }
+}
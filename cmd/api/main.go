@@ -3,57 +3,125 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/irensaltali/object-storage-gateway/internal/api"
 	"github.com/irensaltali/object-storage-gateway/internal/discovery"
+	"github.com/irensaltali/object-storage-gateway/internal/ratelimit"
 	"github.com/irensaltali/object-storage-gateway/internal/storage"
 )
 
-const (
-	serverAddr          = ":3000"
-	discoveryTimeout    = 10 * time.Second
-	shutdownGracePeriod = 10 * time.Second
-)
+// usageRebuildTimeout bounds the scan of all instances that seeds the usage
+// counters at startup.
+const usageRebuildTimeout = 5 * time.Minute
 
 func main() {
+	cfg, printOnly, err := loadConfig(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Printf("configuration error: %v", err)
+		os.Exit(2)
+	}
+	if printOnly {
+		if err := cfg.print(os.Stdout); err != nil {
+			log.Printf("configuration error: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	printCredits()
 
-	if err := run(); err != nil {
+	if err := run(cfg); err != nil {
 		log.Printf("application error: %v", err)
 		os.Exit(1)
 	}
 }
 
-func run() error {
-	ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
-	defer cancel()
-
-	instances, err := discovery.DiscoverInstances(ctx)
+func run(cfg config) error {
+	provider, err := cfg.discoveryProvider()
 	if err != nil {
-		return fmt.Errorf("failed to discover minio instances: %w", err)
+		return fmt.Errorf("failed to set up discovery: %w", err)
+	}
+
+	var apiKeys ratelimit.APIKeys
+	if cfg.Server.APIKeysFile != "" {
+		if apiKeys, err = ratelimit.LoadAPIKeys(cfg.Server.APIKeysFile); err != nil {
+			return err
+		}
+	}
+
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signalCh)
+
+	// The handler starts out reporting not ready and is replaced by the
+	// gateway router once enough instances are found.
+	var handler atomic.Pointer[http.Handler]
+	var starting http.Handler = api.NewStartingRouter()
+	handler.Store(&starting)
+	server := &http.Server{
+		Addr: cfg.Server.Addr,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			(*handler.Load()).ServeHTTP(w, r)
+		}),
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+	}
+
+	serverErrCh := make(chan error, 1)
+	serve := func() {
+		go func() {
+			log.Printf("API server is running on %s", cfg.Server.Addr)
+			if listenErr := server.ListenAndServe(); listenErr != nil && !errors.Is(listenErr, http.ErrServerClosed) {
+				serverErrCh <- listenErr
+			}
+		}()
 	}
-	if len(instances) == 0 {
-		return fmt.Errorf("no minio instances found")
+	if cfg.Discovery.Startup.ServeWhileWaiting {
+		serve()
 	}
 
-	log.Printf("discovered %d minio instance(s)", len(instances))
+	instances, err := waitForInstances(cfg, provider, signalCh, serverErrCh)
+	if err != nil {
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownGracePeriod)
+		defer shutdownCancel()
+		_ = server.Shutdown(shutdownCtx)
+		if errors.Is(err, errInterrupted) {
+			return nil
+		}
+		return err
+	}
+
+	log.Printf("discovered %d minio instance(s) with the %s provider", len(instances), cfg.Discovery.Provider)
 	for _, inst := range instances {
 		log.Printf("  - instance %s at %s:%s", inst.ID, inst.Host, inst.Port)
 	}
 
-	bucketName := os.Getenv("BUCKET_NAME")
-	if bucketName == "" {
-		bucketName = "objects"
+	// Backends rejecting the gateway's credentials usually mean the keys were
+	// rotated, so ask the watcher to rediscover them right away.
+	interval := cfg.refreshInterval()
+	refreshRequests := make(chan struct{}, 1)
+	gatewayOpts := cfg.gatewayOptions()
+	if interval > 0 {
+		gatewayOpts = append(gatewayOpts, storage.WithAuthErrorHandler(func(string) {
+			select {
+			case refreshRequests <- struct{}{}:
+			default:
+			}
+		}))
 	}
 
-	gateway, err := storage.NewGateway(instances, storage.WithBucketName(bucketName))
+	gateway, err := storage.NewGateway(instances, gatewayOpts...)
 	if err != nil {
 		return fmt.Errorf("failed to create gateway: %w", err)
 	}
@@ -63,23 +131,42 @@ func run() error {
 		}
 	}()
 
-	server := &http.Server{
-		Addr:              serverAddr,
-		Handler:           api.NewRouter(gateway),
-		ReadHeaderTimeout: 5 * time.Second,
+	if cfg.Storage.Quotas != nil {
+		usageCtx, usageCancel := context.WithTimeout(context.Background(), usageRebuildTimeout)
+		err := gateway.RebuildUsage(usageCtx)
+		usageCancel()
+		if err != nil {
+			return fmt.Errorf("failed to rebuild usage counters: %w", err)
+		}
 	}
 
-	serverErrCh := make(chan error, 1)
-	go func() {
-		log.Printf("API server is running on %s", serverAddr)
-		if listenErr := server.ListenAndServe(); listenErr != nil && !errors.Is(listenErr, http.ErrServerClosed) {
-			serverErrCh <- listenErr
-		}
-	}()
+	if interval > 0 {
+		watchCtx, stopWatch := context.WithCancel(context.Background())
+		defer stopWatch()
+		go discovery.Watch(watchCtx, provider, interval, instances, gateway.UpdateInstances, discovery.WithRefreshRequests(refreshRequests))
+	}
 
-	signalCh := make(chan os.Signal, 1)
-	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
-	defer signal.Stop(signalCh)
+	var routerOpts []api.RouterOption
+	if cfg.Server.RateLimits != nil {
+		routerOpts = append(routerOpts, api.WithRateLimits(*cfg.Server.RateLimits))
+	}
+	if apiKeys != nil {
+		routerOpts = append(routerOpts, api.WithAPIKeys(apiKeys))
+	}
+	if cfg.Storage.Quotas != nil {
+		routerOpts = append(routerOpts, api.WithUsage())
+	}
+	if reporter, ok := provider.(discovery.ExclusionReporter); ok {
+		routerOpts = append(routerOpts, api.WithExclusions(reporter))
+	}
+
+	var router http.Handler = api.NewRouter(gateway, routerOpts...)
+	handler.Store(&router)
+	if cfg.Discovery.Startup.ServeWhileWaiting {
+		log.Printf("gateway is ready")
+	} else {
+		serve()
+	}
 
 	select {
 	case serverErr := <-serverErrCh:
@@ -87,7 +174,7 @@ func run() error {
 	case sig := <-signalCh:
 		log.Printf("received signal %s, starting graceful shutdown", sig)
 
-		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownGracePeriod)
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownGracePeriod)
 		defer shutdownCancel()
 
 		if shutdownErr := server.Shutdown(shutdownCtx); shutdownErr != nil {
@@ -98,6 +185,47 @@ func run() error {
 	}
 }
 
+// errInterrupted reports a signal received while waiting for instances.
+var errInterrupted = errors.New("interrupted")
+
+// waitForInstances retries discovery until enough instances are found, the
+// startup timeout passes, a signal arrives or the early server fails.
+func waitForInstances(cfg config, provider discovery.Provider, signalCh <-chan os.Signal, serverErrCh <-chan error) ([]discovery.MinioInstance, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if timeout := cfg.Discovery.Startup.Timeout; timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var stopErr error
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case sig := <-signalCh:
+			log.Printf("received signal %s while waiting for minio instances", sig)
+			stopErr = errInterrupted
+		case serverErr := <-serverErrCh:
+			stopErr = fmt.Errorf("http server failed: %w", serverErr)
+		case <-ctx.Done():
+			return
+		}
+		cancel()
+	}()
+
+	instances, err := discovery.WaitForInstances(ctx, provider, cfg.waitOptions()...)
+	cancel()
+	<-stopped
+	if stopErr != nil {
+		return nil, stopErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover minio instances: %w", err)
+	}
+	return instances, nil
+}
+
 func printCredits() {
 	println(`
    /$$
@@ -2,24 +2,154 @@ package api
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/irensaltali/object-storage-gateway/internal/discovery"
 	"github.com/irensaltali/object-storage-gateway/internal/handlers"
+	"github.com/irensaltali/object-storage-gateway/internal/ratelimit"
 	"github.com/irensaltali/object-storage-gateway/internal/storage"
 )
 
-func NewRouter(gateway *storage.Gateway) *mux.Router {
-	router := mux.NewRouter()
+type routerConfig struct {
+	rateLimits *ratelimit.Config
+	apiKeys    ratelimit.APIKeys
+	usage      bool
+	exclusions discovery.ExclusionReporter
+}
+
+// RouterOption configures router construction.
+type RouterOption func(*routerConfig)
+
+// WithRateLimits limits request rates and bandwidth per client. Health and
+// readiness checks are exempt unless cfg names them.
+func WithRateLimits(cfg ratelimit.Config) RouterOption {
+	return func(rc *routerConfig) {
+		rc.rateLimits = &cfg
+	}
+}
+
+// WithAPIKeys identifies clients presenting one of keys by client name, for
+// rate limits and as the tenant their uploads are charged to.
+func WithAPIKeys(keys ratelimit.APIKeys) RouterOption {
+	return func(rc *routerConfig) {
+		rc.apiKeys = keys
+	}
+}
+
+// WithUsage serves the gateway's storage usage on /admin/usage. Like every
+// admin route it is only mounted together with WithAPIKeys.
+func WithUsage() RouterOption {
+	return func(rc *routerConfig) {
+		rc.usage = true
+	}
+}
+
+// WithExclusions serves the instances discovery left out, and why, on
+// /admin/discovery. Like every admin route it is only mounted together with
+// WithAPIKeys.
+func WithExclusions(reporter discovery.ExclusionReporter) RouterOption {
+	return func(rc *routerConfig) {
+		rc.exclusions = reporter
+	}
+}
+
+func NewRouter(gateway *storage.Gateway, opts ...RouterOption) *mux.Router {
+	var cfg routerConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
 
-	// Object storage endpoints
-	router.HandleFunc("/object/{id}", func(w http.ResponseWriter, r *http.Request) {
-		handlers.PutObject(w, r, gateway)
+	// Object keys may span several path segments and contain escaped
+	// characters, so routes match the raw path and handlers decode the
+	// variables. Cleaning would silently rewrite keys such as a//b.
+	router := mux.NewRouter().UseEncodedPath().SkipClean(true)
+
+	if cfg.rateLimits != nil {
+		limits := *cfg.rateLimits
+		routes := make(map[string]ratelimit.Limit, len(limits.Routes)+2)
+		routes["GET /health"] = ratelimit.Limit{}
+		routes["GET /ready"] = ratelimit.Limit{}
+		for route, limit := range limits.Routes {
+			routes[route] = limit
+		}
+		limits.Routes = routes
+		router.Use(ratelimit.New(limits, ratelimit.WithAPIKeys(cfg.apiKeys)).Middleware)
+	}
+	if cfg.apiKeys != nil {
+		router.Use(identifyTenants(cfg.apiKeys))
+	}
+
+	// Object storage endpoints; /object/{id} addresses the default bucket
+	for _, path := range []string{"/object/{id:.+}", "/buckets/{bucket}/objects/{id:.+}"} {
+		router.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			handlers.PutObject(w, r, gateway)
+		}).Methods("PUT")
+		router.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			handlers.GetObject(w, r, gateway)
+		}).Methods("GET")
+		router.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			handlers.HeadObject(w, r, gateway)
+		}).Methods("HEAD")
+		router.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			handlers.DeleteObject(w, r, gateway)
+		}).Methods("DELETE")
+	}
+
+	// Bucket management endpoints
+	router.HandleFunc("/buckets", func(w http.ResponseWriter, r *http.Request) {
+		handlers.ListBuckets(w, r, gateway)
+	}).Methods("GET")
+	router.HandleFunc("/buckets/{bucket}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.CreateBucket(w, r, gateway)
 	}).Methods("PUT")
-	router.HandleFunc("/object/{id}", func(w http.ResponseWriter, r *http.Request) {
-		handlers.GetObject(w, r, gateway)
+	router.HandleFunc("/buckets/{bucket}", func(w http.ResponseWriter, r *http.Request) {
+		handlers.DeleteBucket(w, r, gateway)
+	}).Methods("DELETE")
+
+	// Object cache metrics endpoint
+	router.HandleFunc("/metrics/cache", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(gateway.CacheStats())
 	}).Methods("GET")
 
+	// Admin endpoints are only served to clients presenting a listed API key
+	var admin *mux.Router
+	if cfg.usage || cfg.exclusions != nil {
+		if cfg.apiKeys == nil {
+			log.Printf("admin endpoints disabled: no API keys configured")
+		} else {
+			admin = router.PathPrefix("/admin").Subrouter()
+			admin.Use(requireAPIKey(cfg.apiKeys))
+		}
+	}
+
+	// Storage usage endpoint
+	if admin != nil && cfg.usage {
+		admin.HandleFunc("/usage", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(gateway.Usage())
+		}).Methods("GET")
+	}
+
+	// Discovery exclusions endpoint
+	if admin != nil && cfg.exclusions != nil {
+		admin.HandleFunc("/discovery", func(w http.ResponseWriter, r *http.Request) {
+			excluded := cfg.exclusions.Excluded()
+			if excluded == nil {
+				excluded = []discovery.ExcludedInstance{}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]any{
+				"excluded": excluded,
+			})
+		}).Methods("GET")
+	}
+
 	// Health check endpoint
 	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -40,3 +170,56 @@ func NewRouter(gateway *storage.Gateway) *mux.Router {
 
 	return router
 }
+
+// identifyTenants charges the uploads of clients presenting a listed API key
+// to their client name, never to the key itself.
+func identifyTenants(keys ratelimit.APIKeys) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if name, ok := keys.Client(r); ok {
+				r = r.WithContext(handlers.WithTenant(r.Context(), name))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireAPIKey rejects requests that do not present a listed API key.
+func requireAPIKey(keys ratelimit.APIKeys) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := keys.Client(r); !ok {
+				http.Error(w, "a listed API key is required", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// NewStartingRouter serves while the gateway waits for its storage nodes:
+// /health reports healthy, /ready reports not ready and every other request
+// is answered with 503 Service Unavailable.
+func NewStartingRouter() *mux.Router {
+	router := mux.NewRouter()
+
+	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{
+			"status": "healthy",
+		})
+	}).Methods("GET")
+
+	router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{
+			"status": "not ready",
+			"reason": "waiting for minio instances",
+		})
+	})
+
+	return router
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/irensaltali/object-storage-gateway/internal/discovery"
+	"github.com/irensaltali/object-storage-gateway/internal/ratelimit"
+	"github.com/irensaltali/object-storage-gateway/internal/storage"
+)
+
+type staticExclusions []discovery.ExcludedInstance
+
+func (s staticExclusions) Excluded() []discovery.ExcludedInstance { return s }
+
+func TestRouterAdminRoutes(t *testing.T) {
+	gateway, err := storage.NewGateway([]discovery.MinioInstance{
+		{ID: "instance-1", Host: "localhost", Port: "9000", AccessKey: "minioadmin", SecretKey: "minioadmin"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create gateway: %v", err)
+	}
+	t.Cleanup(func() { _ = gateway.Close() })
+
+	keys := ratelimit.APIKeys{"secret": "ops"}
+	admin := []RouterOption{WithUsage(), WithExclusions(staticExclusions{})}
+
+	tests := []struct {
+		name   string
+		opts   []RouterOption
+		path   string
+		apiKey string
+		want   int
+	}{
+		{name: "usage with key", opts: append(admin, WithAPIKeys(keys)), path: "/admin/usage", apiKey: "secret", want: http.StatusOK},
+		{name: "discovery with key", opts: append(admin, WithAPIKeys(keys)), path: "/admin/discovery", apiKey: "secret", want: http.StatusOK},
+		{name: "usage without key", opts: append(admin, WithAPIKeys(keys)), path: "/admin/usage", want: http.StatusUnauthorized},
+		{name: "discovery with unknown key", opts: append(admin, WithAPIKeys(keys)), path: "/admin/discovery", apiKey: "guess", want: http.StatusUnauthorized},
+		{name: "no API keys configured", opts: admin, path: "/admin/usage", want: http.StatusNotFound},
+		{name: "usage not configured", opts: []RouterOption{WithAPIKeys(keys)}, path: "/admin/usage", apiKey: "secret", want: http.StatusNotFound},
+		{name: "exclusions not configured", opts: []RouterOption{WithUsage(), WithAPIKeys(keys)}, path: "/admin/discovery", apiKey: "secret", want: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.apiKey != "" {
+				req.Header.Set(ratelimit.APIKeyHeader, tt.apiKey)
+			}
+			rr := httptest.NewRecorder()
+			NewRouter(gateway, tt.opts...).ServeHTTP(rr, req)
+
+			if rr.Code != tt.want {
+				t.Fatalf("GET %s returned %d, want %d", tt.path, rr.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	defaultSRVService = "minio"
+	defaultSRVProto   = "tcp"
+)
+
+// Credentials are the keys used to access a Minio instance.
+type Credentials struct {
+	AccessKey string `json:"accessKey" yaml:"accessKey"`
+	SecretKey string `json:"secretKey" yaml:"secretKey"`
+}
+
+// secretsFile holds the credentials of discovered instances. Hosts overrides
+// the default keys per SRV target or address for DNS, and per container
+// name for Docker.
+type secretsFile struct {
+	Credentials `yaml:",inline"`
+	Hosts       map[string]Credentials `json:"hosts" yaml:"hosts"`
+}
+
+func (s secretsFile) forHost(host string) (Credentials, bool) {
+	creds, ok := s.Hosts[host]
+	if !ok {
+		creds = s.Credentials
+	}
+	return creds, creds.AccessKey != "" && creds.SecretKey != ""
+}
+
+type dnsResolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+type dnsConfig struct {
+	service string
+	proto   string
+	port    string
+	server  string
+}
+
+// DNSOption configures DNS discovery.
+type DNSOption func(*dnsConfig)
+
+// WithSRVService sets the service and protocol of the SRV query, which is
+// sent as _service._proto.name. An empty service queries name directly.
+func WithSRVService(service, proto string) DNSOption {
+	return func(cfg *dnsConfig) {
+		cfg.service = service
+		cfg.proto = proto
+	}
+}
+
+// WithDNSPort sets the port of instances found through A and AAAA records,
+// which carry no port of their own.
+func WithDNSPort(port string) DNSOption {
+	return func(cfg *dnsConfig) {
+		cfg.port = port
+	}
+}
+
+// WithDNSServer queries the DNS server at addr, given as host:port, instead
+// of the system resolver.
+func WithDNSServer(addr string) DNSOption {
+	return func(cfg *dnsConfig) {
+		cfg.server = addr
+	}
+}
+
+// DNSProvider finds Minio instances through SRV records of a service name,
+// falling back to its A and AAAA records when it has no SRV records.
+// Credentials come from a YAML or JSON secrets file:
+//
+//	accessKey: gateway
+//	secretKey: secret
+//	hosts:
+//	  minio-3.storage.internal:
+//	    accessKey: other
+//	    secretKey: other-secret
+type DNSProvider struct {
+	name        string
+	secretsPath string
+	cfg         dnsConfig
+	resolver    dnsResolver
+}
+
+// NewDNSProvider returns a provider resolving name with the credentials in
+// the secrets file at secretsPath.
+func NewDNSProvider(name, secretsPath string, opts ...DNSOption) *DNSProvider {
+	cfg := dnsConfig{
+		service: defaultSRVService,
+		proto:   defaultSRVProto,
+		port:    DefaultAPIPort,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	resolver := net.DefaultResolver
+	if cfg.server != "" {
+		server := cfg.server
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	return &DNSProvider{
+		name:        name,
+		secretsPath: secretsPath,
+		cfg:         cfg,
+		resolver:    resolver,
+	}
+}
+
+// Discover resolves the service name. The secrets file is read on every call
+// so rotated credentials are picked up.
+func (p *DNSProvider) Discover(ctx context.Context) ([]MinioInstance, error) {
+	secrets, err := loadSecretsFile(p.secretsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints, err := p.lookup(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	instances := make([]MinioInstance, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		creds, ok := secrets.forHost(endpoint.host)
+		if !ok {
+			return nil, fmt.Errorf("missing minio credentials for %s", endpoint.host)
+		}
+		instances = append(instances, MinioInstance{
+			ID:        net.JoinHostPort(endpoint.host, endpoint.port),
+			Host:      endpoint.host,
+			Port:      endpoint.port,
+			AccessKey: creds.AccessKey,
+			SecretKey: creds.SecretKey,
+		})
+	}
+
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].ID < instances[j].ID
+	})
+	return instances, nil
+}
+
+type dnsEndpoint struct {
+	host string
+	port string
+}
+
+// lookup returns the endpoints of every SRV record regardless of priority,
+// since each instance holds its own share of the objects.
+func (p *DNSProvider) lookup(ctx context.Context) ([]dnsEndpoint, error) {
+	seen := make(map[dnsEndpoint]bool)
+	var endpoints []dnsEndpoint
+	add := func(endpoint dnsEndpoint) {
+		if !seen[endpoint] {
+			seen[endpoint] = true
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+
+	_, records, err := p.resolver.LookupSRV(ctx, p.cfg.service, p.cfg.proto, p.name)
+	var dnsErr *net.DNSError
+	if err != nil && !(errors.As(err, &dnsErr) && dnsErr.IsNotFound) {
+		return nil, fmt.Errorf("srv lookup of %s failed: %w", p.name, err)
+	}
+	for _, record := range records {
+		add(dnsEndpoint{
+			host: strings.TrimSuffix(record.Target, "."),
+			port: strconv.Itoa(int(record.Port)),
+		})
+	}
+	if len(endpoints) > 0 {
+		return endpoints, nil
+	}
+
+	addrs, err := p.resolver.LookupIPAddr(ctx, p.name)
+	if err != nil && !(errors.As(err, &dnsErr) && dnsErr.IsNotFound) {
+		return nil, fmt.Errorf("address lookup of %s failed: %w", p.name, err)
+	}
+	for _, addr := range addrs {
+		add(dnsEndpoint{host: addr.IP.String(), port: p.cfg.port})
+	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no minio instances found")
+	}
+
+	return endpoints, nil
+}
+
+func loadSecretsFile(path string) (secretsFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return secretsFile{}, fmt.Errorf("failed to open secrets file: %w", err)
+	}
+	defer file.Close()
+
+	var secrets secretsFile
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&secrets); err != nil && !errors.Is(err, io.EOF) {
+		return secretsFile{}, fmt.Errorf("failed to parse secrets file: %w", err)
+	}
+
+	return secrets, nil
+}
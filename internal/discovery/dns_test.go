@@ -0,0 +1,127 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type fakeResolver struct {
+	srv     []*net.SRV
+	srvErr  error
+	addrs   []net.IPAddr
+	addrErr error
+
+	srvQuery string
+}
+
+func (f *fakeResolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	f.srvQuery = "_" + service + "._" + proto + "." + name
+	return f.srvQuery, f.srv, f.srvErr
+}
+
+func (f *fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return f.addrs, f.addrErr
+}
+
+func writeSecrets(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "secrets.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write secrets file: %v", err)
+	}
+	return path
+}
+
+func TestDNSProviderDiscover(t *testing.T) {
+	notFound := &net.DNSError{Err: "no such host", Name: "minio.internal", IsNotFound: true}
+	secrets := "accessKey: ring\nsecretKey: treepotato\nhosts:\n  minio-2.internal:\n    accessKey: maglev\n    secretKey: baconpapaya\n"
+
+	tests := []struct {
+		name     string
+		resolver *fakeResolver
+		want     []MinioInstance
+		wantErr  string
+	}{
+		{
+			name: "srv records",
+			resolver: &fakeResolver{srv: []*net.SRV{
+				{Target: "minio-2.internal.", Port: 9000},
+				{Target: "minio-1.internal.", Port: 9000},
+				{Target: "minio-1.internal.", Port: 9000},
+			}},
+			want: []MinioInstance{
+				{ID: "minio-1.internal:9000", Host: "minio-1.internal", Port: "9000", AccessKey: "ring", SecretKey: "treepotato"},
+				{ID: "minio-2.internal:9000", Host: "minio-2.internal", Port: "9000", AccessKey: "maglev", SecretKey: "baconpapaya"},
+			},
+		},
+		{
+			name: "address fallback",
+			resolver: &fakeResolver{
+				srvErr: notFound,
+				addrs:  []net.IPAddr{{IP: net.ParseIP("10.0.0.5")}, {IP: net.ParseIP("fd00::6")}},
+			},
+			want: []MinioInstance{
+				{ID: "10.0.0.5:9000", Host: "10.0.0.5", Port: "9000", AccessKey: "ring", SecretKey: "treepotato"},
+				{ID: "[fd00::6]:9000", Host: "fd00::6", Port: "9000", AccessKey: "ring", SecretKey: "treepotato"},
+			},
+		},
+		{
+			name:     "srv failure",
+			resolver: &fakeResolver{srvErr: errors.New("server misbehaving")},
+			wantErr:  "srv lookup of minio.internal failed",
+		},
+		{
+			name:     "nothing found",
+			resolver: &fakeResolver{srvErr: notFound, addrErr: notFound},
+			wantErr:  "no minio instances found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := NewDNSProvider("minio.internal", writeSecrets(t, secrets))
+			provider.resolver = tt.resolver
+
+			got, err := provider.Discover(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Discover() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Discover() unexpected error: %v", err)
+			}
+			if tt.resolver.srvQuery != "_minio._tcp.minio.internal" {
+				t.Fatalf("SRV query = %s, want _minio._tcp.minio.internal", tt.resolver.srvQuery)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Discover() returned %d instances, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("instance %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDNSProviderMissingCredentials(t *testing.T) {
+	provider := NewDNSProvider("minio.internal", writeSecrets(t, "hosts:\n  minio-1.internal:\n    accessKey: ring\n    secretKey: treepotato\n"))
+	provider.resolver = &fakeResolver{srv: []*net.SRV{
+		{Target: "minio-1.internal.", Port: 9000},
+		{Target: "minio-2.internal.", Port: 9000},
+	}}
+
+	_, err := provider.Discover(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "missing minio credentials for minio-2.internal") {
+		t.Fatalf("Discover() error = %v, want missing credentials", err)
+	}
+}
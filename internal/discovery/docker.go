@@ -1,42 +1,266 @@
 package discovery
 
 import (
+	"archive/tar"
+	"bytes"
+	"cmp"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"maps"
 	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"path"
+	"path/filepath"
 	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 const (
-	minioContainerNamePattern = "amazin-object-storage-node"
-	minioAPIPort              = "9000"
-	dockerSocketPath          = "/var/run/docker.sock"
-	dockerAPIVersion          = "v1.41"
+	// DefaultContainerNamePattern matches the Minio containers of the compose setup.
+	DefaultContainerNamePattern = "amazin-object-storage-node"
+	// DefaultAPIPort is the port Minio serves its S3 API on.
+	DefaultAPIPort = "9000"
+	// DefaultDockerSocket is where the Docker daemon listens by default.
+	DefaultDockerSocket = "/var/run/docker.sock"
+	// NetworkAuto selects the network shared with the gateway's own
+	// container.
+	NetworkAuto = "auto"
+	// ComposeProjectAuto selects the compose project of the gateway's own
+	// container.
+	ComposeProjectAuto = "auto"
+
+	composeProjectLabel = "com.docker.compose.project"
+
+	// maxDockerAPIVersion is the newest API version requested; older
+	// daemons are spoken to in their own version.
+	maxDockerAPIVersion = "1.43"
+
+	// containerSecretsDir is where Minio looks up relative *_FILE names.
+	containerSecretsDir = "/run/secrets"
+	// maxSecretFileSize bounds credential files read from containers.
+	maxSecretFileSize = 64 << 10
+)
+
+// Container labels that override the discovery settings of one container.
+const (
+	// LabelPort sets the port of the Minio S3 API.
+	LabelPort = "gateway.port"
+	// LabelWeight sets the placement weight of the instance.
+	LabelWeight = "gateway.weight"
+	// LabelZone names the zone the instance runs in.
+	LabelZone = "gateway.zone"
+	// LabelTLS set to true connects to the instance over TLS.
+	LabelTLS = "gateway.tls"
 )
 
-// MinioInstance represents a discovered Minio instance.
-type MinioInstance struct {
-	ID        string
-	Host      string
-	Port      string
-	AccessKey string
-	SecretKey string
+type dockerConfig struct {
+	namePattern     string
+	labels          []string
+	apiPort         string
+	dockerHost      string
+	dockerSocket    string
+	tlsVerify       bool
+	certPath        string
+	secretsDir      string
+	credentialsFile string
+	quarantine      time.Duration
+	network         string
+	publishedPorts  bool
+	publishedHost   string
+	composeProject  string
+	// hostname returns the gateway's own container ID when it runs in one.
+	hostname func() (string, error)
+}
+
+// DockerOption configures Docker discovery.
+type DockerOption func(*dockerConfig)
+
+// WithContainerNamePattern selects containers whose name contains pattern.
+func WithContainerNamePattern(pattern string) DockerOption {
+	return func(cfg *dockerConfig) {
+		cfg.namePattern = pattern
+	}
+}
+
+// WithLabelSelectors selects containers carrying all of the labels, each
+// given as "key" or "key=value". Without a name pattern, label selectors
+// replace the default container name pattern.
+func WithLabelSelectors(labels ...string) DockerOption {
+	return func(cfg *dockerConfig) {
+		cfg.labels = append(cfg.labels, labels...)
+	}
+}
+
+// WithAPIPort sets the port the discovered Minio instances listen on.
+func WithAPIPort(port string) DockerOption {
+	return func(cfg *dockerConfig) {
+		cfg.apiPort = port
+	}
+}
+
+// WithDockerSocket sets the path of the Docker daemon socket, such as
+// Podman's /run/podman/podman.sock.
+func WithDockerSocket(path string) DockerOption {
+	return func(cfg *dockerConfig) {
+		cfg.dockerSocket = path
+	}
+}
+
+// WithDockerHost sets the daemon address in the form of DOCKER_HOST:
+// unix:///path/to/socket or tcp://host:port. It takes precedence over
+// WithDockerSocket.
+func WithDockerHost(host string) DockerOption {
+	return func(cfg *dockerConfig) {
+		cfg.dockerHost = host
+	}
+}
+
+// WithDockerTLS connects to a tcp:// daemon over TLS with the ca.pem,
+// cert.pem and key.pem found in certPath, as DOCKER_CERT_PATH does. verify
+// checks the daemon certificate against ca.pem, as DOCKER_TLS_VERIFY does;
+// without certPath the files are then read from $DOCKER_CONFIG or ~/.docker
+// like the docker CLI.
+func WithDockerTLS(certPath string, verify bool) DockerOption {
+	return func(cfg *dockerConfig) {
+		cfg.certPath = certPath
+		cfg.tlsVerify = verify
+	}
+}
+
+// WithSecretsDir reads the files named by *_FILE credential variables from
+// dir, a host directory holding the container's /run/secrets, instead of
+// copying them out of the container.
+func WithSecretsDir(dir string) DockerOption {
+	return func(cfg *dockerConfig) {
+		cfg.secretsDir = dir
+	}
+}
+
+// WithCredentialsFile reads credentials from a YAML or JSON file in the
+// format of the DNS provider's secrets file, with hosts keyed by container
+// name. A container listed there does not need credentials in its
+// environment; the top-level keys are used for containers without any.
+func WithCredentialsFile(path string) DockerOption {
+	return func(cfg *dockerConfig) {
+		cfg.credentialsFile = path
+	}
+}
+
+// WithQuarantine keeps a container that was excluded for its state out until
+// d after the last refresh that excluded it, so a flapping container does
+// not keep joining and leaving.
+func WithQuarantine(d time.Duration) DockerOption {
+	return func(cfg *dockerConfig) {
+		cfg.quarantine = d
+	}
+}
+
+// WithNetwork connects to containers through their address on the named
+// network, or on a network shared with the gateway's own container when
+// name is NetworkAuto. By default the first network by name with an address
+// is used.
+func WithNetwork(name string) DockerOption {
+	return func(cfg *dockerConfig) {
+		cfg.network = name
+	}
+}
+
+// WithPublishedPorts connects to the host ports the containers publish for
+// the API port, for a gateway running outside Docker. Ports published on all
+// interfaces are reached through host; when host is empty that is the
+// address of a tcp:// daemon, or 127.0.0.1.
+func WithPublishedPorts(host string) DockerOption {
+	return func(cfg *dockerConfig) {
+		cfg.publishedPorts = true
+		cfg.publishedHost = host
+	}
+}
+
+// WithComposeProject only selects containers of the named compose project,
+// or of the gateway's own project when name is ComposeProjectAuto, so
+// stacks sharing a Docker daemon do not pick up each other's nodes.
+func WithComposeProject(name string) DockerOption {
+	return func(cfg *dockerConfig) {
+		cfg.composeProject = name
+	}
+}
+
+func newDockerConfig(opts []DockerOption) dockerConfig {
+	cfg := dockerConfig{
+		apiPort:  DefaultAPIPort,
+		hostname: os.Hostname,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// podmanSockets are tried when the Docker socket does not exist.
+func podmanSockets() []string {
+	sockets := []string{"/run/podman/podman.sock"}
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		sockets = append(sockets, filepath.Join(runtimeDir, "podman", "podman.sock"))
+	}
+	return sockets
+}
+
+// defaultDockerHost returns the Docker socket, or a Podman socket when only
+// that exists.
+func defaultDockerHost() string {
+	if _, err := os.Stat(DefaultDockerSocket); err != nil {
+		for _, socket := range podmanSockets() {
+			if _, err := os.Stat(socket); err == nil {
+				return "unix://" + socket
+			}
+		}
+	}
+	return "unix://" + DefaultDockerSocket
+}
+
+// filters returns the Docker list filters selecting the Minio containers of
+// project, or of any project when it is empty.
+func (cfg dockerConfig) filters(project string) map[string][]string {
+	filters := make(map[string][]string)
+	if len(cfg.labels) > 0 {
+		filters["label"] = cfg.labels
+	}
+	if project != "" {
+		filters["label"] = append(slices.Clip(filters["label"]), composeProjectLabel+"="+project)
+	}
+	switch {
+	case cfg.namePattern != "":
+		filters["name"] = []string{cfg.namePattern}
+	case len(cfg.labels) == 0:
+		filters["name"] = []string{DefaultContainerNamePattern}
+	}
+	return filters
 }
 
 type dockerClient interface {
-	ListContainers(ctx context.Context, nameFilter string) ([]dockerContainerSummary, error)
+	ListContainers(ctx context.Context, filters map[string][]string) ([]dockerContainerSummary, error)
 	InspectContainer(ctx context.Context, containerID string) (dockerContainerInspect, error)
+	ReadFile(ctx context.Context, containerID, path string) ([]byte, error)
 }
 
 type dockerEngineClient struct {
 	httpClient *http.Client
+	baseURL    string
+
+	mu         sync.Mutex
+	apiVersion string
 }
 
 type dockerContainerSummary struct {
@@ -45,29 +269,279 @@ type dockerContainerSummary struct {
 }
 
 type dockerContainerInspect struct {
+	State  dockerContainerState `json:"State"`
 	Config struct {
-		Env []string `json:"Env"`
+		Env    []string          `json:"Env"`
+		Labels map[string]string `json:"Labels"`
 	} `json:"Config"`
 	NetworkSettings struct {
 		Networks map[string]struct {
 			IPAddress string `json:"IPAddress"`
 		} `json:"Networks"`
+		Ports map[string][]dockerPortBinding `json:"Ports"`
 	} `json:"NetworkSettings"`
 }
 
-// DiscoverInstances finds all Minio instances in the Docker daemon.
-func DiscoverInstances(ctx context.Context) ([]MinioInstance, error) {
-	engineClient := newDockerEngineClient()
-	return discoverInstances(ctx, engineClient)
+type dockerPortBinding struct {
+	HostIP   string `json:"HostIp"`
+	HostPort string `json:"HostPort"`
 }
 
-func discoverInstances(ctx context.Context, dockerClient dockerClient) ([]MinioInstance, error) {
-	containers, err := dockerClient.ListContainers(ctx, minioContainerNamePattern)
+// addressMode selects the address of a container the gateway connects to.
+type addressMode struct {
+	// networks limits the container networks used; nil allows any.
+	networks map[string]bool
+	// publishedHost, when set, selects published host ports instead of
+	// network addresses, reached through publishedHost unless the port is
+	// bound to one address.
+	publishedHost string
+}
+
+// inspectGatewayContainer inspects the container the gateway runs in, found
+// through the hostname Docker gives it.
+func inspectGatewayContainer(ctx context.Context, dockerClient dockerClient, cfg dockerConfig) (dockerContainerInspect, error) {
+	self, err := cfg.hostname()
+	if err != nil {
+		return dockerContainerInspect{}, fmt.Errorf("failed to get hostname: %w", err)
+	}
+	inspectData, err := dockerClient.InspectContainer(ctx, self)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list containers: %w", err)
+		return dockerContainerInspect{}, fmt.Errorf("failed to find the gateway container %s: %w", self, err)
+	}
+	return inspectData, nil
+}
+
+// resolveComposeProject returns the compose project to scope discovery to,
+// taken from the gateway container self for ComposeProjectAuto.
+func resolveComposeProject(cfg dockerConfig, self dockerContainerInspect) (string, error) {
+	if cfg.composeProject != ComposeProjectAuto {
+		return cfg.composeProject, nil
+	}
+	project := self.Config.Labels[composeProjectLabel]
+	if project == "" {
+		return "", fmt.Errorf("gateway container has no %s label", composeProjectLabel)
+	}
+	return project, nil
+}
+
+// resolveAddressMode turns the network settings into an addressMode, using
+// the networks of the gateway container self for NetworkAuto.
+func resolveAddressMode(cfg dockerConfig, self dockerContainerInspect) addressMode {
+	switch {
+	case cfg.publishedPorts:
+		host := cfg.publishedHost
+		if host == "" {
+			host = "127.0.0.1"
+			if address, ok := strings.CutPrefix(cfg.dockerHost, "tcp://"); ok {
+				if h, _, err := net.SplitHostPort(address); err == nil {
+					host = h
+				} else {
+					host = address
+				}
+			}
+		}
+		return addressMode{publishedHost: host}
+	case cfg.network == NetworkAuto:
+		networks := make(map[string]bool, len(self.NetworkSettings.Networks))
+		for name := range self.NetworkSettings.Networks {
+			networks[name] = true
+		}
+		return addressMode{networks: networks}
+	case cfg.network != "":
+		return addressMode{networks: map[string]bool{cfg.network: true}}
+	default:
+		return addressMode{}
+	}
+}
+
+type dockerContainerState struct {
+	Status string        `json:"Status"`
+	Health *dockerHealth `json:"Health"`
+}
+
+type dockerHealth struct {
+	Status string `json:"Status"`
+}
+
+// unfitReason returns why a container in state must not receive objects, or
+// "" if it may. Containers without a health check only need to be running.
+func unfitReason(state dockerContainerState) string {
+	if state.Status != "running" {
+		return fmt.Sprintf("container is %s", cmp.Or(state.Status, "in an unknown state"))
+	}
+	if state.Health != nil {
+		switch state.Health.Status {
+		case "", "none", "healthy":
+		default:
+			return fmt.Sprintf("health check is %s", state.Health.Status)
+		}
+	}
+	return ""
+}
+
+// DockerProvider finds Minio instances among the containers of the local
+// Docker daemon. Containers that are not running, whose health check does not
+// pass or that cannot be used as configured are left out and reported by
+// Excluded.
+type DockerProvider struct {
+	cfg    dockerConfig
+	client dockerClient
+	now    func() time.Time
+
+	mu          sync.Mutex
+	excluded    []ExcludedInstance
+	quarantined map[string]quarantinedContainer
+}
+
+// quarantinedContainer records when an excluded container may rejoin.
+type quarantinedContainer struct {
+	name  string
+	until time.Time
+}
+
+// NewDockerProvider returns a provider talking to the Docker daemon, by
+// default through its local socket or, failing that, Podman's.
+func NewDockerProvider(opts ...DockerOption) (*DockerProvider, error) {
+	cfg := newDockerConfig(opts)
+	client, err := newDockerEngineClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &DockerProvider{
+		cfg:         cfg,
+		client:      client,
+		now:         time.Now,
+		quarantined: make(map[string]quarantinedContainer),
+	}, nil
+}
+
+// Discover finds all running and healthy Minio containers matching the name
+// pattern and label selectors. Containers that cannot be used, for example
+// for a bad label or missing credentials, are excluded with the error as the
+// reason; Discover only fails when no container is left.
+func (p *DockerProvider) Discover(ctx context.Context) ([]MinioInstance, error) {
+	instances, excluded, invalid, err := discoverInstances(ctx, p.client, p.cfg)
+	if excluded == nil && invalid == nil && err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Only containers excluded for their state are quarantined; a container
+	// that cannot be used as configured rejoins as soon as it is fixed.
+	if p.cfg.quarantine > 0 {
+		instances, excluded = p.applyQuarantine(instances, excluded)
+	}
+	if len(invalid) > 0 {
+		excluded = append(excluded, invalid...)
+		sort.Slice(excluded, func(i, j int) bool { return excluded[i].Name < excluded[j].Name })
+	}
+	if err == nil && len(instances) == 0 {
+		err = fmt.Errorf("no minio instances found: %d excluded", len(excluded))
+	}
+	logExclusionChanges(p.excluded, excluded)
+	p.excluded = excluded
+
+	if err != nil {
+		return nil, err
+	}
+	return instances, nil
+}
+
+// Excluded returns the containers left out by the last Discover call.
+func (p *DockerProvider) Excluded() []ExcludedInstance {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]ExcludedInstance(nil), p.excluded...)
+}
+
+// applyQuarantine restarts the quarantine of excluded containers and moves
+// instances still in quarantine to the excluded list. The caller holds p.mu.
+func (p *DockerProvider) applyQuarantine(instances []MinioInstance, excluded []ExcludedInstance) ([]MinioInstance, []ExcludedInstance) {
+	now := p.now()
+	for _, candidate := range excluded {
+		p.quarantined[candidate.ID] = quarantinedContainer{name: candidate.Name, until: now.Add(p.cfg.quarantine)}
+	}
+
+	var admitted []MinioInstance
+	for _, instance := range instances {
+		if q, ok := p.quarantined[instance.ID]; ok && now.Before(q.until) {
+			excluded = append(excluded, ExcludedInstance{
+				ID:     instance.ID,
+				Name:   q.name,
+				Reason: fmt.Sprintf("quarantined until %s", q.until.Format(time.RFC3339)),
+			})
+			continue
+		}
+		admitted = append(admitted, instance)
+	}
+
+	for id, q := range p.quarantined {
+		if !now.Before(q.until) {
+			delete(p.quarantined, id)
+		}
+	}
+
+	sort.Slice(excluded, func(i, j int) bool { return excluded[i].Name < excluded[j].Name })
+	return admitted, excluded
+}
+
+// logExclusionChanges logs containers that were excluded, for a new reason,
+// or readmitted since the previous call, so unchanged exclusions are not
+// logged on every refresh.
+func logExclusionChanges(previous, current []ExcludedInstance) {
+	reasons := make(map[string]string, len(previous))
+	for _, candidate := range previous {
+		reasons[candidate.ID] = candidate.Reason
+	}
+	for _, candidate := range current {
+		if reason, ok := reasons[candidate.ID]; !ok || reason != candidate.Reason {
+			log.Printf("excluding minio container %s (%s): %s", candidate.Name, candidate.ID, candidate.Reason)
+		}
+		delete(reasons, candidate.ID)
+	}
+	for id := range reasons {
+		log.Printf("minio container %s is no longer excluded", id)
+	}
+}
+
+// discoverInstances returns the instances of the matching containers that are
+// fit to serve, the ones left out for their state and the ones that cannot be
+// used as configured, such as a container with a bad label, no address or no
+// credentials. When every container is left out it returns both the
+// exclusions and an error.
+func discoverInstances(ctx context.Context, dockerClient dockerClient, cfg dockerConfig) ([]MinioInstance, []ExcludedInstance, []ExcludedInstance, error) {
+	// The credentials file is read on every call so rotated credentials
+	// are picked up.
+	var secrets secretsFile
+	if cfg.credentialsFile != "" {
+		var err error
+		if secrets, err = loadSecretsFile(cfg.credentialsFile); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	var self dockerContainerInspect
+	if cfg.network == NetworkAuto || cfg.composeProject == ComposeProjectAuto {
+		var err error
+		if self, err = inspectGatewayContainer(ctx, dockerClient, cfg); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	project, err := resolveComposeProject(cfg, self)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	mode := resolveAddressMode(cfg, self)
+
+	containers, err := dockerClient.ListContainers(ctx, cfg.filters(project))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to list containers: %w", err)
 	}
 	if len(containers) == 0 {
-		return nil, fmt.Errorf("no minio instances found")
+		return nil, nil, nil, fmt.Errorf("no minio instances found")
 	}
 
 	sort.Slice(containers, func(i, j int) bool {
@@ -80,56 +554,251 @@ func discoverInstances(ctx context.Context, dockerClient dockerClient) ([]MinioI
 	})
 
 	instances := make([]MinioInstance, 0, len(containers))
+	excluded := make([]ExcludedInstance, 0)
+	var invalid []ExcludedInstance
+	var problems []error
+	exclude := func(listed dockerContainerSummary, err error) {
+		invalid = append(invalid, ExcludedInstance{
+			ID:     shortContainerID(listed.ID),
+			Name:   primaryContainerName(listed.Names),
+			Reason: err.Error(),
+		})
+		problems = append(problems, fmt.Errorf("container %s: %w", shortContainerID(listed.ID), err))
+	}
 	for _, listedContainer := range containers {
 		inspectData, err := dockerClient.InspectContainer(ctx, listedContainer.ID)
 		if err != nil {
-			return nil, fmt.Errorf("failed to inspect container %s: %w", shortContainerID(listedContainer.ID), err)
+			exclude(listedContainer, fmt.Errorf("failed to inspect container: %w", err))
+			continue
 		}
 
-		instance, err := extractInstanceInfo(listedContainer.ID, inspectData)
+		if reason := unfitReason(inspectData.State); reason != "" {
+			excluded = append(excluded, ExcludedInstance{
+				ID:     shortContainerID(listedContainer.ID),
+				Name:   primaryContainerName(listedContainer.Names),
+				Reason: reason,
+			})
+			continue
+		}
+
+		instance, err := extractInstanceInfo(listedContainer.ID, inspectData, cfg.apiPort, mode)
+		if err == nil {
+			err = resolveCredentials(ctx, dockerClient, cfg, secrets, listedContainer, inspectData.Config.Env, &instance)
+		}
 		if err != nil {
-			return nil, fmt.Errorf("invalid minio container %s: %w", shortContainerID(listedContainer.ID), err)
+			exclude(listedContainer, err)
+			continue
 		}
 
 		instances = append(instances, instance)
 	}
 
-	return instances, nil
+	if len(instances) == 0 {
+		err := fmt.Errorf("no minio instances found: %d excluded", len(excluded)+len(invalid))
+		return nil, excluded, invalid, errors.Join(append([]error{err}, problems...)...)
+	}
+	return instances, excluded, invalid, nil
 }
 
-// extractInstanceInfo extracts Minio connection details from Docker inspect data.
-func extractInstanceInfo(containerID string, inspectData dockerContainerInspect) (MinioInstance, error) {
+// extractInstanceInfo extracts Minio connection details from Docker inspect
+// data. The container labels override apiPort and set the weight, zone and
+// TLS of the instance, and mode selects its address. Credentials are taken
+// from the environment when it holds them in plain text; resolveCredentials
+// looks further.
+func extractInstanceInfo(containerID string, inspectData dockerContainerInspect, apiPort string, mode addressMode) (MinioInstance, error) {
 	instance := MinioInstance{
 		ID:   shortContainerID(containerID),
-		Port: minioAPIPort,
+		Port: apiPort,
+	}
+	if err := applyLabels(&instance, inspectData.Config.Labels); err != nil {
+		return MinioInstance{}, err
 	}
 
-	networkNames := make([]string, 0, len(inspectData.NetworkSettings.Networks))
-	for networkName := range inspectData.NetworkSettings.Networks {
-		networkNames = append(networkNames, networkName)
+	if mode.publishedHost != "" {
+		if err := usePublishedPort(&instance, inspectData.NetworkSettings.Ports, mode.publishedHost); err != nil {
+			return MinioInstance{}, err
+		}
+	} else {
+		networkNames := make([]string, 0, len(inspectData.NetworkSettings.Networks))
+		for networkName := range inspectData.NetworkSettings.Networks {
+			if mode.networks == nil || mode.networks[networkName] {
+				networkNames = append(networkNames, networkName)
+			}
+		}
+		sort.Strings(networkNames)
+
+		for _, networkName := range networkNames {
+			network := inspectData.NetworkSettings.Networks[networkName]
+			if strings.TrimSpace(network.IPAddress) != "" {
+				instance.Host = network.IPAddress
+				break
+			}
+		}
+
+		if instance.Host == "" && mode.networks != nil {
+			return MinioInstance{}, fmt.Errorf("no ip address found for container on networks %s", strings.Join(slices.Sorted(maps.Keys(mode.networks)), ", "))
+		}
+		if instance.Host == "" {
+			return MinioInstance{}, fmt.Errorf("no ip address found for container")
+		}
 	}
-	sort.Strings(networkNames)
 
-	for _, networkName := range networkNames {
-		network := inspectData.NetworkSettings.Networks[networkName]
-		if strings.TrimSpace(network.IPAddress) != "" {
-			instance.Host = network.IPAddress
-			break
+	instance.AccessKey, instance.SecretKey = extractCredentials(inspectData.Config.Env)
+	return instance, nil
+}
+
+// resolveCredentials fills in the credentials of instance. An entry for the
+// container in the credentials file comes first, then plain environment
+// variables, then the files named by *_FILE variables, and last the default
+// keys of the credentials file.
+func resolveCredentials(ctx context.Context, dockerClient dockerClient, cfg dockerConfig, secrets secretsFile, listed dockerContainerSummary, env []string, instance *MinioInstance) error {
+	if creds, ok := secrets.Hosts[primaryContainerName(listed.Names)]; ok {
+		if creds.AccessKey == "" || creds.SecretKey == "" {
+			return fmt.Errorf("incomplete credentials for container in credentials file")
 		}
+		instance.AccessKey, instance.SecretKey = creds.AccessKey, creds.SecretKey
+		return nil
 	}
 
-	if instance.Host == "" {
-		return MinioInstance{}, fmt.Errorf("no ip address found for container")
+	files := []struct {
+		target *string
+		vars   []string
+	}{
+		{&instance.AccessKey, []string{"MINIO_ACCESS_KEY_FILE", "MINIO_ROOT_USER_FILE"}},
+		{&instance.SecretKey, []string{"MINIO_SECRET_KEY_FILE", "MINIO_ROOT_PASSWORD_FILE"}},
+	}
+	for _, file := range files {
+		if *file.target != "" {
+			continue
+		}
+		for _, name := range file.vars {
+			if value := readEnvValue(env, name); value != "" {
+				secret, err := readSecretFile(ctx, dockerClient, cfg.secretsDir, listed.ID, value)
+				if err != nil {
+					return fmt.Errorf("failed to read %s: %w", name, err)
+				}
+				*file.target = secret
+				break
+			}
+		}
 	}
 
-	accessKey, secretKey := extractCredentials(inspectData.Config.Env)
-	if accessKey == "" || secretKey == "" {
-		return MinioInstance{}, fmt.Errorf("missing minio credentials in environment")
+	if instance.AccessKey == "" && instance.SecretKey == "" {
+		instance.AccessKey, instance.SecretKey = secrets.AccessKey, secrets.SecretKey
 	}
+	if instance.AccessKey == "" || instance.SecretKey == "" {
+		return fmt.Errorf("missing minio credentials in environment")
+	}
+	return nil
+}
 
-	instance.AccessKey = accessKey
-	instance.SecretKey = secretKey
-	return instance, nil
+// readSecretFile reads a file named by a *_FILE variable, either from
+// secretsDir or out of the container. Relative names are looked up in
+// /run/secrets as Minio does.
+func readSecretFile(ctx context.Context, dockerClient dockerClient, secretsDir, containerID, name string) (string, error) {
+	containerPath := path.Clean(name)
+	if !path.IsAbs(containerPath) {
+		containerPath = path.Join(containerSecretsDir, name)
+	}
+
+	var data []byte
+	var err error
+	if secretsDir != "" {
+		relative, inSecrets := strings.CutPrefix(containerPath, containerSecretsDir+"/")
+		if !inSecrets {
+			relative = path.Base(containerPath)
+		}
+		data, err = readHostSecretFile(secretsDir, relative)
+	} else {
+		data, err = dockerClient.ReadFile(ctx, containerID, containerPath)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	secret := strings.TrimSpace(string(data))
+	if secret == "" {
+		return "", fmt.Errorf("%s is empty", containerPath)
+	}
+	return secret, nil
+}
+
+// readHostSecretFile reads the slash-separated name inside dir. Names and
+// symlinks leading out of dir are rejected.
+func readHostSecretFile(dir, name string) ([]byte, error) {
+	if !filepath.IsLocal(filepath.FromSlash(name)) {
+		return nil, fmt.Errorf("%s is outside the secrets directory", name)
+	}
+
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+
+	file, err := root.Open(filepath.FromSlash(name))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxSecretFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxSecretFileSize {
+		return nil, fmt.Errorf("file is larger than %d bytes", maxSecretFileSize)
+	}
+	return data, nil
+}
+
+// usePublishedPort points instance at the host port published for its API
+// port, preferring an IPv4 binding.
+func usePublishedPort(instance *MinioInstance, ports map[string][]dockerPortBinding, defaultHost string) error {
+	bindings := ports[instance.Port+"/tcp"]
+	if len(bindings) == 0 {
+		return fmt.Errorf("port %s/tcp is not published", instance.Port)
+	}
+
+	binding := bindings[0]
+	for _, candidate := range bindings {
+		if ip := net.ParseIP(candidate.HostIP); ip == nil || ip.To4() != nil {
+			binding = candidate
+			break
+		}
+	}
+
+	instance.Host = defaultHost
+	if ip := net.ParseIP(binding.HostIP); ip != nil && !ip.IsUnspecified() {
+		instance.Host = binding.HostIP
+	}
+	instance.Port = binding.HostPort
+	return nil
+}
+
+func applyLabels(instance *MinioInstance, labels map[string]string) error {
+	if port, ok := labels[LabelPort]; ok {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("label %s: %q is not a valid port", LabelPort, port)
+		}
+		instance.Port = port
+	}
+	if weight, ok := labels[LabelWeight]; ok {
+		n, err := strconv.Atoi(weight)
+		if err != nil || n < 1 {
+			return fmt.Errorf("label %s: %q is not a positive integer", LabelWeight, weight)
+		}
+		instance.Weight = n
+	}
+	instance.Zone = labels[LabelZone]
+	if tls, ok := labels[LabelTLS]; ok {
+		secure, err := strconv.ParseBool(tls)
+		if err != nil {
+			return fmt.Errorf("label %s: %q is not a boolean", LabelTLS, tls)
+		}
+		instance.Secure = secure
+	}
+	return nil
 }
 
 func extractCredentials(envVars []string) (accessKey, secretKey string) {
@@ -182,32 +851,167 @@ func primaryContainerName(containerNames []string) string {
 	return strings.TrimPrefix(names[0], "/")
 }
 
-func newDockerEngineClient() *dockerEngineClient {
-	transport := &http.Transport{
-		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-			dialer := net.Dialer{Timeout: 5 * time.Second}
-			return dialer.DialContext(ctx, "unix", dockerSocketPath)
-		},
+func newDockerEngineClient(cfg dockerConfig) (*dockerEngineClient, error) {
+	host := cfg.dockerHost
+	switch {
+	case host != "":
+	case cfg.dockerSocket != "":
+		host = "unix://" + cfg.dockerSocket
+	default:
+		host = defaultDockerHost()
+	}
+	scheme, address, ok := strings.Cut(host, "://")
+	if !ok || address == "" {
+		return nil, fmt.Errorf("invalid docker host %q", host)
 	}
 
-	return &dockerEngineClient{
+	dialer := net.Dialer{Timeout: 5 * time.Second}
+	transport := &http.Transport{}
+	client := &dockerEngineClient{
 		httpClient: &http.Client{
 			Transport: transport,
 			Timeout:   10 * time.Second,
 		},
 	}
+
+	switch scheme {
+	case "unix":
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", address)
+		}
+		client.baseURL = "http://docker"
+	case "tcp":
+		useTLS := cfg.tlsVerify || cfg.certPath != ""
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			port := "2375"
+			if useTLS {
+				port = "2376"
+			}
+			address = net.JoinHostPort(address, port)
+		}
+		transport.DialContext = dialer.DialContext
+		client.baseURL = "http://" + address
+		if useTLS {
+			tlsConfig, err := dockerTLSConfig(cfg.certPath, cfg.tlsVerify)
+			if err != nil {
+				return nil, err
+			}
+			transport.TLSClientConfig = tlsConfig
+			client.baseURL = "https://" + address
+		}
+	default:
+		return nil, fmt.Errorf("unsupported docker host %q: use unix:// or tcp://", host)
+	}
+
+	return client, nil
+}
+
+// dockerTLSConfig loads the client certificate and CA from certPath. Without
+// verify the daemon certificate is not checked, as with docker --tls.
+func dockerTLSConfig(certPath string, verify bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: !verify}
+	if certPath == "" && verify {
+		certPath = defaultDockerCertPath()
+	}
+	if certPath == "" {
+		return tlsConfig, nil
+	}
+
+	if verify {
+		caData, err := os.ReadFile(filepath.Join(certPath, "ca.pem"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read docker CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("no certificates found in docker CA")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	certFile, keyFile := filepath.Join(certPath, "cert.pem"), filepath.Join(certPath, "key.pem")
+	if _, err := os.Stat(certFile); err == nil {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid docker client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
 }
 
-func (dc *dockerEngineClient) ListContainers(ctx context.Context, nameFilter string) ([]dockerContainerSummary, error) {
-	filters := map[string][]string{
-		"name": {nameFilter},
+// defaultDockerCertPath returns the directory the docker CLI reads its TLS
+// files from when DOCKER_CERT_PATH is unset.
+func defaultDockerCertPath() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".docker")
+}
+
+// version returns the API version to use: the daemon's own, capped at
+// maxDockerAPIVersion. It is asked for once; a failed attempt is retried on
+// the next call.
+func (dc *dockerEngineClient) version(ctx context.Context) (string, error) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	if dc.apiVersion != "" {
+		return dc.apiVersion, nil
+	}
+
+	resp, err := dc.do(ctx, "/version")
+	if err != nil {
+		return "", fmt.Errorf("failed to negotiate docker API version: %w", err)
 	}
+	defer resp.Body.Close()
+
+	var daemon struct {
+		APIVersion string `json:"ApiVersion"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&daemon); err != nil {
+		return "", fmt.Errorf("failed to decode docker version: %w", err)
+	}
+
+	dc.apiVersion = maxDockerAPIVersion
+	if daemon.APIVersion != "" && compareAPIVersions(daemon.APIVersion, maxDockerAPIVersion) < 0 {
+		dc.apiVersion = daemon.APIVersion
+	}
+	return dc.apiVersion, nil
+}
+
+// compareAPIVersions compares two "major.minor" versions like strings.Compare.
+func compareAPIVersions(a, b string) int {
+	aParts, bParts := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < max(len(aParts), len(bParts)); i++ {
+		var aNum, bNum int
+		if i < len(aParts) {
+			aNum, _ = strconv.Atoi(aParts[i])
+		}
+		if i < len(bParts) {
+			bNum, _ = strconv.Atoi(bParts[i])
+		}
+		if aNum != bNum {
+			if aNum < bNum {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func (dc *dockerEngineClient) ListContainers(ctx context.Context, filters map[string][]string) ([]dockerContainerSummary, error) {
 	filtersJSON, err := json.Marshal(filters)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal container filters: %w", err)
 	}
 
-	path := fmt.Sprintf("/%s/containers/json?filters=%s", dockerAPIVersion, url.QueryEscape(string(filtersJSON)))
+	path := "/containers/json?filters=" + url.QueryEscape(string(filtersJSON))
 
 	var containers []dockerContainerSummary
 	if err := dc.getJSON(ctx, path, &containers); err != nil {
@@ -218,7 +1022,7 @@ func (dc *dockerEngineClient) ListContainers(ctx context.Context, nameFilter str
 }
 
 func (dc *dockerEngineClient) InspectContainer(ctx context.Context, containerID string) (dockerContainerInspect, error) {
-	path := fmt.Sprintf("/%s/containers/%s/json", dockerAPIVersion, containerID)
+	path := fmt.Sprintf("/containers/%s/json", containerID)
 
 	var inspectData dockerContainerInspect
 	if err := dc.getJSON(ctx, path, &inspectData); err != nil {
@@ -228,22 +1032,52 @@ func (dc *dockerEngineClient) InspectContainer(ctx context.Context, containerID
 	return inspectData, nil
 }
 
-func (dc *dockerEngineClient) getJSON(ctx context.Context, path string, out any) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://docker"+path, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create docker request: %w", err)
-	}
+// ReadFile copies a file out of the container through the archive API.
+func (dc *dockerEngineClient) ReadFile(ctx context.Context, containerID, filePath string) ([]byte, error) {
+	apiPath := fmt.Sprintf("/containers/%s/archive?path=%s", containerID, url.QueryEscape(filePath))
 
-	resp, err := dc.httpClient.Do(req)
+	resp, err := dc.get(ctx, apiPath)
 	if err != nil {
-		return fmt.Errorf("docker request failed: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
-		bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
-		return fmt.Errorf("docker API returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(bodyBytes)))
+	return readSingleFile(resp.Body)
+}
+
+// readSingleFile returns the content of the first regular file in a tar
+// stream.
+func readSingleFile(r io.Reader) ([]byte, error) {
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("archive holds no regular file")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if header.Size > maxSecretFileSize {
+			return nil, fmt.Errorf("file is larger than %d bytes", maxSecretFileSize)
+		}
+
+		var buf bytes.Buffer
+		if _, err := io.Copy(&buf, archive); err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		return buf.Bytes(), nil
 	}
+}
+
+func (dc *dockerEngineClient) getJSON(ctx context.Context, path string, out any) error {
+	resp, err := dc.get(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
 
 	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
 		return fmt.Errorf("failed to decode docker response: %w", err)
@@ -251,3 +1085,34 @@ func (dc *dockerEngineClient) getJSON(ctx context.Context, path string, out any)
 
 	return nil
 }
+
+// get sends a GET request for path in the negotiated API version and fails
+// on non-2xx responses. The caller closes the body.
+func (dc *dockerEngineClient) get(ctx context.Context, path string) (*http.Response, error) {
+	version, err := dc.version(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return dc.do(ctx, "/v"+version+path)
+}
+
+// do sends a GET request for an unversioned path.
+func (dc *dockerEngineClient) do(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, dc.baseURL+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create docker request: %w", err)
+	}
+
+	resp, err := dc.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("docker request failed: %w", err)
+	}
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		defer resp.Body.Close()
+		bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("docker API returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(bodyBytes)))
+	}
+
+	return resp, nil
+}
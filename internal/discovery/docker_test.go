@@ -1,20 +1,34 @@
 package discovery
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
+	"encoding/pem"
 	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 type fakeDockerClient struct {
 	listResult    []dockerContainerSummary
 	listErr       error
+	filters       map[string][]string
 	inspectResult map[string]dockerContainerInspect
 	inspectErr    error
+	files         map[string]string
 }
 
-func (f *fakeDockerClient) ListContainers(ctx context.Context, nameFilter string) ([]dockerContainerSummary, error) {
+func (f *fakeDockerClient) ListContainers(ctx context.Context, filters map[string][]string) ([]dockerContainerSummary, error) {
+	f.filters = filters
 	if f.listErr != nil {
 		return nil, f.listErr
 	}
@@ -32,6 +46,14 @@ func (f *fakeDockerClient) InspectContainer(ctx context.Context, containerID str
 	return inspectData, nil
 }
 
+func (f *fakeDockerClient) ReadFile(ctx context.Context, containerID, path string) ([]byte, error) {
+	content, ok := f.files[containerID+":"+path]
+	if !ok {
+		return nil, errors.New("docker API returned status 404")
+	}
+	return []byte(content), nil
+}
+
 func TestDiscoverInstances_Sorted(t *testing.T) {
 	client := &fakeDockerClient{
 		listResult: []dockerContainerSummary{
@@ -44,7 +66,7 @@ func TestDiscoverInstances_Sorted(t *testing.T) {
 		},
 	}
 
-	instances, err := discoverInstances(context.Background(), client)
+	instances, _, _, err := discoverInstances(context.Background(), client, newDockerConfig(nil))
 	if err != nil {
 		t.Fatalf("discoverInstances() unexpected error: %v", err)
 	}
@@ -63,7 +85,7 @@ func TestDiscoverInstances_Sorted(t *testing.T) {
 func TestDiscoverInstances_NoContainers(t *testing.T) {
 	client := &fakeDockerClient{}
 
-	_, err := discoverInstances(context.Background(), client)
+	_, _, _, err := discoverInstances(context.Background(), client, newDockerConfig(nil))
 	if err == nil {
 		t.Fatal("discoverInstances() expected error for empty list")
 	}
@@ -72,10 +94,291 @@ func TestDiscoverInstances_NoContainers(t *testing.T) {
 	}
 }
 
+func TestDiscoverInstances_Options(t *testing.T) {
+	client := &fakeDockerClient{
+		listResult: []dockerContainerSummary{
+			{ID: "aaaaaa111111333333", Names: []string{"/storage-1"}},
+		},
+		inspectResult: map[string]dockerContainerInspect{
+			"aaaaaa111111333333": newInspectData("172.17.0.2", "ring", "treepotato"),
+		},
+	}
+
+	cfg := newDockerConfig([]DockerOption{WithContainerNamePattern("storage"), WithAPIPort("9100")})
+	instances, _, _, err := discoverInstances(context.Background(), client, cfg)
+	if err != nil {
+		t.Fatalf("discoverInstances() unexpected error: %v", err)
+	}
+
+	if want := map[string][]string{"name": {"storage"}}; !reflect.DeepEqual(client.filters, want) {
+		t.Fatalf("filters = %v, want %v", client.filters, want)
+	}
+	if instances[0].Port != "9100" {
+		t.Fatalf("Port = %s, want 9100", instances[0].Port)
+	}
+}
+
+func TestDockerConfigFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []DockerOption
+		project string
+		want    map[string][]string
+	}{
+		{
+			name: "default name pattern",
+			want: map[string][]string{"name": {DefaultContainerNamePattern}},
+		},
+		{
+			name: "labels replace the default pattern",
+			opts: []DockerOption{WithLabelSelectors("gateway.role=storage", "env")},
+			want: map[string][]string{"label": {"gateway.role=storage", "env"}},
+		},
+		{
+			name: "labels and pattern",
+			opts: []DockerOption{WithLabelSelectors("gateway.role=storage"), WithContainerNamePattern("minio")},
+			want: map[string][]string{"label": {"gateway.role=storage"}, "name": {"minio"}},
+		},
+		{
+			name:    "compose project",
+			opts:    []DockerOption{WithLabelSelectors("gateway.role=storage")},
+			project: "alice",
+			want:    map[string][]string{"label": {"gateway.role=storage", "com.docker.compose.project=alice"}},
+		},
+		{
+			name:    "compose project keeps the default pattern",
+			project: "alice",
+			want: map[string][]string{
+				"label": {"com.docker.compose.project=alice"},
+				"name":  {DefaultContainerNamePattern},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newDockerConfig(tt.opts).filters(tt.project); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("filters() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiscoverInstances_State(t *testing.T) {
+	healthy := newInspectData("172.17.0.2", "ring", "treepotato")
+	healthy.State.Health = &dockerHealth{Status: "healthy"}
+	restarting := newInspectData("172.17.0.3", "ring", "treepotato")
+	restarting.State.Status = "restarting"
+	unhealthy := newInspectData("172.17.0.4", "ring", "treepotato")
+	unhealthy.State.Health = &dockerHealth{Status: "unhealthy"}
+	starting := newInspectData("172.17.0.5", "ring", "treepotato")
+	starting.State.Health = &dockerHealth{Status: "starting"}
+	noCheck := newInspectData("172.17.0.6", "ring", "treepotato")
+
+	client := &fakeDockerClient{
+		listResult: []dockerContainerSummary{
+			{ID: "aaaaaa111111333333", Names: []string{"/storage-1"}},
+			{ID: "bbbbbb222222333333", Names: []string{"/storage-2"}},
+			{ID: "cccccc333333333333", Names: []string{"/storage-3"}},
+			{ID: "dddddd444444333333", Names: []string{"/storage-4"}},
+			{ID: "eeeeee555555333333", Names: []string{"/storage-5"}},
+		},
+		inspectResult: map[string]dockerContainerInspect{
+			"aaaaaa111111333333": healthy,
+			"bbbbbb222222333333": restarting,
+			"cccccc333333333333": unhealthy,
+			"dddddd444444333333": starting,
+			"eeeeee555555333333": noCheck,
+		},
+	}
+
+	instances, excluded, _, err := discoverInstances(context.Background(), client, newDockerConfig(nil))
+	if err != nil {
+		t.Fatalf("discoverInstances() unexpected error: %v", err)
+	}
+	if len(instances) != 2 || instances[0].ID != "aaaaaa111111" || instances[1].ID != "eeeeee555555" {
+		t.Fatalf("instances = %+v, want aaaaaa111111 and eeeeee555555", instances)
+	}
+
+	want := []ExcludedInstance{
+		{ID: "bbbbbb222222", Name: "storage-2", Reason: "container is restarting"},
+		{ID: "cccccc333333", Name: "storage-3", Reason: "health check is unhealthy"},
+		{ID: "dddddd444444", Name: "storage-4", Reason: "health check is starting"},
+	}
+	if !reflect.DeepEqual(excluded, want) {
+		t.Fatalf("excluded = %+v, want %+v", excluded, want)
+	}
+}
+
+func TestDockerProvider_Quarantine(t *testing.T) {
+	inspect := newInspectData("172.17.0.2", "ring", "treepotato")
+	inspect.State.Health = &dockerHealth{Status: "unhealthy"}
+	client := &fakeDockerClient{
+		listResult: []dockerContainerSummary{
+			{ID: "aaaaaa111111333333", Names: []string{"/storage-1"}},
+			{ID: "bbbbbb222222333333", Names: []string{"/storage-2"}},
+		},
+		inspectResult: map[string]dockerContainerInspect{
+			"aaaaaa111111333333": newInspectData("172.17.0.1", "ring", "treepotato"),
+			"bbbbbb222222333333": inspect,
+		},
+	}
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	provider := &DockerProvider{
+		cfg:         newDockerConfig([]DockerOption{WithQuarantine(time.Minute)}),
+		client:      client,
+		now:         func() time.Time { return now },
+		quarantined: make(map[string]quarantinedContainer),
+	}
+
+	discover := func(wantInstances int, wantReason string) {
+		t.Helper()
+		instances, err := provider.Discover(context.Background())
+		if err != nil {
+			t.Fatalf("Discover() unexpected error: %v", err)
+		}
+		if len(instances) != wantInstances {
+			t.Fatalf("Discover() returned %d instances, want %d", len(instances), wantInstances)
+		}
+		excluded := provider.Excluded()
+		if wantReason == "" {
+			if len(excluded) != 0 {
+				t.Fatalf("Excluded() = %+v, want none", excluded)
+			}
+			return
+		}
+		if len(excluded) != 1 || excluded[0].Name != "storage-2" || excluded[0].Reason != wantReason {
+			t.Fatalf("Excluded() = %+v, want storage-2: %s", excluded, wantReason)
+		}
+	}
+
+	discover(1, "health check is unhealthy")
+
+	inspect.State.Health.Status = "healthy"
+	client.inspectResult["bbbbbb222222333333"] = inspect
+	now = now.Add(30 * time.Second)
+	discover(1, "quarantined until 2026-10-18T12:01:00Z")
+
+	now = now.Add(time.Minute)
+	discover(2, "")
+}
+
+func TestDockerProvider_ExcludesUnusableContainers(t *testing.T) {
+	badLabel := newInspectData("172.17.0.2", "ring", "treepotato")
+	badLabel.Config.Labels = map[string]string{LabelWeight: "heavy"}
+	noCredentials := newInspectData("172.17.0.4", "", "")
+
+	client := &fakeDockerClient{
+		listResult: []dockerContainerSummary{
+			{ID: "aaaaaa111111333333", Names: []string{"/storage-1"}},
+			{ID: "bbbbbb222222333333", Names: []string{"/storage-2"}},
+			{ID: "cccccc333333333333", Names: []string{"/storage-3"}},
+		},
+		inspectResult: map[string]dockerContainerInspect{
+			"aaaaaa111111333333": badLabel,
+			"bbbbbb222222333333": newInspectData("172.17.0.3", "ring", "treepotato"),
+			"cccccc333333333333": noCredentials,
+		},
+	}
+	provider := &DockerProvider{
+		cfg:         newDockerConfig([]DockerOption{WithQuarantine(time.Minute)}),
+		client:      client,
+		now:         time.Now,
+		quarantined: make(map[string]quarantinedContainer),
+	}
+
+	instances, err := provider.Discover(context.Background())
+	if err != nil {
+		t.Fatalf("Discover() unexpected error: %v", err)
+	}
+	if len(instances) != 1 || instances[0].ID != "bbbbbb222222" {
+		t.Fatalf("instances = %+v, want only bbbbbb222222", instances)
+	}
+
+	want := []ExcludedInstance{
+		{ID: "aaaaaa111111", Name: "storage-1", Reason: `label ` + LabelWeight + `: "heavy" is not a positive integer`},
+		{ID: "cccccc333333", Name: "storage-3", Reason: "missing minio credentials in environment"},
+	}
+	if excluded := provider.Excluded(); !reflect.DeepEqual(excluded, want) {
+		t.Fatalf("Excluded() = %+v, want %+v", excluded, want)
+	}
+	// Unusable containers are not quarantined, so they rejoin once fixed.
+	if len(provider.quarantined) != 0 {
+		t.Fatalf("quarantined = %+v, want none", provider.quarantined)
+	}
+
+	// With the good container gone, Discover fails and names the problems.
+	client.listResult = []dockerContainerSummary{client.listResult[0], client.listResult[2]}
+	_, err = provider.Discover(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "no minio instances found: 2 excluded") || !strings.Contains(err.Error(), "missing minio credentials") {
+		t.Fatalf("Discover() error = %v, want no instances with the reasons", err)
+	}
+	if excluded := provider.Excluded(); len(excluded) != 2 {
+		t.Fatalf("Excluded() = %+v, want both containers", excluded)
+	}
+}
+
+func TestExtractInstanceInfo_Labels(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		want    MinioInstance
+		wantErr string
+	}{
+		{
+			name: "no labels",
+			want: MinioInstance{Port: "9000"},
+		},
+		{
+			name:   "overrides",
+			labels: map[string]string{LabelPort: "9443", LabelWeight: "3", LabelZone: "eu-1a", LabelTLS: "true"},
+			want:   MinioInstance{Port: "9443", Weight: 3, Zone: "eu-1a", Secure: true},
+		},
+		{
+			name:    "invalid port",
+			labels:  map[string]string{LabelPort: "http"},
+			wantErr: "is not a valid port",
+		},
+		{
+			name:    "zero weight",
+			labels:  map[string]string{LabelWeight: "0"},
+			wantErr: "is not a positive integer",
+		},
+		{
+			name:    "invalid tls",
+			labels:  map[string]string{LabelTLS: "sometimes"},
+			wantErr: "is not a boolean",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inspect := newInspectData("172.17.0.2", "access", "secret")
+			inspect.Config.Labels = tt.labels
+
+			instance, err := extractInstanceInfo("123", inspect, DefaultAPIPort, addressMode{})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("extractInstanceInfo() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("extractInstanceInfo() unexpected error: %v", err)
+			}
+
+			got := MinioInstance{Port: instance.Port, Weight: instance.Weight, Zone: instance.Zone, Secure: instance.Secure}
+			if got != tt.want {
+				t.Fatalf("overrides = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestExtractInstanceInfo(t *testing.T) {
 	inspect := newInspectData("172.17.0.2", "access", "secret")
 
-	instance, err := extractInstanceInfo("1234567890abcdef", inspect)
+	instance, err := extractInstanceInfo("1234567890abcdef", inspect, DefaultAPIPort, addressMode{})
 	if err != nil {
 		t.Fatalf("extractInstanceInfo() unexpected error: %v", err)
 	}
@@ -103,7 +406,7 @@ func TestExtractInstanceInfo_MissingIP(t *testing.T) {
 		"bridge": {},
 	}
 
-	_, err := extractInstanceInfo("123", inspect)
+	_, err := extractInstanceInfo("123", inspect, DefaultAPIPort, addressMode{})
 	if err == nil {
 		t.Fatal("extractInstanceInfo() expected error")
 	}
@@ -112,6 +415,379 @@ func TestExtractInstanceInfo_MissingIP(t *testing.T) {
 	}
 }
 
+func TestDiscoverInstances_Credentials(t *testing.T) {
+	secretsDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(secretsDir, "access_key"), []byte("dir-user\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(secretsDir, "secret_key"), []byte("dir-secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	credentialsFile := filepath.Join(t.TempDir(), "credentials.yaml")
+	credentials := "accessKey: default-user\nsecretKey: default-secret\nhosts:\n  storage-listed:\n    accessKey: listed-user\n    secretKey: listed-secret\n"
+	if err := os.WriteFile(credentialsFile, []byte(credentials), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	fileEnv := []string{"MINIO_ROOT_USER_FILE=access_key", "MINIO_ROOT_PASSWORD_FILE=/etc/minio/secret_key"}
+	tests := []struct {
+		name       string
+		container  string
+		env        []string
+		opts       []DockerOption
+		wantAccess string
+		wantSecret string
+		wantErr    string
+	}{
+		{
+			name:       "files from container",
+			env:        fileEnv,
+			wantAccess: "archive-user",
+			wantSecret: "archive-secret",
+		},
+		{
+			name:       "files from secrets dir",
+			env:        fileEnv,
+			opts:       []DockerOption{WithSecretsDir(secretsDir)},
+			wantAccess: "dir-user",
+			wantSecret: "dir-secret",
+		},
+		{
+			name:       "plain variable wins over file",
+			env:        append([]string{"MINIO_ROOT_USER=plain-user"}, fileEnv...),
+			wantAccess: "plain-user",
+			wantSecret: "archive-secret",
+		},
+		{
+			name:       "credentials file by container name",
+			container:  "storage-listed",
+			env:        []string{"MINIO_ROOT_USER=plain-user", "MINIO_ROOT_PASSWORD=plain-secret"},
+			opts:       []DockerOption{WithCredentialsFile(credentialsFile)},
+			wantAccess: "listed-user",
+			wantSecret: "listed-secret",
+		},
+		{
+			name:       "credentials file defaults",
+			opts:       []DockerOption{WithCredentialsFile(credentialsFile)},
+			wantAccess: "default-user",
+			wantSecret: "default-secret",
+		},
+		{
+			name:    "missing file",
+			env:     []string{"MINIO_ROOT_USER_FILE=other", "MINIO_ROOT_PASSWORD=secret"},
+			wantErr: "failed to read MINIO_ROOT_USER_FILE",
+		},
+		{
+			name:    "no credentials",
+			wantErr: "missing minio credentials",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			container := tt.container
+			if container == "" {
+				container = "storage-1"
+			}
+			inspect := newInspectData("172.17.0.2", "", "")
+			inspect.Config.Env = tt.env
+			client := &fakeDockerClient{
+				listResult:    []dockerContainerSummary{{ID: "aaaaaa111111333333", Names: []string{"/" + container}}},
+				inspectResult: map[string]dockerContainerInspect{"aaaaaa111111333333": inspect},
+				files: map[string]string{
+					"aaaaaa111111333333:/run/secrets/access_key": "archive-user\n",
+					"aaaaaa111111333333:/etc/minio/secret_key":   "archive-secret",
+				},
+			}
+
+			instances, _, _, err := discoverInstances(context.Background(), client, newDockerConfig(tt.opts))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("discoverInstances() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("discoverInstances() unexpected error: %v", err)
+			}
+			if instances[0].AccessKey != tt.wantAccess || instances[0].SecretKey != tt.wantSecret {
+				t.Fatalf("credentials = %s/%s, want %s/%s", instances[0].AccessKey, instances[0].SecretKey, tt.wantAccess, tt.wantSecret)
+			}
+		})
+	}
+}
+
+func TestReadSecretFile_SecretsDir(t *testing.T) {
+	base := t.TempDir()
+	secretsDir := filepath.Join(base, "secrets")
+	if err := os.Mkdir(secretsDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(secretsDir, "access_key"), []byte("dir-user\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(base, "outside"), []byte("leaked"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(base, "outside"), filepath.Join(secretsDir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	large := strings.Repeat("x", maxSecretFileSize+1)
+	if err := os.WriteFile(filepath.Join(secretsDir, "large"), []byte(large), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		want    string
+		wantErr string
+	}{
+		{name: "relative", file: "access_key", want: "dir-user"},
+		{name: "absolute in run secrets", file: "/run/secrets/access_key", want: "dir-user"},
+		{name: "absolute elsewhere", file: "/etc/minio/access_key", want: "dir-user"},
+		{name: "absolute escape", file: "/run/secrets/../../outside", wantErr: "no such file"},
+		{name: "relative escape", file: "../outside", wantErr: "no such file"},
+		{name: "symlink escape", file: "link", wantErr: "escapes"},
+		{name: "too large", file: "large", wantErr: "larger than"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readSecretFile(context.Background(), &fakeDockerClient{}, secretsDir, "container", tt.file)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("readSecretFile() = %q, %v, want error containing %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readSecretFile() error = %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("readSecretFile() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadSingleFile(t *testing.T) {
+	var buf bytes.Buffer
+	archive := tar.NewWriter(&buf)
+	if err := archive.WriteHeader(&tar.Header{Name: "secrets", Typeflag: tar.TypeDir, Mode: 0o755}); err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.WriteHeader(&tar.Header{Name: "secrets/access_key", Typeflag: tar.TypeReg, Mode: 0o600, Size: 4}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := archive.Write([]byte("user")); err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := readSingleFile(&buf)
+	if err != nil {
+		t.Fatalf("readSingleFile() unexpected error: %v", err)
+	}
+	if string(content) != "user" {
+		t.Fatalf("content = %q, want user", content)
+	}
+
+	if _, err := readSingleFile(bytes.NewReader(nil)); err == nil {
+		t.Fatal("readSingleFile() expected error for empty archive")
+	}
+}
+
+// newMultiNetworkInspectData returns a container attached to the backend and
+// frontend networks.
+func newMultiNetworkInspectData() dockerContainerInspect {
+	inspect := newInspectData("", "access", "secret")
+	inspect.NetworkSettings.Networks = map[string]struct {
+		IPAddress string `json:"IPAddress"`
+	}{
+		"backend":  {IPAddress: "10.0.0.2"},
+		"frontend": {IPAddress: "172.18.0.2"},
+	}
+	return inspect
+}
+
+func TestExtractInstanceInfo_Address(t *testing.T) {
+	published := newMultiNetworkInspectData()
+	published.NetworkSettings.Ports = map[string][]dockerPortBinding{
+		"9000/tcp": {{HostIP: "::", HostPort: "32769"}, {HostIP: "0.0.0.0", HostPort: "32768"}},
+		"9443/tcp": {{HostIP: "192.168.1.5", HostPort: "9443"}},
+	}
+	publishedTLS := published
+	publishedTLS.Config.Labels = map[string]string{LabelPort: "9443"}
+
+	tests := []struct {
+		name     string
+		inspect  dockerContainerInspect
+		mode     addressMode
+		wantHost string
+		wantPort string
+		wantErr  string
+	}{
+		{
+			name:     "first network by name",
+			inspect:  newMultiNetworkInspectData(),
+			wantHost: "10.0.0.2",
+			wantPort: "9000",
+		},
+		{
+			name:     "named network",
+			inspect:  newMultiNetworkInspectData(),
+			mode:     addressMode{networks: map[string]bool{"frontend": true}},
+			wantHost: "172.18.0.2",
+			wantPort: "9000",
+		},
+		{
+			name:    "not on network",
+			inspect: newMultiNetworkInspectData(),
+			mode:    addressMode{networks: map[string]bool{"storage": true}},
+			wantErr: "no ip address found for container on networks storage",
+		},
+		{
+			name:     "published on all interfaces",
+			inspect:  published,
+			mode:     addressMode{publishedHost: "docker.internal"},
+			wantHost: "docker.internal",
+			wantPort: "32768",
+		},
+		{
+			name:     "published on one address",
+			inspect:  publishedTLS,
+			mode:     addressMode{publishedHost: "docker.internal"},
+			wantHost: "192.168.1.5",
+			wantPort: "9443",
+		},
+		{
+			name:    "not published",
+			inspect: newMultiNetworkInspectData(),
+			mode:    addressMode{publishedHost: "docker.internal"},
+			wantErr: "port 9000/tcp is not published",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance, err := extractInstanceInfo("123", tt.inspect, DefaultAPIPort, tt.mode)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("extractInstanceInfo() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("extractInstanceInfo() unexpected error: %v", err)
+			}
+			if instance.Host != tt.wantHost || instance.Port != tt.wantPort {
+				t.Fatalf("address = %s:%s, want %s:%s", instance.Host, instance.Port, tt.wantHost, tt.wantPort)
+			}
+		})
+	}
+}
+
+func TestResolveAddressMode(t *testing.T) {
+	gateway := newInspectData("", "", "")
+	gateway.NetworkSettings.Networks = map[string]struct {
+		IPAddress string `json:"IPAddress"`
+	}{
+		"frontend": {IPAddress: "172.18.0.9"},
+	}
+
+	tests := []struct {
+		name string
+		opts []DockerOption
+		want addressMode
+	}{
+		{name: "default", want: addressMode{}},
+		{name: "named network", opts: []DockerOption{WithNetwork("backend")}, want: addressMode{networks: map[string]bool{"backend": true}}},
+		{name: "auto", opts: []DockerOption{WithNetwork(NetworkAuto)}, want: addressMode{networks: map[string]bool{"frontend": true}}},
+		{name: "published ports", opts: []DockerOption{WithPublishedPorts("")}, want: addressMode{publishedHost: "127.0.0.1"}},
+		{name: "published ports of tcp daemon", opts: []DockerOption{WithPublishedPorts(""), WithDockerHost("tcp://docker.internal:2376")}, want: addressMode{publishedHost: "docker.internal"}},
+		{name: "published ports on host", opts: []DockerOption{WithPublishedPorts("10.0.0.1")}, want: addressMode{publishedHost: "10.0.0.1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if mode := resolveAddressMode(newDockerConfig(tt.opts), gateway); !reflect.DeepEqual(mode, tt.want) {
+				t.Fatalf("resolveAddressMode() = %+v, want %+v", mode, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiscoverInstances_GatewayContainer(t *testing.T) {
+	gateway := newInspectData("172.18.0.9", "", "")
+	gateway.Config.Labels = map[string]string{composeProjectLabel: "alice"}
+	unlabelled := newInspectData("172.18.0.9", "", "")
+
+	tests := []struct {
+		name       string
+		opts       []DockerOption
+		hostname   string
+		wantFilter []string
+		wantErr    string
+	}{
+		{
+			name:       "explicit project",
+			opts:       []DockerOption{WithComposeProject("bob")},
+			wantFilter: []string{"com.docker.compose.project=bob"},
+		},
+		{
+			name:       "own project",
+			opts:       []DockerOption{WithComposeProject(ComposeProjectAuto)},
+			hostname:   "gateway0000",
+			wantFilter: []string{"com.docker.compose.project=alice"},
+		},
+		{
+			name:     "own project without compose",
+			opts:     []DockerOption{WithComposeProject(ComposeProjectAuto)},
+			hostname: "unlabelled0",
+			wantErr:  "gateway container has no com.docker.compose.project label",
+		},
+		{
+			name:     "outside docker",
+			opts:     []DockerOption{WithNetwork(NetworkAuto)},
+			hostname: "laptop",
+			wantErr:  "failed to find the gateway container laptop",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeDockerClient{
+				listResult: []dockerContainerSummary{{ID: "aaaaaa111111333333", Names: []string{"/storage-1"}}},
+				inspectResult: map[string]dockerContainerInspect{
+					"aaaaaa111111333333": newInspectData("172.18.0.2", "ring", "treepotato"),
+					"gateway0000":        gateway,
+					"unlabelled0":        unlabelled,
+				},
+			}
+			cfg := newDockerConfig(tt.opts)
+			cfg.hostname = func() (string, error) { return tt.hostname, nil }
+
+			_, _, _, err := discoverInstances(context.Background(), client, cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("discoverInstances() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("discoverInstances() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(client.filters["label"], tt.wantFilter) {
+				t.Fatalf("label filter = %v, want %v", client.filters["label"], tt.wantFilter)
+			}
+		})
+	}
+}
+
 func TestExtractCredentials_RootUserFallback(t *testing.T) {
 	access, secret := extractCredentials([]string{
 		"MINIO_ROOT_USER=root-user",
@@ -125,6 +801,7 @@ func TestExtractCredentials_RootUserFallback(t *testing.T) {
 
 func newInspectData(ipAddress, accessKey, secretKey string) dockerContainerInspect {
 	inspect := dockerContainerInspect{}
+	inspect.State.Status = "running"
 	inspect.Config.Env = []string{
 		"MINIO_ACCESS_KEY=" + accessKey,
 		"MINIO_SECRET_KEY=" + secretKey,
@@ -138,3 +815,158 @@ func newInspectData(ipAddress, accessKey, secretKey string) dockerContainerInspe
 	}
 	return inspect
 }
+
+func TestNewDockerEngineClient_Hosts(t *testing.T) {
+	// TLS verification without a cert path reads the CA from DOCKER_CONFIG.
+	daemon := httptest.NewTLSServer(http.NotFoundHandler())
+	daemon.Close()
+	dockerConfig := t.TempDir()
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: daemon.Certificate().Raw})
+	if err := os.WriteFile(filepath.Join(dockerConfig, "ca.pem"), caPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DOCKER_CONFIG", dockerConfig)
+
+	tests := []struct {
+		name        string
+		opts        []DockerOption
+		wantBaseURL string
+		wantErr     string
+	}{
+		{name: "socket", opts: []DockerOption{WithDockerSocket("/run/podman/podman.sock")}, wantBaseURL: "http://docker"},
+		{name: "unix host", opts: []DockerOption{WithDockerHost("unix:///var/run/docker.sock")}, wantBaseURL: "http://docker"},
+		{name: "host wins over socket", opts: []DockerOption{WithDockerHost("tcp://docker.internal:2375"), WithDockerSocket("/tmp/docker.sock")}, wantBaseURL: "http://docker.internal:2375"},
+		{name: "tcp default port", opts: []DockerOption{WithDockerHost("tcp://docker.internal")}, wantBaseURL: "http://docker.internal:2375"},
+		{name: "no tls without cert path or verify", opts: []DockerOption{WithDockerHost("tcp://docker.internal"), WithDockerTLS("", false)}, wantBaseURL: "http://docker.internal:2375"},
+		{name: "tls verify", opts: []DockerOption{WithDockerHost("tcp://docker.internal"), WithDockerTLS("", true)}, wantBaseURL: "https://docker.internal:2376"},
+		{name: "unsupported scheme", opts: []DockerOption{WithDockerHost("npipe:////./pipe/docker_engine")}, wantErr: "unsupported docker host"},
+		{name: "missing scheme", opts: []DockerOption{WithDockerHost("docker.internal:2375")}, wantErr: "invalid docker host"},
+		{name: "missing CA", opts: []DockerOption{WithDockerHost("tcp://docker.internal"), WithDockerTLS(t.TempDir(), true)}, wantErr: "failed to read docker CA"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := newDockerEngineClient(newDockerConfig(tt.opts))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("newDockerEngineClient() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newDockerEngineClient() unexpected error: %v", err)
+			}
+			if client.baseURL != tt.wantBaseURL {
+				t.Fatalf("baseURL = %s, want %s", client.baseURL, tt.wantBaseURL)
+			}
+		})
+	}
+}
+
+// fakeDockerDaemon answers /version with apiVersion and records the other
+// paths it is asked for.
+func fakeDockerDaemon(apiVersion string, paths chan<- string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/version" {
+			fmt.Fprintf(w, `{"ApiVersion": %q}`, apiVersion)
+			return
+		}
+		paths <- r.URL.Path
+		fmt.Fprint(w, `[]`)
+	})
+}
+
+func TestDockerEngineClient_NegotiatesVersion(t *testing.T) {
+	tests := []struct {
+		daemonVersion string
+		wantPath      string
+	}{
+		{daemonVersion: "1.40", wantPath: "/v1.40/containers/json"},
+		{daemonVersion: "1.45", wantPath: "/v" + maxDockerAPIVersion + "/containers/json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.daemonVersion, func(t *testing.T) {
+			paths := make(chan string, 2)
+			server := httptest.NewServer(fakeDockerDaemon(tt.daemonVersion, paths))
+			defer server.Close()
+
+			client, err := newDockerEngineClient(newDockerConfig([]DockerOption{WithDockerHost("tcp://" + server.Listener.Addr().String())}))
+			if err != nil {
+				t.Fatalf("newDockerEngineClient() unexpected error: %v", err)
+			}
+			for range 2 {
+				if _, err := client.ListContainers(context.Background(), nil); err != nil {
+					t.Fatalf("ListContainers() unexpected error: %v", err)
+				}
+				if path := <-paths; path != tt.wantPath {
+					t.Fatalf("path = %s, want %s", path, tt.wantPath)
+				}
+			}
+		})
+	}
+}
+
+func TestDockerEngineClient_TLS(t *testing.T) {
+	paths := make(chan string, 1)
+	server := httptest.NewTLSServer(fakeDockerDaemon("1.41", paths))
+	defer server.Close()
+
+	certPath := t.TempDir()
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(filepath.Join(certPath, "ca.pem"), caPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		certPath     string
+		dockerConfig string
+	}{
+		{name: "cert path", certPath: certPath, dockerConfig: t.TempDir()},
+		{name: "default cert path", dockerConfig: certPath},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DOCKER_CONFIG", tt.dockerConfig)
+			client, err := newDockerEngineClient(newDockerConfig([]DockerOption{
+				WithDockerHost("tcp://" + server.Listener.Addr().String()),
+				WithDockerTLS(tt.certPath, true),
+			}))
+			if err != nil {
+				t.Fatalf("newDockerEngineClient() unexpected error: %v", err)
+			}
+			if _, err := client.ListContainers(context.Background(), nil); err != nil {
+				t.Fatalf("ListContainers() unexpected error: %v", err)
+			}
+			if path := <-paths; path != "/v1.41/containers/json" {
+				t.Fatalf("path = %s, want /v1.41/containers/json", path)
+			}
+		})
+	}
+}
+
+func TestDockerEngineClient_UnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "podman.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	paths := make(chan string, 1)
+	server := httptest.NewUnstartedServer(fakeDockerDaemon("1.41", paths))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	client, err := newDockerEngineClient(newDockerConfig([]DockerOption{WithDockerSocket(socket)}))
+	if err != nil {
+		t.Fatalf("newDockerEngineClient() unexpected error: %v", err)
+	}
+	if _, err := client.ListContainers(context.Background(), nil); err != nil {
+		t.Fatalf("ListContainers() unexpected error: %v", err)
+	}
+	if path := <-paths; path != "/v1.41/containers/json" {
+		t.Fatalf("path = %s, want /v1.41/containers/json", path)
+	}
+}
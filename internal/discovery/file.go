@@ -0,0 +1,81 @@
+package discovery
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+)
+
+// FileProvider reads instances from a file in the format of StaticProvider
+// and reports when the file changes, so operators can add and remove
+// instances by editing it. Changes are detected by polling the modification
+// time and size of the file.
+type FileProvider struct {
+	*StaticProvider
+	pollInterval time.Duration
+}
+
+// NewFileProvider returns a provider for the instance file at path, checked
+// for changes every pollInterval.
+func NewFileProvider(path string, pollInterval time.Duration) *FileProvider {
+	return &FileProvider{
+		StaticProvider: NewStaticProvider(path),
+		pollInterval:   pollInterval,
+	}
+}
+
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+func (p *FileProvider) version() (fileVersion, error) {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return fileVersion{}, err
+	}
+	return fileVersion{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// Changes polls the instance file and reports every new version of it. A
+// missing file is logged once and reported again when it reappears.
+func (p *FileProvider) Changes(ctx context.Context) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+	last, lastErr := p.version()
+
+	go func() {
+		defer close(changes)
+
+		ticker := time.NewTicker(p.pollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			current, err := p.version()
+			if err != nil {
+				if lastErr == nil {
+					log.Printf("instance file %s is unavailable: %v", p.path, err)
+				}
+				lastErr = err
+				continue
+			}
+			if lastErr == nil && current == last {
+				continue
+			}
+
+			last, lastErr = current, nil
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return changes
+}
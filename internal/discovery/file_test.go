@@ -0,0 +1,79 @@
+package discovery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileProviderChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "instances.yaml")
+	write := func(content string, modTime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("failed to write instance file: %v", err)
+		}
+		// Set the time explicitly since writes within one clock tick keep it.
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("failed to set modification time: %v", err)
+		}
+	}
+	start := time.Now().Add(-time.Hour)
+	write("instances:\n  - {id: a, host: h1, accessKey: k, secretKey: s}\n", start)
+
+	provider := NewFileProvider(path, time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := provider.Changes(ctx)
+
+	expectChange := func(reason string) {
+		t.Helper()
+		select {
+		case <-changes:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no change reported after %s", reason)
+		}
+	}
+	expectQuiet := func(reason string) {
+		t.Helper()
+		select {
+		case <-changes:
+			t.Fatalf("change reported after %s", reason)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+
+	expectQuiet("start")
+
+	write("instances:\n  - {id: a, host: h1, accessKey: k, secretKey: s}\n  - {id: b, host: h2, accessKey: k, secretKey: s}\n", start.Add(time.Minute))
+	expectChange("adding an instance")
+
+	instances, err := provider.Discover(ctx)
+	if err != nil {
+		t.Fatalf("Discover() unexpected error: %v", err)
+	}
+	if len(instances) != 2 {
+		t.Fatalf("Discover() returned %d instances, want 2", len(instances))
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("failed to remove instance file: %v", err)
+	}
+	expectQuiet("removing the file")
+
+	write("instances:\n  - {id: b, host: h2, accessKey: k, secretKey: s}\n", start.Add(2*time.Minute))
+	expectChange("restoring the file")
+}
+
+func TestFileProviderRejectsEmptyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "instances.yaml")
+	if err := os.WriteFile(path, []byte("instances: []\n"), 0o600); err != nil {
+		t.Fatalf("failed to write instance file: %v", err)
+	}
+
+	if _, err := NewFileProvider(path, time.Second).Discover(context.Background()); err == nil {
+		t.Fatal("Discover() expected error for a file without instances")
+	}
+}
@@ -0,0 +1,733 @@
+package discovery
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	defaultNamespace  = "default"
+
+	// watchRetryDelay is the pause before a failed watch is opened again.
+	watchRetryDelay = 5 * time.Second
+)
+
+type kubernetesConfig struct {
+	kubeconfig      string
+	namespace       string
+	port            string
+	endpoints       bool
+	secretName      string
+	secretAccessKey string
+	secretSecretKey string
+}
+
+// KubernetesOption configures Kubernetes discovery.
+type KubernetesOption func(*kubernetesConfig)
+
+// WithKubeconfig reads the API server and credentials from the kubeconfig
+// file at path instead of the in-cluster service account.
+func WithKubeconfig(path string) KubernetesOption {
+	return func(cfg *kubernetesConfig) {
+		cfg.kubeconfig = path
+	}
+}
+
+// WithNamespace sets the namespace searched for instances. It defaults to the
+// namespace of the service account or kubeconfig context.
+func WithNamespace(namespace string) KubernetesOption {
+	return func(cfg *kubernetesConfig) {
+		cfg.namespace = namespace
+	}
+}
+
+// WithKubernetesPort sets the Minio port by name or number.
+func WithKubernetesPort(port string) KubernetesOption {
+	return func(cfg *kubernetesConfig) {
+		cfg.port = port
+	}
+}
+
+// WithEndpoints reads instances from Endpoints objects instead of Pods, so
+// only addresses the Service considers ready are used. Endpoints carry no
+// environment, so this mode needs WithCredentialsSecret.
+func WithEndpoints() KubernetesOption {
+	return func(cfg *kubernetesConfig) {
+		cfg.endpoints = true
+	}
+}
+
+// WithCredentialsSecret reads the credentials of every instance from the
+// Secret name instead of the environment of the Minio container.
+func WithCredentialsSecret(name, accessKeyKey, secretKeyKey string) KubernetesOption {
+	return func(cfg *kubernetesConfig) {
+		cfg.secretName = name
+		cfg.secretAccessKey = accessKeyKey
+		cfg.secretSecretKey = secretKeyKey
+	}
+}
+
+// KubernetesProvider finds Minio instances among the Pods or Endpoints that
+// match a label selector, using the Kubernetes REST API. Credentials come
+// from a configured Secret or from the MINIO_* variables of the Pod, which
+// may reference Secrets. Instances are named after their Pod.
+type KubernetesProvider struct {
+	selector string
+	cfg      kubernetesConfig
+	client   *kubeClient
+}
+
+// NewKubernetesProvider returns a provider for the objects matching
+// labelSelector.
+func NewKubernetesProvider(labelSelector string, opts ...KubernetesOption) (*KubernetesProvider, error) {
+	cfg := kubernetesConfig{port: DefaultAPIPort}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.endpoints && cfg.secretName == "" {
+		return nil, fmt.Errorf("kubernetes endpoints discovery needs a credentials secret")
+	}
+
+	var (
+		client    *kubeClient
+		namespace string
+		err       error
+	)
+	if cfg.kubeconfig != "" {
+		client, namespace, err = kubeClientFromKubeconfig(cfg.kubeconfig)
+	} else {
+		client, namespace, err = inClusterKubeClient()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.namespace == "" {
+		cfg.namespace = namespace
+	}
+	if cfg.namespace == "" {
+		cfg.namespace = defaultNamespace
+	}
+
+	return &KubernetesProvider{selector: labelSelector, cfg: cfg, client: client}, nil
+}
+
+type kubeMetadata struct {
+	Name              string  `json:"name"`
+	Namespace         string  `json:"namespace"`
+	DeletionTimestamp *string `json:"deletionTimestamp"`
+}
+
+type kubeEnvVar struct {
+	Name      string `json:"name"`
+	Value     string `json:"value"`
+	ValueFrom *struct {
+		SecretKeyRef *struct {
+			Name string `json:"name"`
+			Key  string `json:"key"`
+		} `json:"secretKeyRef"`
+	} `json:"valueFrom"`
+}
+
+type kubePod struct {
+	Metadata kubeMetadata `json:"metadata"`
+	Spec     struct {
+		Containers []struct {
+			Env   []kubeEnvVar `json:"env"`
+			Ports []struct {
+				Name          string `json:"name"`
+				ContainerPort int    `json:"containerPort"`
+			} `json:"ports"`
+		} `json:"containers"`
+	} `json:"spec"`
+	Status struct {
+		Phase      string `json:"phase"`
+		PodIP      string `json:"podIP"`
+		Conditions []struct {
+			Type   string `json:"type"`
+			Status string `json:"status"`
+		} `json:"conditions"`
+	} `json:"status"`
+}
+
+type kubeEndpoints struct {
+	Metadata kubeMetadata `json:"metadata"`
+	Subsets  []struct {
+		Addresses []struct {
+			IP        string `json:"ip"`
+			TargetRef *struct {
+				Kind string `json:"kind"`
+				Name string `json:"name"`
+			} `json:"targetRef"`
+		} `json:"addresses"`
+		Ports []struct {
+			Name string `json:"name"`
+			Port int    `json:"port"`
+		} `json:"ports"`
+	} `json:"subsets"`
+}
+
+type kubeSecret struct {
+	Data map[string]string `json:"data"`
+}
+
+// Discover lists the matching Pods or Endpoints. Pods that are not running
+// and ready are skipped.
+func (p *KubernetesProvider) Discover(ctx context.Context) ([]MinioInstance, error) {
+	secrets := newSecretCache(p)
+
+	var (
+		instances []MinioInstance
+		err       error
+	)
+	if p.cfg.endpoints {
+		instances, err = p.discoverEndpoints(ctx, secrets)
+	} else {
+		instances, err = p.discoverPods(ctx, secrets)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("no minio instances found")
+	}
+
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].ID < instances[j].ID
+	})
+	return instances, nil
+}
+
+func (p *KubernetesProvider) discoverPods(ctx context.Context, secrets *secretCache) ([]MinioInstance, error) {
+	var pods struct {
+		Items []kubePod `json:"items"`
+	}
+	if err := p.client.getJSON(ctx, p.resourcePath("pods"), p.selectorQuery(), &pods); err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	// A pod that cannot be used as configured is skipped rather than failing
+	// the whole discovery; its problem is only returned when no pod is left.
+	instances := make([]MinioInstance, 0, len(pods.Items))
+	var problems []error
+	for _, pod := range pods.Items {
+		if !podReady(pod) {
+			continue
+		}
+
+		port, err := podPort(pod, p.cfg.port)
+		var creds Credentials
+		if err == nil {
+			creds, err = p.credentials(ctx, secrets, &pod)
+		}
+		if err != nil {
+			err = fmt.Errorf("invalid minio pod %s: %w", pod.Metadata.Name, err)
+			log.Printf("skipping %v", err)
+			problems = append(problems, err)
+			continue
+		}
+
+		instances = append(instances, MinioInstance{
+			ID:        pod.Metadata.Name,
+			Host:      pod.Status.PodIP,
+			Port:      port,
+			AccessKey: creds.AccessKey,
+			SecretKey: creds.SecretKey,
+		})
+	}
+
+	if len(instances) == 0 && len(problems) > 0 {
+		err := fmt.Errorf("no minio instances found: %d pod(s) skipped", len(problems))
+		return nil, errors.Join(append([]error{err}, problems...)...)
+	}
+	return instances, nil
+}
+
+func (p *KubernetesProvider) discoverEndpoints(ctx context.Context, secrets *secretCache) ([]MinioInstance, error) {
+	var list struct {
+		Items []kubeEndpoints `json:"items"`
+	}
+	if err := p.client.getJSON(ctx, p.resourcePath("endpoints"), p.selectorQuery(), &list); err != nil {
+		return nil, fmt.Errorf("failed to list endpoints: %w", err)
+	}
+	creds, err := p.credentials(ctx, secrets, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid minio endpoints: %w", err)
+	}
+
+	var instances []MinioInstance
+	for _, endpoints := range list.Items {
+		for _, subset := range endpoints.Subsets {
+			port := ""
+			for _, candidate := range subset.Ports {
+				if candidate.Name == p.cfg.port || strconv.Itoa(candidate.Port) == p.cfg.port {
+					port = strconv.Itoa(candidate.Port)
+					break
+				}
+			}
+			if port == "" {
+				return nil, fmt.Errorf("endpoints %s have no port %s", endpoints.Metadata.Name, p.cfg.port)
+			}
+
+			for _, address := range subset.Addresses {
+				instance := MinioInstance{
+					ID:   net.JoinHostPort(address.IP, port),
+					Host: address.IP,
+					Port: port,
+				}
+				if address.TargetRef != nil && address.TargetRef.Kind == "Pod" {
+					instance.ID = address.TargetRef.Name
+				}
+
+				instance.AccessKey = creds.AccessKey
+				instance.SecretKey = creds.SecretKey
+				instances = append(instances, instance)
+			}
+		}
+	}
+
+	return instances, nil
+}
+
+// credentials returns the configured Secret, or the credentials in the
+// environment of pod.
+func (p *KubernetesProvider) credentials(ctx context.Context, secrets *secretCache, pod *kubePod) (Credentials, error) {
+	if p.cfg.secretName != "" {
+		accessKey, err := secrets.value(ctx, p.cfg.secretName, p.cfg.secretAccessKey)
+		if err != nil {
+			return Credentials{}, err
+		}
+		secretKey, err := secrets.value(ctx, p.cfg.secretName, p.cfg.secretSecretKey)
+		if err != nil {
+			return Credentials{}, err
+		}
+		return Credentials{AccessKey: accessKey, SecretKey: secretKey}, nil
+	}
+	if pod == nil {
+		return Credentials{}, fmt.Errorf("no pod or credentials secret to read credentials from")
+	}
+
+	lookup := func(names ...string) (string, error) {
+		for _, name := range names {
+			for _, container := range pod.Spec.Containers {
+				for _, env := range container.Env {
+					if env.Name != name {
+						continue
+					}
+					if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil {
+						return secrets.value(ctx, env.ValueFrom.SecretKeyRef.Name, env.ValueFrom.SecretKeyRef.Key)
+					}
+					if env.Value != "" {
+						return env.Value, nil
+					}
+				}
+			}
+		}
+		return "", nil
+	}
+
+	accessKey, err := lookup("MINIO_ACCESS_KEY", "MINIO_ROOT_USER")
+	if err != nil {
+		return Credentials{}, err
+	}
+	secretKey, err := lookup("MINIO_SECRET_KEY", "MINIO_ROOT_PASSWORD")
+	if err != nil {
+		return Credentials{}, err
+	}
+	if accessKey == "" || secretKey == "" {
+		return Credentials{}, fmt.Errorf("missing minio credentials in environment")
+	}
+
+	return Credentials{AccessKey: accessKey, SecretKey: secretKey}, nil
+}
+
+// Changes watches the Pods or Endpoints and reports every event. The watch is
+// opened again after it ends or fails.
+func (p *KubernetesProvider) Changes(ctx context.Context) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+	resource := "pods"
+	if p.cfg.endpoints {
+		resource = "endpoints"
+	}
+
+	query := p.selectorQuery()
+	query.Set("watch", "true")
+
+	go func() {
+		defer close(changes)
+		for {
+			err := p.client.watch(ctx, p.resourcePath(resource), query, func() {
+				select {
+				case changes <- struct{}{}:
+				default:
+				}
+			})
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				log.Printf("kubernetes watch of %s failed: %v", resource, err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(watchRetryDelay):
+			}
+		}
+	}()
+
+	return changes
+}
+
+func (p *KubernetesProvider) resourcePath(resource string) string {
+	return fmt.Sprintf("/api/v1/namespaces/%s/%s", url.PathEscape(p.cfg.namespace), resource)
+}
+
+func (p *KubernetesProvider) selectorQuery() url.Values {
+	query := url.Values{}
+	if p.selector != "" {
+		query.Set("labelSelector", p.selector)
+	}
+	return query
+}
+
+func podReady(pod kubePod) bool {
+	if pod.Metadata.DeletionTimestamp != nil || pod.Status.Phase != "Running" || pod.Status.PodIP == "" {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == "Ready" {
+			return condition.Status == "True"
+		}
+	}
+	return false
+}
+
+// podPort resolves port against the container ports of pod. A number is used
+// as it is even when the container does not declare it.
+func podPort(pod kubePod, port string) (string, error) {
+	for _, container := range pod.Spec.Containers {
+		for _, containerPort := range container.Ports {
+			if containerPort.Name == port {
+				return strconv.Itoa(containerPort.ContainerPort), nil
+			}
+		}
+	}
+	if _, err := strconv.Atoi(port); err == nil {
+		return port, nil
+	}
+	return "", fmt.Errorf("no container port named %s", port)
+}
+
+// secretCache reads each Secret at most once per discovery.
+type secretCache struct {
+	provider *KubernetesProvider
+	secrets  map[string]kubeSecret
+}
+
+func newSecretCache(provider *KubernetesProvider) *secretCache {
+	return &secretCache{provider: provider, secrets: make(map[string]kubeSecret)}
+}
+
+func (c *secretCache) value(ctx context.Context, name, key string) (string, error) {
+	secret, ok := c.secrets[name]
+	if !ok {
+		if err := c.provider.client.getJSON(ctx, c.provider.resourcePath("secrets/"+name), nil, &secret); err != nil {
+			return "", fmt.Errorf("failed to get secret %s: %w", name, err)
+		}
+		c.secrets[name] = secret
+	}
+
+	encoded, ok := secret.Data[key]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no key %s", name, key)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("secret %s key %s is not base64: %w", name, key, err)
+	}
+	return string(decoded), nil
+}
+
+// kubeClient is a minimal Kubernetes REST client.
+type kubeClient struct {
+	server     string
+	token      string
+	tokenFile  string
+	httpClient *http.Client
+}
+
+func (kc *kubeClient) newRequest(ctx context.Context, path string, query url.Values) (*http.Request, error) {
+	target := kc.server + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	token := kc.token
+	if kc.tokenFile != "" {
+		// Service account tokens are rotated, so the file is read each time.
+		data, err := os.ReadFile(kc.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read service account token: %w", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+func (kc *kubeClient) do(req *http.Request) (*http.Response, error) {
+	resp, err := kc.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes request failed: %w", err)
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		defer resp.Body.Close()
+		bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("kubernetes API returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(bodyBytes)))
+	}
+	return resp, nil
+}
+
+func (kc *kubeClient) getJSON(ctx context.Context, path string, query url.Values, out any) error {
+	req, err := kc.newRequest(ctx, path, query)
+	if err != nil {
+		return err
+	}
+	resp, err := kc.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode kubernetes response: %w", err)
+	}
+	return nil
+}
+
+// watch streams watch events of path and calls onEvent for each until the
+// stream ends.
+func (kc *kubeClient) watch(ctx context.Context, path string, query url.Values, onEvent func()) error {
+	req, err := kc.newRequest(ctx, path, query)
+	if err != nil {
+		return err
+	}
+	resp, err := kc.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(bufio.NewReader(resp.Body))
+	for {
+		var event struct {
+			Type string `json:"type"`
+		}
+		if err := decoder.Decode(&event); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("failed to decode watch event: %w", err)
+		}
+		if event.Type == "ERROR" {
+			return fmt.Errorf("watch returned an error event")
+		}
+		onEvent()
+	}
+}
+
+func inClusterKubeClient() (*kubeClient, string, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, "", fmt.Errorf("not running in a kubernetes cluster and no kubeconfig given")
+	}
+
+	caData, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read service account CA: %w", err)
+	}
+	tlsConfig, err := kubeTLSConfig(caData, nil, nil, false)
+	if err != nil {
+		return nil, "", err
+	}
+
+	namespace := ""
+	if data, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace")); err == nil {
+		namespace = strings.TrimSpace(string(data))
+	}
+
+	return &kubeClient{
+		server:     "https://" + net.JoinHostPort(host, port),
+		tokenFile:  filepath.Join(serviceAccountDir, "token"),
+		httpClient: &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}},
+	}, namespace, nil
+}
+
+type kubeconfigFile struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster   string `yaml:"cluster"`
+			User      string `yaml:"user"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string `yaml:"token"`
+			TokenFile             string `yaml:"tokenFile"`
+			ClientCertificate     string `yaml:"client-certificate"`
+			ClientCertificateData string `yaml:"client-certificate-data"`
+			ClientKey             string `yaml:"client-key"`
+			ClientKeyData         string `yaml:"client-key-data"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+// kubeClientFromKubeconfig uses the current context of a kubeconfig file.
+// Token, token file and client certificate users are supported; exec and
+// auth provider plugins are not.
+func kubeClientFromKubeconfig(path string) (*kubeClient, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read kubeconfig: %w", err)
+	}
+	var kubeconfig kubeconfigFile
+	if err := yaml.Unmarshal(data, &kubeconfig); err != nil {
+		return nil, "", fmt.Errorf("failed to parse kubeconfig: %w", err)
+	}
+
+	contextIndex := -1
+	for i, candidate := range kubeconfig.Contexts {
+		if candidate.Name == kubeconfig.CurrentContext {
+			contextIndex = i
+			break
+		}
+	}
+	if contextIndex < 0 {
+		return nil, "", fmt.Errorf("kubeconfig context %q not found", kubeconfig.CurrentContext)
+	}
+	current := kubeconfig.Contexts[contextIndex].Context
+
+	client := &kubeClient{}
+	var tlsConfig *tls.Config
+	base := filepath.Dir(path)
+
+	found := false
+	for _, cluster := range kubeconfig.Clusters {
+		if cluster.Name != current.Cluster {
+			continue
+		}
+		found = true
+		client.server = strings.TrimSuffix(cluster.Cluster.Server, "/")
+
+		caData, err := kubeconfigData(base, cluster.Cluster.CertificateAuthority, cluster.Cluster.CertificateAuthorityData)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid kubeconfig cluster %s: %w", cluster.Name, err)
+		}
+		var certData, keyData []byte
+		for _, user := range kubeconfig.Users {
+			if user.Name != current.User {
+				continue
+			}
+			client.token = user.User.Token
+			if user.User.TokenFile != "" {
+				client.tokenFile = resolvePath(base, user.User.TokenFile)
+			}
+			if certData, err = kubeconfigData(base, user.User.ClientCertificate, user.User.ClientCertificateData); err != nil {
+				return nil, "", fmt.Errorf("invalid kubeconfig user %s: %w", user.Name, err)
+			}
+			if keyData, err = kubeconfigData(base, user.User.ClientKey, user.User.ClientKeyData); err != nil {
+				return nil, "", fmt.Errorf("invalid kubeconfig user %s: %w", user.Name, err)
+			}
+		}
+
+		if tlsConfig, err = kubeTLSConfig(caData, certData, keyData, cluster.Cluster.InsecureSkipTLSVerify); err != nil {
+			return nil, "", err
+		}
+	}
+	if !found || client.server == "" {
+		return nil, "", fmt.Errorf("kubeconfig cluster %q not found", current.Cluster)
+	}
+
+	client.httpClient = &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	return client, current.Namespace, nil
+}
+
+// kubeconfigData returns inline base64 data, or the contents of the file
+// relative to the kubeconfig directory.
+func kubeconfigData(base, file, data string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if file != "" {
+		return os.ReadFile(resolvePath(base, file))
+	}
+	return nil, nil
+}
+
+func resolvePath(base, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(base, path)
+}
+
+func kubeTLSConfig(caData, certData, keyData []byte, insecure bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: insecure}
+	if len(caData) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("no certificates found in kubernetes CA")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if len(certData) > 0 || len(keyData) > 0 {
+		cert, err := tls.X509KeyPair(certData, keyData)
+		if err != nil {
+			return nil, fmt.Errorf("invalid kubernetes client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
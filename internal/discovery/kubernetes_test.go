@@ -0,0 +1,380 @@
+package discovery
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const fakeToken = "test-token"
+
+// fakeKubeAPI serves fixed JSON documents by path and records the label
+// selectors it was asked for.
+type fakeKubeAPI struct {
+	documents map[string]string
+	watch     chan string
+	selectors chan string
+}
+
+func (f *fakeKubeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+fakeToken {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	select {
+	case f.selectors <- r.URL.Query().Get("labelSelector"):
+	default:
+	}
+
+	if r.URL.Query().Get("watch") == "true" {
+		w.Header().Set("Content-Type", "application/json")
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event := <-f.watch:
+				fmt.Fprintln(w, event)
+				w.(http.Flusher).Flush()
+			}
+		}
+	}
+
+	document, ok := f.documents[r.URL.Path]
+	if !ok {
+		http.Error(w, `{"kind":"Status","reason":"NotFound"}`, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, document)
+}
+
+// newFakeKubeAPI starts a TLS API server and writes a kubeconfig for it.
+func newFakeKubeAPI(t *testing.T, documents map[string]string) (*fakeKubeAPI, string) {
+	t.Helper()
+
+	api := &fakeKubeAPI{
+		documents: documents,
+		watch:     make(chan string, 4),
+		selectors: make(chan string, 16),
+	}
+	server := httptest.NewTLSServer(api)
+	t.Cleanup(server.Close)
+
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	kubeconfig := fmt.Sprintf(`apiVersion: v1
+kind: Config
+current-context: test
+clusters:
+  - name: test-cluster
+    cluster:
+      server: %s
+      certificate-authority-data: %s
+contexts:
+  - name: test
+    context:
+      cluster: test-cluster
+      user: test-user
+      namespace: storage
+users:
+  - name: test-user
+    user:
+      token: %s
+`, server.URL, base64.StdEncoding.EncodeToString(caPEM), fakeToken)
+
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(path, []byte(kubeconfig), 0o600); err != nil {
+		t.Fatalf("failed to write kubeconfig: %v", err)
+	}
+	return api, path
+}
+
+func secretDocument(data map[string]string) string {
+	encoded := make([]string, 0, len(data))
+	for key, value := range data {
+		encoded = append(encoded, fmt.Sprintf("%q: %q", key, base64.StdEncoding.EncodeToString([]byte(value))))
+	}
+	return `{"data": {` + strings.Join(encoded, ",") + `}}`
+}
+
+const podList = `{"items": [
+  {
+    "metadata": {"name": "minio-1", "namespace": "storage"},
+    "spec": {"containers": [{
+      "env": [
+        {"name": "MINIO_ROOT_USER", "value": "maglev"},
+        {"name": "MINIO_ROOT_PASSWORD", "valueFrom": {"secretKeyRef": {"name": "minio-creds", "key": "password"}}}
+      ],
+      "ports": [{"name": "api", "containerPort": 9100}]
+    }]},
+    "status": {"phase": "Running", "podIP": "10.1.0.2", "conditions": [{"type": "Ready", "status": "True"}]}
+  },
+  {
+    "metadata": {"name": "minio-0", "namespace": "storage"},
+    "spec": {"containers": [{
+      "env": [
+        {"name": "MINIO_ACCESS_KEY", "value": "ring"},
+        {"name": "MINIO_SECRET_KEY", "value": "treepotato"}
+      ],
+      "ports": [{"name": "api", "containerPort": 9000}]
+    }]},
+    "status": {"phase": "Running", "podIP": "10.1.0.1", "conditions": [{"type": "Ready", "status": "True"}]}
+  },
+  {
+    "metadata": {"name": "minio-2", "namespace": "storage"},
+    "spec": {"containers": [{}]},
+    "status": {"phase": "Running", "podIP": "10.1.0.3", "conditions": [{"type": "Ready", "status": "False"}]}
+  },
+  {
+    "metadata": {"name": "minio-3", "namespace": "storage", "deletionTimestamp": "2026-10-18T00:00:00Z"},
+    "spec": {"containers": [{}]},
+    "status": {"phase": "Running", "podIP": "10.1.0.4", "conditions": [{"type": "Ready", "status": "True"}]}
+  }
+]}`
+
+func TestKubernetesProviderPods(t *testing.T) {
+	api, kubeconfig := newFakeKubeAPI(t, map[string]string{
+		"/api/v1/namespaces/storage/pods":                podList,
+		"/api/v1/namespaces/storage/secrets/minio-creds": secretDocument(map[string]string{"password": "baconpapaya"}),
+	})
+
+	provider, err := NewKubernetesProvider("app=minio", WithKubeconfig(kubeconfig), WithKubernetesPort("api"))
+	if err != nil {
+		t.Fatalf("NewKubernetesProvider() unexpected error: %v", err)
+	}
+
+	instances, err := provider.Discover(context.Background())
+	if err != nil {
+		t.Fatalf("Discover() unexpected error: %v", err)
+	}
+
+	want := []MinioInstance{
+		{ID: "minio-0", Host: "10.1.0.1", Port: "9000", AccessKey: "ring", SecretKey: "treepotato"},
+		{ID: "minio-1", Host: "10.1.0.2", Port: "9100", AccessKey: "maglev", SecretKey: "baconpapaya"},
+	}
+	if len(instances) != len(want) {
+		t.Fatalf("Discover() returned %+v, want %+v", instances, want)
+	}
+	for i := range want {
+		if instances[i] != want[i] {
+			t.Fatalf("instance %d = %+v, want %+v", i, instances[i], want[i])
+		}
+	}
+	if selector := <-api.selectors; selector != "app=minio" {
+		t.Fatalf("label selector = %q, want app=minio", selector)
+	}
+}
+
+func TestKubernetesProviderEndpoints(t *testing.T) {
+	_, kubeconfig := newFakeKubeAPI(t, map[string]string{
+		"/api/v1/namespaces/minio/endpoints": `{"items": [{
+			"metadata": {"name": "minio"},
+			"subsets": [{
+				"addresses": [
+					{"ip": "10.2.0.1", "targetRef": {"kind": "Pod", "name": "minio-0"}},
+					{"ip": "10.2.0.2"}
+				],
+				"ports": [{"name": "console", "port": 9001}, {"name": "api", "port": 9000}]
+			}]
+		}]}`,
+		"/api/v1/namespaces/minio/secrets/gateway": secretDocument(map[string]string{"user": "gateway", "pass": "secret"}),
+	})
+
+	provider, err := NewKubernetesProvider("app=minio",
+		WithKubeconfig(kubeconfig),
+		WithNamespace("minio"),
+		WithEndpoints(),
+		WithKubernetesPort("api"),
+		WithCredentialsSecret("gateway", "user", "pass"),
+	)
+	if err != nil {
+		t.Fatalf("NewKubernetesProvider() unexpected error: %v", err)
+	}
+
+	instances, err := provider.Discover(context.Background())
+	if err != nil {
+		t.Fatalf("Discover() unexpected error: %v", err)
+	}
+
+	want := []MinioInstance{
+		{ID: "10.2.0.2:9000", Host: "10.2.0.2", Port: "9000", AccessKey: "gateway", SecretKey: "secret"},
+		{ID: "minio-0", Host: "10.2.0.1", Port: "9000", AccessKey: "gateway", SecretKey: "secret"},
+	}
+	if len(instances) != len(want) {
+		t.Fatalf("Discover() returned %+v, want %+v", instances, want)
+	}
+	for i := range want {
+		if instances[i] != want[i] {
+			t.Fatalf("instance %d = %+v, want %+v", i, instances[i], want[i])
+		}
+	}
+}
+
+func TestKubernetesProviderErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []KubernetesOption
+		documents map[string]string
+		wantErr   string
+	}{
+		{
+			name:      "no ready pods",
+			documents: map[string]string{"/api/v1/namespaces/storage/pods": `{"items": []}`},
+			wantErr:   "no minio instances found",
+		},
+		{
+			name:    "missing secret",
+			wantErr: "failed to get secret minio-creds",
+			documents: map[string]string{"/api/v1/namespaces/storage/pods": `{"items": [{
+				"metadata": {"name": "minio-0"},
+				"spec": {"containers": [{"env": [
+					{"name": "MINIO_ROOT_USER", "value": "user"},
+					{"name": "MINIO_ROOT_PASSWORD", "valueFrom": {"secretKeyRef": {"name": "minio-creds", "key": "password"}}}
+				]}]},
+				"status": {"phase": "Running", "podIP": "10.1.0.1", "conditions": [{"type": "Ready", "status": "True"}]}
+			}]}`},
+		},
+		{
+			name:    "every pod invalid",
+			opts:    []KubernetesOption{WithKubernetesPort("api")},
+			wantErr: "no minio instances found: 1 pod(s) skipped\ninvalid minio pod minio-0: no container port named api",
+			documents: map[string]string{"/api/v1/namespaces/storage/pods": `{"items": [{
+				"metadata": {"name": "minio-0"},
+				"spec": {"containers": [{"ports": [{"name": "console", "containerPort": 9001}]}]},
+				"status": {"phase": "Running", "podIP": "10.1.0.1", "conditions": [{"type": "Ready", "status": "True"}]}
+			}]}`},
+		},
+		{
+			name:      "list failure",
+			documents: map[string]string{},
+			wantErr:   "failed to list pods",
+		},
+		{
+			name:    "endpoints without the configured port",
+			opts:    []KubernetesOption{WithEndpoints(), WithKubernetesPort("api"), WithCredentialsSecret("gateway", "user", "pass")},
+			wantErr: "endpoints minio have no port api",
+			documents: map[string]string{
+				"/api/v1/namespaces/storage/endpoints": `{"items": [{
+					"metadata": {"name": "minio"},
+					"subsets": [{"addresses": [{"ip": "10.2.0.1"}], "ports": [{"name": "console", "port": 9001}]}]
+				}]}`,
+				"/api/v1/namespaces/storage/secrets/gateway": secretDocument(map[string]string{"user": "gateway", "pass": "secret"}),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, kubeconfig := newFakeKubeAPI(t, tt.documents)
+			provider, err := NewKubernetesProvider("app=minio", append(tt.opts, WithKubeconfig(kubeconfig))...)
+			if err != nil {
+				t.Fatalf("NewKubernetesProvider() unexpected error: %v", err)
+			}
+
+			_, err = provider.Discover(context.Background())
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Discover() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKubernetesProviderSkipsInvalidPods(t *testing.T) {
+	_, kubeconfig := newFakeKubeAPI(t, map[string]string{
+		"/api/v1/namespaces/storage/pods": `{"items": [
+			{
+				"metadata": {"name": "minio-0"},
+				"spec": {"containers": [{
+					"env": [{"name": "MINIO_ROOT_USER", "value": "user"}, {"name": "MINIO_ROOT_PASSWORD", "value": "password"}],
+					"ports": [{"name": "api", "containerPort": 9000}]
+				}]},
+				"status": {"phase": "Running", "podIP": "10.1.0.1", "conditions": [{"type": "Ready", "status": "True"}]}
+			},
+			{
+				"metadata": {"name": "minio-1"},
+				"spec": {"containers": [{
+					"env": [{"name": "MINIO_ROOT_USER", "value": "user"}, {"name": "MINIO_ROOT_PASSWORD", "value": "password"}],
+					"ports": [{"name": "console", "containerPort": 9001}]
+				}]},
+				"status": {"phase": "Running", "podIP": "10.1.0.2", "conditions": [{"type": "Ready", "status": "True"}]}
+			},
+			{
+				"metadata": {"name": "minio-2"},
+				"spec": {"containers": [{"ports": [{"name": "api", "containerPort": 9000}]}]},
+				"status": {"phase": "Running", "podIP": "10.1.0.3", "conditions": [{"type": "Ready", "status": "True"}]}
+			}
+		]}`,
+	})
+
+	provider, err := NewKubernetesProvider("app=minio", WithKubeconfig(kubeconfig), WithKubernetesPort("api"))
+	if err != nil {
+		t.Fatalf("NewKubernetesProvider() unexpected error: %v", err)
+	}
+
+	instances, err := provider.Discover(context.Background())
+	if err != nil {
+		t.Fatalf("Discover() unexpected error: %v", err)
+	}
+	want := MinioInstance{ID: "minio-0", Host: "10.1.0.1", Port: "9000", AccessKey: "user", SecretKey: "password"}
+	if len(instances) != 1 || instances[0] != want {
+		t.Fatalf("Discover() returned %+v, want only %+v", instances, want)
+	}
+}
+
+func TestKubernetesProviderEndpointsNeedSecret(t *testing.T) {
+	_, kubeconfig := newFakeKubeAPI(t, nil)
+	_, err := NewKubernetesProvider("app=minio", WithKubeconfig(kubeconfig), WithEndpoints())
+	if err == nil || !strings.Contains(err.Error(), "needs a credentials secret") {
+		t.Fatalf("NewKubernetesProvider() error = %v, want a missing secret error", err)
+	}
+}
+
+func TestKubernetesProviderChanges(t *testing.T) {
+	api, kubeconfig := newFakeKubeAPI(t, nil)
+	provider, err := NewKubernetesProvider("app=minio", WithKubeconfig(kubeconfig))
+	if err != nil {
+		t.Fatalf("NewKubernetesProvider() unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := provider.Changes(ctx)
+
+	api.watch <- `{"type": "ADDED", "object": {"metadata": {"name": "minio-0"}}}`
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch event was not reported")
+	}
+
+	cancel()
+	select {
+	case _, ok := <-changes:
+		if ok {
+			// A pending notification may still be buffered.
+			if _, ok := <-changes; ok {
+				t.Fatal("changes channel was not closed")
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("changes channel was not closed")
+	}
+}
+
+func TestKubeconfigErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(path, []byte("current-context: missing\n"), 0o600); err != nil {
+		t.Fatalf("failed to write kubeconfig: %v", err)
+	}
+
+	if _, err := NewKubernetesProvider("app=minio", WithKubeconfig(path)); err == nil || !strings.Contains(err.Error(), `context "missing" not found`) {
+		t.Fatalf("NewKubernetesProvider() error = %v, want missing context", err)
+	}
+}
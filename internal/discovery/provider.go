@@ -0,0 +1,48 @@
+package discovery
+
+import "context"
+
+// MinioInstance represents a discovered Minio instance.
+type MinioInstance struct {
+	ID        string `json:"id" yaml:"id"`
+	Host      string `json:"host" yaml:"host"`
+	Port      string `json:"port" yaml:"port"`
+	AccessKey string `json:"accessKey" yaml:"accessKey"`
+	SecretKey string `json:"secretKey" yaml:"secretKey"`
+	// Weight scales the share of objects placed on the instance; zero
+	// counts as 1.
+	Weight int    `json:"weight,omitempty" yaml:"weight,omitempty"`
+	Zone   string `json:"zone,omitempty" yaml:"zone,omitempty"`
+	// Secure connects to the instance over TLS.
+	Secure bool `json:"secure,omitempty" yaml:"secure,omitempty"`
+}
+
+// Provider finds Minio instances from one source, such as the Docker daemon
+// or a static list.
+type Provider interface {
+	// Discover returns the instances currently available. It fails rather
+	// than returning an empty list.
+	Discover(ctx context.Context) ([]MinioInstance, error)
+}
+
+// Notifier is implemented by providers that can report changes as they
+// happen instead of waiting for the next refresh.
+type Notifier interface {
+	// Changes returns a channel that receives a value whenever the instances
+	// may have changed. It is closed when ctx is done.
+	Changes(ctx context.Context) <-chan struct{}
+}
+
+// ExcludedInstance is a candidate a provider left out of its last result.
+type ExcludedInstance struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// ExclusionReporter is implemented by providers that leave out candidates
+// which are not fit to serve, such as stopped or unhealthy containers.
+type ExclusionReporter interface {
+	// Excluded returns the candidates left out by the last Discover call.
+	Excluded() []ExcludedInstance
+}
@@ -0,0 +1,83 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// StaticProvider reads a fixed list of instances from a YAML or JSON file:
+//
+//	instances:
+//	  - id: node-1
+//	    host: 10.0.0.5
+//	    port: "9000"
+//	    accessKey: gateway
+//	    secretKey: secret
+//
+// The port defaults to DefaultAPIPort and the ID to host:port.
+type StaticProvider struct {
+	path string
+}
+
+type staticFile struct {
+	Instances []MinioInstance `json:"instances" yaml:"instances"`
+}
+
+// NewStaticProvider returns a provider reading the instance file at path.
+func NewStaticProvider(path string) *StaticProvider {
+	return &StaticProvider{path: path}
+}
+
+// Discover reads and validates the instance file.
+func (p *StaticProvider) Discover(ctx context.Context) ([]MinioInstance, error) {
+	file, err := os.Open(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open instance file: %w", err)
+	}
+	defer file.Close()
+
+	return parseStaticInstances(file)
+}
+
+func parseStaticInstances(r io.Reader) ([]MinioInstance, error) {
+	var parsed staticFile
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&parsed); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse instance file: %w", err)
+	}
+	if len(parsed.Instances) == 0 {
+		return nil, fmt.Errorf("no minio instances found")
+	}
+
+	seen := make(map[string]bool, len(parsed.Instances))
+	instances := make([]MinioInstance, 0, len(parsed.Instances))
+	for i, instance := range parsed.Instances {
+		if instance.Host == "" {
+			return nil, fmt.Errorf("instance %d: host is required", i)
+		}
+		if instance.Port == "" {
+			instance.Port = DefaultAPIPort
+		}
+		if instance.ID == "" {
+			instance.ID = net.JoinHostPort(instance.Host, instance.Port)
+		}
+		if instance.AccessKey == "" || instance.SecretKey == "" {
+			return nil, fmt.Errorf("instance %s: missing minio credentials", instance.ID)
+		}
+		if seen[instance.ID] {
+			return nil, fmt.Errorf("instance %s: duplicate id", instance.ID)
+		}
+		seen[instance.ID] = true
+
+		instances = append(instances, instance)
+	}
+
+	return instances, nil
+}
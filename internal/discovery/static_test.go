@@ -0,0 +1,95 @@
+package discovery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseStaticInstances(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []MinioInstance
+		wantErr string
+	}{
+		{
+			name: "yaml with defaults",
+			input: `
+instances:
+  - host: 10.0.0.5
+    accessKey: ring
+    secretKey: treepotato
+  - id: node-2
+    host: 10.0.0.6
+    port: "9100"
+    accessKey: maglev
+    secretKey: baconpapaya
+`,
+			want: []MinioInstance{
+				{ID: "10.0.0.5:9000", Host: "10.0.0.5", Port: "9000", AccessKey: "ring", SecretKey: "treepotato"},
+				{ID: "node-2", Host: "10.0.0.6", Port: "9100", AccessKey: "maglev", SecretKey: "baconpapaya"},
+			},
+		},
+		{
+			name:  "json",
+			input: `{"instances": [{"id": "a", "host": "minio.internal", "accessKey": "k", "secretKey": "s"}]}`,
+			want:  []MinioInstance{{ID: "a", Host: "minio.internal", Port: "9000", AccessKey: "k", SecretKey: "s"}},
+		},
+		{name: "empty", input: "", wantErr: "no minio instances found"},
+		{name: "missing host", input: `{"instances": [{"accessKey": "k", "secretKey": "s"}]}`, wantErr: "host is required"},
+		{name: "missing credentials", input: `{"instances": [{"host": "h", "accessKey": "k"}]}`, wantErr: "missing minio credentials"},
+		{
+			name:    "duplicate id",
+			input:   `{"instances": [{"id": "a", "host": "h1", "accessKey": "k", "secretKey": "s"}, {"id": "a", "host": "h2", "accessKey": "k", "secretKey": "s"}]}`,
+			wantErr: "duplicate id",
+		},
+		{name: "unknown field", input: `{"instances": [{"hostname": "h"}]}`, wantErr: "failed to parse"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseStaticInstances(strings.NewReader(tt.input))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseStaticInstances() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseStaticInstances() unexpected error: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseStaticInstances() returned %d instances, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("instance %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestStaticProviderDiscover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "instances.yaml")
+	content := "instances:\n  - id: node-1\n    host: 10.0.0.5\n    accessKey: ring\n    secretKey: treepotato\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write instance file: %v", err)
+	}
+
+	var provider Provider = NewStaticProvider(path)
+	instances, err := provider.Discover(context.Background())
+	if err != nil {
+		t.Fatalf("Discover() unexpected error: %v", err)
+	}
+	if len(instances) != 1 || instances[0].ID != "node-1" {
+		t.Fatalf("Discover() = %+v, want node-1", instances)
+	}
+
+	if _, err := NewStaticProvider(filepath.Join(t.TempDir(), "missing.yaml")).Discover(context.Background()); err == nil {
+		t.Fatal("Discover() expected error for missing file")
+	}
+}
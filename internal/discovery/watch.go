@@ -0,0 +1,158 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+type watchConfig struct {
+	refreshRequests <-chan struct{}
+}
+
+// WatchOption configures Watch.
+type WatchOption func(*watchConfig)
+
+// WithRefreshRequests also runs discovery whenever a value arrives on
+// requests, for example after a backend rejected the gateway's credentials.
+func WithRefreshRequests(requests <-chan struct{}) WatchOption {
+	return func(cfg *watchConfig) {
+		cfg.refreshRequests = requests
+	}
+}
+
+// Watch runs provider every interval, whenever a Notifier provider reports a
+// change, and on refresh requests, until ctx is done. It calls apply when the discovered
+// instances differ from the last applied set, which starts as current.
+// Failed discoveries and rejected updates are logged and retried on the next
+// tick, so the gateway keeps the instances it has.
+func Watch(ctx context.Context, provider Provider, interval time.Duration, current []MinioInstance, apply func([]MinioInstance) error, opts ...WatchOption) {
+	var cfg watchConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var changes <-chan struct{}
+	if notifier, ok := provider.(Notifier); ok {
+		changes = notifier.Changes(ctx)
+	}
+
+	current = sortedByID(current)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case _, ok := <-changes:
+			if !ok {
+				return
+			}
+		case <-cfg.refreshRequests:
+		}
+
+		discoverCtx, cancel := context.WithTimeout(ctx, interval)
+		instances, err := provider.Discover(discoverCtx)
+		cancel()
+		if err != nil {
+			log.Printf("discovery refresh failed: %v", err)
+			continue
+		}
+
+		instances = sortedByID(instances)
+		if slices.Equal(instances, current) {
+			continue
+		}
+		if err := apply(instances); err != nil {
+			log.Printf("failed to apply discovered instances: %v", err)
+			continue
+		}
+
+		log.Printf("discovery refresh applied %d minio instance(s)", len(instances))
+		current = instances
+	}
+}
+
+type waitConfig struct {
+	minInstances   int
+	attemptTimeout time.Duration
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+// WaitOption configures WaitForInstances.
+type WaitOption func(*waitConfig)
+
+// WithMinInstances waits until at least n instances are discovered.
+func WithMinInstances(n int) WaitOption {
+	return func(cfg *waitConfig) {
+		cfg.minInstances = n
+	}
+}
+
+// WithAttemptTimeout limits each discovery attempt to timeout.
+func WithAttemptTimeout(timeout time.Duration) WaitOption {
+	return func(cfg *waitConfig) {
+		cfg.attemptTimeout = timeout
+	}
+}
+
+// WithBackoff waits initial after the first failed attempt, doubling the
+// delay after each further failure up to max.
+func WithBackoff(initial, max time.Duration) WaitOption {
+	return func(cfg *waitConfig) {
+		cfg.initialBackoff = initial
+		cfg.maxBackoff = max
+	}
+}
+
+// WaitForInstances runs provider until it finds enough instances, backing
+// off exponentially between attempts, so the gateway can start before its
+// storage nodes. It gives up with the last failure when ctx is done.
+func WaitForInstances(ctx context.Context, provider Provider, opts ...WaitOption) ([]MinioInstance, error) {
+	cfg := waitConfig{
+		minInstances:   1,
+		attemptTimeout: 10 * time.Second,
+		initialBackoff: time.Second,
+		maxBackoff:     30 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	backoff := cfg.initialBackoff
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, cfg.attemptTimeout)
+		instances, err := provider.Discover(attemptCtx)
+		cancel()
+		if err == nil && len(instances) < cfg.minInstances {
+			err = fmt.Errorf("found %d minio instance(s), waiting for %d", len(instances), cfg.minInstances)
+		}
+		if err == nil {
+			return instances, nil
+		}
+
+		log.Printf("discovery attempt %d failed: %v; retrying in %s", attempt, err, backoff)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("gave up after %d attempt(s): %w", attempt, err)
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, cfg.maxBackoff)
+	}
+}
+
+func sortedByID(instances []MinioInstance) []MinioInstance {
+	sorted := slices.Clone(instances)
+	slices.SortFunc(sorted, func(a, b MinioInstance) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return sorted
+}
@@ -0,0 +1,164 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type sequenceProvider struct {
+	mu      sync.Mutex
+	results [][]MinioInstance
+}
+
+func (s *sequenceProvider) Discover(ctx context.Context) ([]MinioInstance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.results) == 0 {
+		return nil, errors.New("no more results")
+	}
+	result := s.results[0]
+	if len(s.results) > 1 {
+		s.results = s.results[1:]
+	}
+	if result == nil {
+		return nil, errors.New("lookup failed")
+	}
+	return result, nil
+}
+
+func TestWatchAppliesChanges(t *testing.T) {
+	first := []MinioInstance{{ID: "a"}, {ID: "b"}}
+	second := []MinioInstance{{ID: "c"}, {ID: "a"}, {ID: "b"}}
+	provider := &sequenceProvider{results: [][]MinioInstance{
+		{{ID: "b"}, {ID: "a"}}, // unchanged apart from order
+		nil,                    // failed discovery keeps the current set
+		second,
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	applied := make(chan []MinioInstance, 4)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Watch(ctx, provider, time.Millisecond, first, func(instances []MinioInstance) error {
+			applied <- instances
+			return nil
+		})
+	}()
+
+	select {
+	case instances := <-applied:
+		if len(instances) != 3 || instances[0].ID != "a" || instances[2].ID != "c" {
+			t.Fatalf("applied %+v, want a, b, c", instances)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("change was not applied")
+	}
+
+	// The final result repeats, so nothing else is applied.
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	<-done
+	if len(applied) != 0 {
+		t.Fatalf("unchanged instances were applied again: %+v", <-applied)
+	}
+}
+
+func TestWatchRetriesRejectedUpdate(t *testing.T) {
+	provider := &sequenceProvider{results: [][]MinioInstance{{{ID: "b"}}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	calls := make(chan struct{}, 8)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Watch(ctx, provider, time.Millisecond, []MinioInstance{{ID: "a"}}, func([]MinioInstance) error {
+			select {
+			case calls <- struct{}{}:
+			default:
+			}
+			return errors.New("rejected")
+		})
+	}()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-calls:
+		case <-time.After(5 * time.Second):
+			t.Fatal("rejected update was not retried")
+		}
+	}
+	cancel()
+	<-done
+}
+
+func TestWatchRefreshesOnRequest(t *testing.T) {
+	provider := &sequenceProvider{results: [][]MinioInstance{{{ID: "a", SecretKey: "rotated"}}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	requests := make(chan struct{}, 1)
+	applied := make(chan []MinioInstance, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// The interval is far away, so only the request can trigger discovery.
+		Watch(ctx, provider, time.Hour, []MinioInstance{{ID: "a", SecretKey: "old"}}, func(instances []MinioInstance) error {
+			applied <- instances
+			return nil
+		}, WithRefreshRequests(requests))
+	}()
+
+	requests <- struct{}{}
+	select {
+	case instances := <-applied:
+		if len(instances) != 1 || instances[0].SecretKey != "rotated" {
+			t.Fatalf("applied %+v, want rotated credentials", instances)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("refresh request did not trigger discovery")
+	}
+	cancel()
+	<-done
+}
+
+func TestWaitForInstances(t *testing.T) {
+	provider := &sequenceProvider{results: [][]MinioInstance{
+		nil,         // nodes not up yet
+		{{ID: "a"}}, // fewer than the minimum
+		{{ID: "a"}, {ID: "b"}},
+	}}
+
+	instances, err := WaitForInstances(context.Background(), provider,
+		WithMinInstances(2),
+		WithBackoff(time.Millisecond, 2*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("WaitForInstances() unexpected error: %v", err)
+	}
+	if len(instances) != 2 {
+		t.Fatalf("WaitForInstances() returned %+v, want a and b", instances)
+	}
+}
+
+func TestWaitForInstancesGivesUp(t *testing.T) {
+	provider := &sequenceProvider{results: [][]MinioInstance{nil}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err := WaitForInstances(ctx, provider, WithBackoff(time.Millisecond, 5*time.Millisecond))
+	if err == nil || !strings.Contains(err.Error(), "lookup failed") {
+		t.Fatalf("WaitForInstances() error = %v, want the last failure", err)
+	}
+}
@@ -4,27 +4,68 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/irensaltali/object-storage-gateway/internal/storage"
 )
 
-// ObjectGateway captures the storage behavior handlers depend on.
+const (
+	// compressionHeader lets clients choose the storage codec for an upload.
+	compressionHeader = "X-Object-Compression"
+	// checksumHeader carries the hex SHA-256 of the object in both directions.
+	checksumHeader = "X-Checksum-SHA256"
+	// cacheHeader set to "bypass" makes a read skip the gateway's object cache.
+	cacheHeader = "X-Object-Cache"
+)
+
+type tenantContextKey struct{}
+
+// WithTenant charges the uploads of requests carrying ctx to tenant, the name
+// of an authenticated client.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenant)
+}
+
+func tenantFrom(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantContextKey{}).(string)
+	return tenant
+}
+
+// ObjectGateway captures the storage behavior handlers depend on. An empty
+// bucketName selects the default bucket.
 type ObjectGateway interface {
-	PutObject(ctx context.Context, objectKey string, data io.Reader, size int64) error
-	GetObject(ctx context.Context, objectKey string) (io.ReadCloser, error)
+	ValidateObjectKey(objectKey string) error
+	PutObject(ctx context.Context, bucketName, objectKey string, data io.Reader, size int64, opts storage.PutOptions) (storage.ObjectInfo, error)
+	GetObject(ctx context.Context, bucketName, objectKey string, opts storage.GetOptions) (*storage.Object, error)
+	StatObject(ctx context.Context, bucketName, objectKey string, opts storage.GetOptions) (storage.ObjectInfo, error)
+	DeleteObject(ctx context.Context, bucketName, objectKey string) error
+}
+
+// BucketGateway captures the bucket management behavior handlers depend on.
+type BucketGateway interface {
+	CreateBucket(ctx context.Context, bucketName string) error
+	ListBuckets(ctx context.Context) ([]string, error)
+	DeleteBucket(ctx context.Context, bucketName string) error
 }
 
-// PutObject handles the PUT /object/{id} endpoint
+// PutObject handles the PUT /object/{id} and PUT /buckets/{bucket}/objects/{id} endpoints
 func PutObject(w http.ResponseWriter, r *http.Request, gateway ObjectGateway) {
-	objectKey := mux.Vars(r)["id"]
-	log.Printf("PUT /object/%s - received request, content-length: %d", objectKey, r.ContentLength)
+	bucketName, objectKey, err := objectVars(r)
+	path := objectPath(bucketName, objectKey)
+	log.Printf("PUT %s - received request, content-length: %d", path, r.ContentLength)
 
-	if err := storage.ValidateObjectID(objectKey); err != nil {
-		log.Printf("PUT /object/%s - invalid object id: %v", objectKey, err)
+	if err == nil {
+		err = gateway.ValidateObjectKey(objectKey)
+	}
+	if err != nil {
+		log.Printf("PUT %s - invalid object id: %v", path, err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -32,80 +73,354 @@ func PutObject(w http.ResponseWriter, r *http.Request, gateway ObjectGateway) {
 	// Get content length from request header
 	contentLength := r.ContentLength
 	if contentLength < 0 {
-		log.Printf("PUT /object/%s - error: content-length header is required", objectKey)
+		log.Printf("PUT %s - error: content-length header is required", path)
 		http.Error(w, "content-length header is required", http.StatusBadRequest)
 		return
 	}
 
+	opts := storage.PutOptions{
+		ContentType:    r.Header.Get("Content-Type"),
+		Compression:    r.Header.Get(compressionHeader),
+		ContentMD5:     r.Header.Get("Content-MD5"),
+		ChecksumSHA256: r.Header.Get(checksumHeader),
+		Tenant:         tenantFrom(r.Context()),
+	}
+
 	// Store object by gateway
-	if err := gateway.PutObject(r.Context(), objectKey, r.Body, contentLength); err != nil {
+	info, err := gateway.PutObject(r.Context(), bucketName, objectKey, r.Body, contentLength, opts)
+	if err != nil {
 		if errors.Is(err, storage.ErrInvalidObjectID) {
-			log.Printf("PUT /object/%s - invalid object id: %v", objectKey, err)
+			log.Printf("PUT %s - invalid object id: %v", path, err)
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		log.Printf("PUT /object/%s - error storing object: %v", objectKey, err)
+		if errors.Is(err, storage.ErrInvalidBucketName) {
+			log.Printf("PUT %s - invalid bucket name: %v", path, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, storage.ErrBucketNotFound) {
+			log.Printf("PUT %s - bucket not found", path)
+			http.Error(w, "bucket not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, storage.ErrUnsupportedCompression) {
+			log.Printf("PUT %s - unsupported compression: %v", path, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, storage.ErrIncompleteUpload) {
+			log.Printf("PUT %s - incomplete upload: %v", path, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, storage.ErrInvalidChecksum) || errors.Is(err, storage.ErrChecksumMismatch) {
+			log.Printf("PUT %s - checksum verification failed: %v", path, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, storage.ErrQuotaExceeded) {
+			log.Printf("PUT %s - quota exceeded: %v", path, err)
+			http.Error(w, err.Error(), http.StatusInsufficientStorage)
+			return
+		}
+		log.Printf("PUT %s - error storing object: %v", path, err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("PUT /object/%s - object stored successfully", objectKey)
+	log.Printf("PUT %s - object stored successfully", path)
 
 	// Return success response
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(checksumHeader, info.ChecksumSHA256)
 	w.WriteHeader(http.StatusOK)
 
 	response := map[string]any{
 		"id":      objectKey,
 		"status":  "stored",
 		"message": "object stored successfully",
+		"sha256":  info.ChecksumSHA256,
+	}
+	if bucketName != "" {
+		response["bucket"] = bucketName
 	}
 
 	json.NewEncoder(w).Encode(response)
 }
 
-// GetObject handles the GET /object/{id} endpoint
+// GetObject handles the GET /object/{id} and GET /buckets/{bucket}/objects/{id} endpoints
 func GetObject(w http.ResponseWriter, r *http.Request, gateway ObjectGateway) {
-	objectKey := mux.Vars(r)["id"]
-	log.Printf("GET /object/%s - received request", objectKey)
+	bucketName, objectKey, err := objectVars(r)
+	path := objectPath(bucketName, objectKey)
+	log.Printf("GET %s - received request", path)
 
-	if err := storage.ValidateObjectID(objectKey); err != nil {
-		log.Printf("GET /object/%s - invalid object id: %v", objectKey, err)
+	if err == nil {
+		err = gateway.ValidateObjectKey(objectKey)
+	}
+	if err != nil {
+		log.Printf("GET %s - invalid object id: %v", path, err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	// Retrieve object from gateway
-	object, err := gateway.GetObject(r.Context(), objectKey)
+	object, err := gateway.GetObject(r.Context(), bucketName, objectKey, getOptions(r))
 	if err != nil {
 		if errors.Is(err, storage.ErrInvalidObjectID) {
-			log.Printf("GET /object/%s - invalid object id: %v", objectKey, err)
+			log.Printf("GET %s - invalid object id: %v", path, err)
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		if errors.Is(err, storage.ErrInvalidBucketName) {
+			log.Printf("GET %s - invalid bucket name: %v", path, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, storage.ErrBucketNotFound) {
+			log.Printf("GET %s - bucket not found", path)
+			http.Error(w, "bucket not found", http.StatusNotFound)
+			return
+		}
 		if errors.Is(err, storage.ErrObjectNotFound) {
-			log.Printf("GET /object/%s - object not found", objectKey)
+			log.Printf("GET %s - object not found", path)
 			http.Error(w, "object not found", http.StatusNotFound)
 			return
 		}
-		log.Printf("GET /object/%s - error retrieving object: %v", objectKey, err)
+		if errors.Is(err, storage.ErrShardsUnavailable) {
+			log.Printf("GET %s - object cannot be rebuilt: %v", path, err)
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		log.Printf("GET %s - error retrieving object: %v", path, err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	defer object.Close()
 
-	log.Printf("GET /object/%s - object found, streaming to client", objectKey)
+	log.Printf("GET %s - object found, streaming to client", path)
 
 	// Set response headers
-	w.Header().Set("Content-Type", "application/octet-stream")
+	setObjectHeaders(w, object.Info)
 	w.WriteHeader(http.StatusOK)
 
 	// Stream object data to response
 	if _, err := io.Copy(w, object); err != nil {
-		log.Printf("GET /object/%s - error streaming object: %v", objectKey, err)
+		log.Printf("GET %s - error streaming object: %v", path, err)
+		return
+	}
+
+	log.Printf("GET %s - object streamed successfully", path)
+}
+
+// HeadObject handles the HEAD /object/{id} and HEAD /buckets/{bucket}/objects/{id} endpoints
+func HeadObject(w http.ResponseWriter, r *http.Request, gateway ObjectGateway) {
+	bucketName, objectKey, err := objectVars(r)
+	path := objectPath(bucketName, objectKey)
+	log.Printf("HEAD %s - received request", path)
+
+	if err == nil {
+		err = gateway.ValidateObjectKey(objectKey)
+	}
+	if err != nil {
+		log.Printf("HEAD %s - invalid object id: %v", path, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	info, err := gateway.StatObject(r.Context(), bucketName, objectKey, getOptions(r))
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidObjectID) || errors.Is(err, storage.ErrInvalidBucketName) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, storage.ErrBucketNotFound) {
+			log.Printf("HEAD %s - bucket not found", path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			log.Printf("HEAD %s - object not found", path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		log.Printf("HEAD %s - error retrieving object metadata: %v", path, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	setObjectHeaders(w, info)
+	w.WriteHeader(http.StatusOK)
+}
+
+// DeleteObject handles the DELETE /object/{id} and DELETE /buckets/{bucket}/objects/{id} endpoints
+func DeleteObject(w http.ResponseWriter, r *http.Request, gateway ObjectGateway) {
+	bucketName, objectKey, err := objectVars(r)
+	path := objectPath(bucketName, objectKey)
+	log.Printf("DELETE %s - received request", path)
+
+	if err == nil {
+		err = gateway.ValidateObjectKey(objectKey)
+	}
+	if err != nil {
+		log.Printf("DELETE %s - invalid object id: %v", path, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("GET /object/%s - object streamed successfully", objectKey)
+	if err := gateway.DeleteObject(r.Context(), bucketName, objectKey); err != nil {
+		if errors.Is(err, storage.ErrInvalidObjectID) {
+			log.Printf("DELETE %s - invalid object id: %v", path, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, storage.ErrInvalidBucketName) {
+			log.Printf("DELETE %s - invalid bucket name: %v", path, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, storage.ErrBucketNotFound) {
+			log.Printf("DELETE %s - bucket not found", path)
+			http.Error(w, "bucket not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			log.Printf("DELETE %s - object not found", path)
+			http.Error(w, "object not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("DELETE %s - error deleting object: %v", path, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("DELETE %s - object deleted successfully", path)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateBucket handles the PUT /buckets/{bucket} endpoint
+func CreateBucket(w http.ResponseWriter, r *http.Request, gateway BucketGateway) {
+	bucketName := mux.Vars(r)["bucket"]
+	log.Printf("PUT /buckets/%s - received request", bucketName)
+
+	if err := gateway.CreateBucket(r.Context(), bucketName); err != nil {
+		if errors.Is(err, storage.ErrInvalidBucketName) {
+			log.Printf("PUT /buckets/%s - invalid bucket name: %v", bucketName, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, storage.ErrBucketExists) {
+			log.Printf("PUT /buckets/%s - bucket already exists", bucketName)
+			http.Error(w, "bucket already exists", http.StatusConflict)
+			return
+		}
+		log.Printf("PUT /buckets/%s - error creating bucket: %v", bucketName, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("PUT /buckets/%s - bucket created successfully", bucketName)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{
+		"bucket":  bucketName,
+		"status":  "created",
+		"message": "bucket created successfully",
+	})
+}
+
+// ListBuckets handles the GET /buckets endpoint
+func ListBuckets(w http.ResponseWriter, r *http.Request, gateway BucketGateway) {
+	buckets, err := gateway.ListBuckets(r.Context())
+	if err != nil {
+		log.Printf("GET /buckets - error listing buckets: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"buckets": buckets,
+	})
+}
+
+// DeleteBucket handles the DELETE /buckets/{bucket} endpoint
+func DeleteBucket(w http.ResponseWriter, r *http.Request, gateway BucketGateway) {
+	bucketName := mux.Vars(r)["bucket"]
+	log.Printf("DELETE /buckets/%s - received request", bucketName)
+
+	if err := gateway.DeleteBucket(r.Context(), bucketName); err != nil {
+		if errors.Is(err, storage.ErrInvalidBucketName) {
+			log.Printf("DELETE /buckets/%s - invalid bucket name: %v", bucketName, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, storage.ErrBucketNotFound) {
+			log.Printf("DELETE /buckets/%s - bucket not found", bucketName)
+			http.Error(w, "bucket not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, storage.ErrBucketNotEmpty) {
+			log.Printf("DELETE /buckets/%s - bucket not empty", bucketName)
+			http.Error(w, "bucket not empty", http.StatusConflict)
+			return
+		}
+		log.Printf("DELETE /buckets/%s - error deleting bucket: %v", bucketName, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("DELETE /buckets/%s - bucket deleted successfully", bucketName)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// objectVars returns the bucket and object key a request addresses. The
+// router matches on the escaped path, so both are percent-decoded here; on a
+// malformed escape the raw values are returned with the error.
+func objectVars(r *http.Request) (string, string, error) {
+	vars := mux.Vars(r)
+	bucketName, bucketErr := url.PathUnescape(vars["bucket"])
+	objectKey, keyErr := url.PathUnescape(vars["id"])
+	if bucketErr != nil || keyErr != nil {
+		return vars["bucket"], vars["id"], fmt.Errorf("%w: malformed percent-encoding", storage.ErrInvalidObjectID)
+	}
+	return bucketName, objectKey, nil
+}
+
+// objectPath returns the request path an object was addressed by, for logging.
+func objectPath(bucketName, objectKey string) string {
+	if bucketName == "" {
+		return "/object/" + objectKey
+	}
+	return "/buckets/" + bucketName + "/objects/" + objectKey
+}
+
+// getOptions collects the read settings carried by request headers.
+func getOptions(r *http.Request) storage.GetOptions {
+	return storage.GetOptions{
+		AcceptEncoding: r.Header.Get("Accept-Encoding"),
+		BypassCache:    strings.EqualFold(strings.TrimSpace(r.Header.Get(cacheHeader)), "bypass"),
+	}
+}
+
+// setObjectHeaders writes the response headers describing an object.
+func setObjectHeaders(w http.ResponseWriter, info storage.ObjectInfo) {
+	contentType := info.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Vary", "Accept-Encoding")
+	if info.ContentEncoding != "" {
+		w.Header().Set("Content-Encoding", info.ContentEncoding)
+	}
+	if info.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+	if info.ChecksumSHA256 != "" {
+		w.Header().Set(checksumHeader, info.ChecksumSHA256)
+	}
 }
@@ -11,26 +11,58 @@ import (
 	"testing"
 
 	"github.com/gorilla/mux"
+	"github.com/irensaltali/object-storage-gateway/internal/ratelimit"
 	"github.com/irensaltali/object-storage-gateway/internal/storage"
 )
 
 type mockGateway struct {
-	putObjectFn func(ctx context.Context, objectKey string, data io.Reader, size int64) error
-	getObjectFn func(ctx context.Context, objectKey string) (io.ReadCloser, error)
+	putObjectFn    func(ctx context.Context, bucketName, objectKey string, data io.Reader, size int64, opts storage.PutOptions) (storage.ObjectInfo, error)
+	getObjectFn    func(ctx context.Context, bucketName, objectKey string, opts storage.GetOptions) (*storage.Object, error)
+	statObjectFn   func(ctx context.Context, bucketName, objectKey string, opts storage.GetOptions) (storage.ObjectInfo, error)
+	deleteObjectFn func(ctx context.Context, bucketName, objectKey string) error
+	keyPolicy      *storage.KeyPolicy
 }
 
-func (m *mockGateway) PutObject(ctx context.Context, objectKey string, data io.Reader, size int64) error {
+func (m *mockGateway) ValidateObjectKey(objectKey string) error {
+	if m.keyPolicy != nil {
+		return m.keyPolicy.Validate(objectKey)
+	}
+	return storage.ValidateObjectID(objectKey)
+}
+
+func (m *mockGateway) PutObject(ctx context.Context, bucketName, objectKey string, data io.Reader, size int64, opts storage.PutOptions) (storage.ObjectInfo, error) {
 	if m.putObjectFn != nil {
-		return m.putObjectFn(ctx, objectKey, data, size)
+		return m.putObjectFn(ctx, bucketName, objectKey, data, size, opts)
 	}
-	return nil
+	return storage.ObjectInfo{Key: objectKey, Size: size}, nil
 }
 
-func (m *mockGateway) GetObject(ctx context.Context, objectKey string) (io.ReadCloser, error) {
+func (m *mockGateway) StatObject(ctx context.Context, bucketName, objectKey string, opts storage.GetOptions) (storage.ObjectInfo, error) {
+	if m.statObjectFn != nil {
+		return m.statObjectFn(ctx, bucketName, objectKey, opts)
+	}
+	return storage.ObjectInfo{Key: objectKey, Size: 2}, nil
+}
+
+func (m *mockGateway) GetObject(ctx context.Context, bucketName, objectKey string, opts storage.GetOptions) (*storage.Object, error) {
 	if m.getObjectFn != nil {
-		return m.getObjectFn(ctx, objectKey)
+		return m.getObjectFn(ctx, bucketName, objectKey, opts)
+	}
+	return newObject("ok"), nil
+}
+
+func (m *mockGateway) DeleteObject(ctx context.Context, bucketName, objectKey string) error {
+	if m.deleteObjectFn != nil {
+		return m.deleteObjectFn(ctx, bucketName, objectKey)
+	}
+	return nil
+}
+
+func newObject(payload string) *storage.Object {
+	return &storage.Object{
+		ReadCloser: io.NopCloser(strings.NewReader(payload)),
+		Info:       storage.ObjectInfo{Size: int64(len(payload))},
 	}
-	return io.NopCloser(strings.NewReader("ok")), nil
 }
 
 func TestPutObject_InvalidObjectID(t *testing.T) {
@@ -69,8 +101,8 @@ func TestPutObject_StorageError(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	PutObject(rr, req, &mockGateway{
-		putObjectFn: func(ctx context.Context, objectKey string, data io.Reader, size int64) error {
-			return errors.New("backend down")
+		putObjectFn: func(ctx context.Context, bucketName, objectKey string, data io.Reader, size int64, opts storage.PutOptions) (storage.ObjectInfo, error) {
+			return storage.ObjectInfo{}, errors.New("backend down")
 		},
 	})
 
@@ -99,7 +131,7 @@ func TestGetObject_NotFoundError(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	GetObject(rr, req, &mockGateway{
-		getObjectFn: func(ctx context.Context, objectKey string) (io.ReadCloser, error) {
+		getObjectFn: func(ctx context.Context, bucketName, objectKey string, opts storage.GetOptions) (*storage.Object, error) {
 			return nil, fmt.Errorf("%w: %s", storage.ErrObjectNotFound, objectKey)
 		},
 	})
@@ -109,6 +141,23 @@ func TestGetObject_NotFoundError(t *testing.T) {
 	}
 }
 
+func TestGetObject_ShardsUnavailable(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/object/object1", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "object1"})
+
+	rr := httptest.NewRecorder()
+
+	GetObject(rr, req, &mockGateway{
+		getObjectFn: func(ctx context.Context, bucketName, objectKey string, opts storage.GetOptions) (*storage.Object, error) {
+			return nil, fmt.Errorf("%w: 1 of 2 required shards", storage.ErrShardsUnavailable)
+		},
+	})
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+}
+
 func TestGetObject_Success(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/object/object1", nil)
 	req = mux.SetURLVars(req, map[string]string{"id": "object1"})
@@ -116,8 +165,8 @@ func TestGetObject_Success(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	GetObject(rr, req, &mockGateway{
-		getObjectFn: func(ctx context.Context, objectKey string) (io.ReadCloser, error) {
-			return io.NopCloser(strings.NewReader("payload")), nil
+		getObjectFn: func(ctx context.Context, bucketName, objectKey string, opts storage.GetOptions) (*storage.Object, error) {
+			return newObject("payload"), nil
 		},
 	})
 
@@ -128,3 +177,516 @@ func TestGetObject_Success(t *testing.T) {
 		t.Fatalf("body = %q, want %q", rr.Body.String(), "payload")
 	}
 }
+
+func TestGetObject_CacheBypassHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{name: "absent", header: "", want: false},
+		{name: "bypass", header: "bypass", want: true},
+		{name: "case insensitive", header: "Bypass", want: true},
+		{name: "other value", header: "use", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/object/object1", nil)
+			if tt.header != "" {
+				req.Header.Set(cacheHeader, tt.header)
+			}
+			req = mux.SetURLVars(req, map[string]string{"id": "object1"})
+
+			rr := httptest.NewRecorder()
+
+			var gotOpts storage.GetOptions
+			GetObject(rr, req, &mockGateway{
+				getObjectFn: func(ctx context.Context, bucketName, objectKey string, opts storage.GetOptions) (*storage.Object, error) {
+					gotOpts = opts
+					return newObject("payload"), nil
+				},
+			})
+
+			if gotOpts.BypassCache != tt.want {
+				t.Fatalf("BypassCache = %v, want %v", gotOpts.BypassCache, tt.want)
+			}
+		})
+	}
+}
+
+func TestPutObject_CompressionHeader(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPut, "/object/object1", strings.NewReader("{}"))
+	req.ContentLength = 2
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(compressionHeader, "zstd")
+	req = mux.SetURLVars(req, map[string]string{"id": "object1"})
+
+	rr := httptest.NewRecorder()
+
+	var gotOpts storage.PutOptions
+	PutObject(rr, req, &mockGateway{
+		putObjectFn: func(ctx context.Context, bucketName, objectKey string, data io.Reader, size int64, opts storage.PutOptions) (storage.ObjectInfo, error) {
+			gotOpts = opts
+			return storage.ObjectInfo{Key: objectKey}, nil
+		},
+	})
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	if gotOpts.ContentType != "application/json" || gotOpts.Compression != "zstd" {
+		t.Fatalf("put options = %+v, want application/json and zstd", gotOpts)
+	}
+}
+
+func TestPutObject_QuotaExceeded(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPut, "/object/object1", strings.NewReader("content"))
+	req.ContentLength = int64(len("content"))
+	req = req.WithContext(WithTenant(req.Context(), "team-a"))
+	req = mux.SetURLVars(req, map[string]string{"id": "object1"})
+
+	rr := httptest.NewRecorder()
+
+	var gotOpts storage.PutOptions
+	PutObject(rr, req, &mockGateway{
+		putObjectFn: func(ctx context.Context, bucketName, objectKey string, data io.Reader, size int64, opts storage.PutOptions) (storage.ObjectInfo, error) {
+			gotOpts = opts
+			return storage.ObjectInfo{}, fmt.Errorf("%w: tenant team-a", storage.ErrQuotaExceeded)
+		},
+	})
+
+	if rr.Code != http.StatusInsufficientStorage {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusInsufficientStorage)
+	}
+	if gotOpts.Tenant != "team-a" {
+		t.Fatalf("tenant = %q, want %q", gotOpts.Tenant, "team-a")
+	}
+}
+
+func TestPutObject_IgnoresUnverifiedAPIKey(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPut, "/object/object1", strings.NewReader("content"))
+	req.ContentLength = int64(len("content"))
+	req.Header.Set(ratelimit.APIKeyHeader, "team-b-secret")
+	req = mux.SetURLVars(req, map[string]string{"id": "object1"})
+
+	rr := httptest.NewRecorder()
+
+	var gotOpts storage.PutOptions
+	PutObject(rr, req, &mockGateway{
+		putObjectFn: func(ctx context.Context, bucketName, objectKey string, data io.Reader, size int64, opts storage.PutOptions) (storage.ObjectInfo, error) {
+			gotOpts = opts
+			return storage.ObjectInfo{Key: objectKey}, nil
+		},
+	})
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	if gotOpts.Tenant != "" {
+		t.Fatalf("tenant = %q, want the raw API key to be ignored", gotOpts.Tenant)
+	}
+}
+
+func TestPutObject_UnsupportedCompression(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPut, "/object/object1", strings.NewReader("content"))
+	req.ContentLength = int64(len("content"))
+	req.Header.Set(compressionHeader, "lzma")
+	req = mux.SetURLVars(req, map[string]string{"id": "object1"})
+
+	rr := httptest.NewRecorder()
+
+	PutObject(rr, req, &mockGateway{
+		putObjectFn: func(ctx context.Context, bucketName, objectKey string, data io.Reader, size int64, opts storage.PutOptions) (storage.ObjectInfo, error) {
+			return storage.ObjectInfo{}, fmt.Errorf("%w: %q", storage.ErrUnsupportedCompression, opts.Compression)
+		},
+	})
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestGetObject_CompressedPassthrough(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/object/object1", nil)
+	req.Header.Set("Accept-Encoding", "gzip, zstd")
+	req = mux.SetURLVars(req, map[string]string{"id": "object1"})
+
+	rr := httptest.NewRecorder()
+
+	GetObject(rr, req, &mockGateway{
+		getObjectFn: func(ctx context.Context, bucketName, objectKey string, opts storage.GetOptions) (*storage.Object, error) {
+			if opts.AcceptEncoding != "gzip, zstd" {
+				t.Fatalf("AcceptEncoding = %q, want %q", opts.AcceptEncoding, "gzip, zstd")
+			}
+			object := newObject("compressed")
+			object.Info.ContentType = "application/json"
+			object.Info.ContentEncoding = "zstd"
+			return object, nil
+		},
+	})
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	if got := rr.Header().Get("Content-Encoding"); got != "zstd" {
+		t.Fatalf("Content-Encoding = %q, want zstd", got)
+	}
+	if got := rr.Header().Get("Content-Type"); got != "application/json" {
+		t.Fatalf("Content-Type = %q, want application/json", got)
+	}
+}
+
+func TestPutObject_ChecksumMismatch(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPut, "/object/object1", strings.NewReader("content"))
+	req.ContentLength = int64(len("content"))
+	req.Header.Set("Content-MD5", "1B2M2Y8AsgTpgAmY7PhCfg==")
+	req.Header.Set(checksumHeader, "abc")
+	req = mux.SetURLVars(req, map[string]string{"id": "object1"})
+
+	rr := httptest.NewRecorder()
+
+	PutObject(rr, req, &mockGateway{
+		putObjectFn: func(ctx context.Context, bucketName, objectKey string, data io.Reader, size int64, opts storage.PutOptions) (storage.ObjectInfo, error) {
+			if opts.ContentMD5 != "1B2M2Y8AsgTpgAmY7PhCfg==" || opts.ChecksumSHA256 != "abc" {
+				t.Fatalf("put options = %+v, want digests from headers", opts)
+			}
+			return storage.ObjectInfo{}, fmt.Errorf("%w: Content-MD5 does not match uploaded data", storage.ErrChecksumMismatch)
+		},
+	})
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestPutObject_ReturnsChecksum(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPut, "/object/object1", strings.NewReader("content"))
+	req.ContentLength = int64(len("content"))
+	req = mux.SetURLVars(req, map[string]string{"id": "object1"})
+
+	rr := httptest.NewRecorder()
+
+	PutObject(rr, req, &mockGateway{
+		putObjectFn: func(ctx context.Context, bucketName, objectKey string, data io.Reader, size int64, opts storage.PutOptions) (storage.ObjectInfo, error) {
+			return storage.ObjectInfo{Key: objectKey, Size: size, ChecksumSHA256: "deadbeef"}, nil
+		},
+	})
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	if got := rr.Header().Get(checksumHeader); got != "deadbeef" {
+		t.Fatalf("%s = %q, want deadbeef", checksumHeader, got)
+	}
+}
+
+func TestHeadObject_Success(t *testing.T) {
+	req := httptest.NewRequest(http.MethodHead, "/object/object1", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "object1"})
+
+	rr := httptest.NewRecorder()
+
+	HeadObject(rr, req, &mockGateway{
+		statObjectFn: func(ctx context.Context, bucketName, objectKey string, opts storage.GetOptions) (storage.ObjectInfo, error) {
+			return storage.ObjectInfo{Key: objectKey, Size: 42, ChecksumSHA256: "deadbeef"}, nil
+		},
+	})
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	if got := rr.Header().Get("Content-Length"); got != "42" {
+		t.Fatalf("Content-Length = %q, want 42", got)
+	}
+	if got := rr.Header().Get(checksumHeader); got != "deadbeef" {
+		t.Fatalf("%s = %q, want deadbeef", checksumHeader, got)
+	}
+	if rr.Body.Len() != 0 {
+		t.Fatalf("body length = %d, want 0", rr.Body.Len())
+	}
+}
+
+func TestHeadObject_NotFound(t *testing.T) {
+	req := httptest.NewRequest(http.MethodHead, "/object/object1", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "object1"})
+
+	rr := httptest.NewRecorder()
+
+	HeadObject(rr, req, &mockGateway{
+		statObjectFn: func(ctx context.Context, bucketName, objectKey string, opts storage.GetOptions) (storage.ObjectInfo, error) {
+			return storage.ObjectInfo{}, fmt.Errorf("%w: %s", storage.ErrObjectNotFound, objectKey)
+		},
+	})
+
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestPutObject_IncompleteUpload(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPut, "/object/object1", strings.NewReader("short"))
+	req.ContentLength = 10
+	req = mux.SetURLVars(req, map[string]string{"id": "object1"})
+
+	rr := httptest.NewRecorder()
+
+	PutObject(rr, req, &mockGateway{
+		putObjectFn: func(ctx context.Context, bucketName, objectKey string, data io.Reader, size int64, opts storage.PutOptions) (storage.ObjectInfo, error) {
+			return storage.ObjectInfo{}, fmt.Errorf("%w: received 5 of 10 bytes", storage.ErrIncompleteUpload)
+		},
+	})
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestDeleteObject_Success(t *testing.T) {
+	req := httptest.NewRequest(http.MethodDelete, "/object/object1", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "object1"})
+
+	rr := httptest.NewRecorder()
+
+	DeleteObject(rr, req, &mockGateway{})
+
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusNoContent)
+	}
+}
+
+func TestDeleteObject_NotFound(t *testing.T) {
+	req := httptest.NewRequest(http.MethodDelete, "/object/object1", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "object1"})
+
+	rr := httptest.NewRecorder()
+
+	DeleteObject(rr, req, &mockGateway{
+		deleteObjectFn: func(ctx context.Context, bucketName, objectKey string) error {
+			return fmt.Errorf("%w: %s", storage.ErrObjectNotFound, objectKey)
+		},
+	})
+
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusNotFound)
+	}
+}
+
+func TestGetObject_BucketRoute(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/buckets/team-a/objects/object1", nil)
+	req = mux.SetURLVars(req, map[string]string{"bucket": "team-a", "id": "object1"})
+
+	rr := httptest.NewRecorder()
+
+	var gotBucket string
+	GetObject(rr, req, &mockGateway{
+		getObjectFn: func(ctx context.Context, bucketName, objectKey string, opts storage.GetOptions) (*storage.Object, error) {
+			gotBucket = bucketName
+			return newObject("ok"), nil
+		},
+	})
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	if gotBucket != "team-a" {
+		t.Fatalf("bucket = %q, want %q", gotBucket, "team-a")
+	}
+}
+
+func TestObjectHandlers_BucketErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "bucket not found", err: storage.ErrBucketNotFound, want: http.StatusNotFound},
+		{name: "invalid bucket name", err: storage.ErrInvalidBucketName, want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gateway := &mockGateway{
+				putObjectFn: func(ctx context.Context, bucketName, objectKey string, data io.Reader, size int64, opts storage.PutOptions) (storage.ObjectInfo, error) {
+					return storage.ObjectInfo{}, tt.err
+				},
+				getObjectFn: func(ctx context.Context, bucketName, objectKey string, opts storage.GetOptions) (*storage.Object, error) {
+					return nil, tt.err
+				},
+				statObjectFn: func(ctx context.Context, bucketName, objectKey string, opts storage.GetOptions) (storage.ObjectInfo, error) {
+					return storage.ObjectInfo{}, tt.err
+				},
+				deleteObjectFn: func(ctx context.Context, bucketName, objectKey string) error {
+					return tt.err
+				},
+			}
+			handlers := map[string]func(http.ResponseWriter, *http.Request, ObjectGateway){
+				http.MethodPut:    PutObject,
+				http.MethodGet:    GetObject,
+				http.MethodHead:   HeadObject,
+				http.MethodDelete: DeleteObject,
+			}
+
+			for method, handler := range handlers {
+				req := httptest.NewRequest(method, "/buckets/missing/objects/object1", strings.NewReader("data"))
+				req = mux.SetURLVars(req, map[string]string{"bucket": "missing", "id": "object1"})
+				rr := httptest.NewRecorder()
+
+				handler(rr, req, gateway)
+
+				if rr.Code != tt.want {
+					t.Fatalf("%s status = %d, want %d", method, rr.Code, tt.want)
+				}
+			}
+		})
+	}
+}
+
+type mockBucketGateway struct {
+	createBucketFn func(ctx context.Context, bucketName string) error
+	listBucketsFn  func(ctx context.Context) ([]string, error)
+	deleteBucketFn func(ctx context.Context, bucketName string) error
+}
+
+func (m *mockBucketGateway) CreateBucket(ctx context.Context, bucketName string) error {
+	if m.createBucketFn != nil {
+		return m.createBucketFn(ctx, bucketName)
+	}
+	return nil
+}
+
+func (m *mockBucketGateway) ListBuckets(ctx context.Context) ([]string, error) {
+	if m.listBucketsFn != nil {
+		return m.listBucketsFn(ctx)
+	}
+	return []string{"objects"}, nil
+}
+
+func (m *mockBucketGateway) DeleteBucket(ctx context.Context, bucketName string) error {
+	if m.deleteBucketFn != nil {
+		return m.deleteBucketFn(ctx, bucketName)
+	}
+	return nil
+}
+
+func TestCreateBucket(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "created", want: http.StatusCreated},
+		{name: "exists", err: storage.ErrBucketExists, want: http.StatusConflict},
+		{name: "invalid name", err: storage.ErrInvalidBucketName, want: http.StatusBadRequest},
+		{name: "backend error", err: errors.New("backend unavailable"), want: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/buckets/team-a", nil)
+			req = mux.SetURLVars(req, map[string]string{"bucket": "team-a"})
+			rr := httptest.NewRecorder()
+
+			CreateBucket(rr, req, &mockBucketGateway{
+				createBucketFn: func(ctx context.Context, bucketName string) error {
+					return tt.err
+				},
+			})
+
+			if rr.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rr.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestListBuckets(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/buckets", nil)
+	rr := httptest.NewRecorder()
+
+	ListBuckets(rr, req, &mockBucketGateway{
+		listBucketsFn: func(ctx context.Context) ([]string, error) {
+			return []string{"objects", "team-a"}, nil
+		},
+	})
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+	if body := rr.Body.String(); !strings.Contains(body, `"buckets":["objects","team-a"]`) {
+		t.Fatalf("body = %q, want both buckets listed", body)
+	}
+}
+
+func TestDeleteBucket(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "deleted", want: http.StatusNoContent},
+		{name: "not found", err: storage.ErrBucketNotFound, want: http.StatusNotFound},
+		{name: "not empty", err: storage.ErrBucketNotEmpty, want: http.StatusConflict},
+		{name: "invalid name", err: storage.ErrInvalidBucketName, want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/buckets/team-a", nil)
+			req = mux.SetURLVars(req, map[string]string{"bucket": "team-a"})
+			rr := httptest.NewRecorder()
+
+			DeleteBucket(rr, req, &mockBucketGateway{
+				deleteBucketFn: func(ctx context.Context, bucketName string) error {
+					return tt.err
+				},
+			})
+
+			if rr.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rr.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetObject_HierarchicalKey(t *testing.T) {
+	policy := storage.KeyPolicy{MaxLength: 128, AllowSlashes: true, AllowDots: true}
+
+	tests := []struct {
+		name    string
+		id      string
+		wantKey string
+		want    int
+	}{
+		{name: "slashes", id: "reports/2026/10/summary.json", wantKey: "reports/2026/10/summary.json", want: http.StatusOK},
+		{name: "escaped slashes", id: "reports%2F2026%2Fsummary.json", wantKey: "reports/2026/summary.json", want: http.StatusOK},
+		{name: "malformed escape", id: "reports%2", want: http.StatusBadRequest},
+		{name: "traversal", id: "reports/../secrets", want: http.StatusBadRequest},
+		{name: "reserved prefix", id: ".erasure/object1", want: http.StatusBadRequest},
+		{name: "disallowed dash", id: "with-dash", want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/object/x", nil)
+			req = mux.SetURLVars(req, map[string]string{"id": tt.id})
+			rr := httptest.NewRecorder()
+
+			var gotKey string
+			GetObject(rr, req, &mockGateway{
+				keyPolicy: &policy,
+				getObjectFn: func(ctx context.Context, bucketName, objectKey string, opts storage.GetOptions) (*storage.Object, error) {
+					gotKey = objectKey
+					return newObject("ok"), nil
+				},
+			})
+
+			if rr.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rr.Code, tt.want)
+			}
+			if gotKey != tt.wantKey {
+				t.Fatalf("object key = %q, want %q", gotKey, tt.wantKey)
+			}
+		})
+	}
+}
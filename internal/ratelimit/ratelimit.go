@@ -0,0 +1,339 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/time/rate"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// APIKeyHeader identifies a client independently of its address.
+	APIKeyHeader = "X-API-Key"
+
+	// idleTimeout is how long an unused client bucket is kept.
+	idleTimeout = 10 * time.Minute
+	// maxClients bounds the buckets kept at once, so a flood of new
+	// addresses cannot grow the limiter without bound.
+	maxClients = 100_000
+	// minByteBurst keeps bandwidth limits from forcing tiny reads and writes.
+	minByteBurst = 32 << 10
+)
+
+// Limit describes the budget of one client on one route. Zero values mean
+// unlimited.
+type Limit struct {
+	// RequestsPerSecond is the sustained request rate.
+	RequestsPerSecond float64 `json:"requestsPerSecond" yaml:"requestsPerSecond"`
+	// Burst is the number of requests allowed at once. It defaults to the
+	// rate rounded up.
+	Burst int `json:"burst" yaml:"burst"`
+	// BytesPerSecond caps upload and download bandwidth together.
+	BytesPerSecond int64 `json:"bytesPerSecond" yaml:"bytesPerSecond"`
+}
+
+func (l Limit) unlimited() bool {
+	return l.RequestsPerSecond <= 0 && l.BytesPerSecond <= 0
+}
+
+// Config holds the limits applied by the middleware.
+type Config struct {
+	// Default applies to routes without an entry in Routes.
+	Default Limit `json:"default" yaml:"default"`
+	// Routes overrides Default per route, keyed by method and path template,
+	// for example "GET /object/{id}".
+	Routes map[string]Limit `json:"routes" yaml:"routes"`
+}
+
+// APIKeys maps the API keys clients may present to the names they are known
+// by. Only a listed key identifies a client; the name stands in for the key
+// wherever the client is recorded, so the key itself is never stored.
+type APIKeys map[string]string
+
+// LoadAPIKeys reads a YAML or JSON file mapping API keys to client names.
+func LoadAPIKeys(path string) (APIKeys, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys file: %w", err)
+	}
+
+	var keys APIKeys
+	if err := yaml.Unmarshal(raw, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse API keys file %s: %w", path, err)
+	}
+	for key, name := range keys {
+		if strings.TrimSpace(key) == "" || strings.TrimSpace(name) == "" {
+			return nil, errors.New("API keys and client names cannot be empty")
+		}
+	}
+	return keys, nil
+}
+
+// Client returns the name of the client whose API key r presents, if the
+// key is listed.
+func (k APIKeys) Client(r *http.Request) (string, bool) {
+	apiKey := strings.TrimSpace(r.Header.Get(APIKeyHeader))
+	if apiKey == "" {
+		return "", false
+	}
+	name, ok := k[apiKey]
+	return name, ok
+}
+
+// Option configures a Limiter.
+type Option func(*Limiter)
+
+// WithAPIKeys keys the buckets of clients presenting a listed API key by
+// client name instead of address.
+func WithAPIKeys(keys APIKeys) Option {
+	return func(l *Limiter) {
+		l.keys = keys
+	}
+}
+
+// Limiter enforces per-client request rates and bandwidth.
+type Limiter struct {
+	cfg        Config
+	keys       APIKeys
+	maxClients int
+	now        func() time.Time
+
+	mu        sync.Mutex
+	clients   map[string]*clientBuckets
+	lastSweep time.Time
+}
+
+type clientBuckets struct {
+	requests *rate.Limiter
+	bytes    *rate.Limiter
+	lastSeen time.Time
+}
+
+// New creates a limiter for cfg.
+func New(cfg Config, opts ...Option) *Limiter {
+	l := &Limiter{
+		cfg:        cfg,
+		maxClients: maxClients,
+		now:        time.Now,
+		clients:    make(map[string]*clientBuckets),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Middleware rejects requests over their rate with 429 and throttles the
+// request and response bodies of the rest.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeKey(r)
+		limit := l.limitFor(route)
+		if limit.unlimited() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		client := ClientKey(r, l.keys)
+		buckets := l.buckets(route, client, limit)
+
+		if buckets.requests != nil {
+			reservation := buckets.requests.ReserveN(l.now(), 1)
+			if delay := reservation.DelayFrom(l.now()); !reservation.OK() || delay > 0 {
+				reservation.CancelAt(l.now())
+				retryAfter := int(math.Ceil(delay.Seconds()))
+				if retryAfter < 1 {
+					retryAfter = 1
+				}
+				log.Printf("%s - rate limit exceeded for client %s", route, client)
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+		}
+
+		if buckets.bytes != nil {
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = &throttledReader{ReadCloser: r.Body, ctx: r.Context(), bucket: buckets.bytes}
+			}
+			w = &throttledWriter{ResponseWriter: w, ctx: r.Context(), bucket: buckets.bytes}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (l *Limiter) limitFor(route string) Limit {
+	if limit, ok := l.cfg.Routes[route]; ok {
+		return limit
+	}
+	return l.cfg.Default
+}
+
+// buckets returns the token buckets of client on route, creating them on first use.
+func (l *Limiter) buckets(route, client string, limit Limit) *clientBuckets {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) > idleTimeout {
+		l.sweep(now)
+	}
+
+	key := route + "\x00" + client
+	buckets, ok := l.clients[key]
+	if !ok {
+		if len(l.clients) >= l.maxClients {
+			// Give up an arbitrary bucket rather than grow further. Its
+			// client merely starts over with a full bucket.
+			for victim := range l.clients {
+				delete(l.clients, victim)
+				break
+			}
+		}
+		buckets = &clientBuckets{}
+		if limit.RequestsPerSecond > 0 {
+			burst := limit.Burst
+			if burst <= 0 {
+				burst = int(math.Ceil(limit.RequestsPerSecond))
+			}
+			buckets.requests = rate.NewLimiter(rate.Limit(limit.RequestsPerSecond), burst)
+		}
+		if limit.BytesPerSecond > 0 {
+			burst := int(max(limit.BytesPerSecond, minByteBurst))
+			buckets.bytes = rate.NewLimiter(rate.Limit(limit.BytesPerSecond), burst)
+		}
+		l.clients[key] = buckets
+	}
+	buckets.lastSeen = now
+
+	return buckets
+}
+
+// sweep drops the buckets that have been idle for longer than idleTimeout.
+func (l *Limiter) sweep(now time.Time) {
+	for key, buckets := range l.clients {
+		if now.Sub(buckets.lastSeen) > idleTimeout {
+			delete(l.clients, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// routeKey names the matched route as "METHOD /path/template". Variable
+// patterns are dropped, so "/object/{id:.+}" is keyed as "/object/{id}".
+func routeKey(r *http.Request) string {
+	path := r.URL.Path
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			path = stripVariablePatterns(template)
+		}
+	}
+	return r.Method + " " + path
+}
+
+func stripVariablePatterns(template string) string {
+	var b strings.Builder
+	depth := 0
+	skipping := false
+	for _, c := range template {
+		switch {
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				skipping = false
+			}
+		case c == ':' && depth == 1:
+			skipping = true
+			continue
+		}
+		if !skipping {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// ClientKey identifies the caller by the client name of a listed API key, or
+// by remote IP otherwise. Unlisted keys are ignored, so sending a new key on
+// every request does not get a fresh bucket.
+func ClientKey(r *http.Request, keys APIKeys) string {
+	if name, ok := keys.Client(r); ok {
+		return "client:" + name
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// throttledReader paces reads of a request body through a byte bucket.
+type throttledReader struct {
+	io.ReadCloser
+	ctx    context.Context
+	bucket *rate.Limiter
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if burst := t.bucket.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		if waitErr := t.bucket.WaitN(t.ctx, n); waitErr != nil && err == nil {
+			err = waitErr
+		}
+	}
+	return n, err
+}
+
+// throttledWriter paces writes of a response body through a byte bucket.
+type throttledWriter struct {
+	http.ResponseWriter
+	ctx    context.Context
+	bucket *rate.Limiter
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if burst := t.bucket.Burst(); len(chunk) > burst {
+			chunk = chunk[:burst]
+		}
+		if err := t.bucket.WaitN(t.ctx, len(chunk)); err != nil {
+			return written, err
+		}
+
+		n, err := t.ResponseWriter.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (t *throttledWriter) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
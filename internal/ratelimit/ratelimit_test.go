@@ -0,0 +1,251 @@
+package ratelimit
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestMiddleware_RejectsOverLimit(t *testing.T) {
+	router := newTestRouter(New(Config{Default: Limit{RequestsPerSecond: 1, Burst: 2}}))
+
+	for i := 0; i < 2; i++ {
+		if rr := serve(router, http.MethodGet, "/object/a", "10.0.0.1:1234", ""); rr.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want %d", i, rr.Code, http.StatusOK)
+		}
+	}
+
+	rr := serve(router, http.MethodGet, "/object/a", "10.0.0.1:1234", "")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", rr.Code, http.StatusTooManyRequests)
+	}
+	if rr.Header().Get("Retry-After") != "1" {
+		t.Fatalf("Retry-After = %q, want %q", rr.Header().Get("Retry-After"), "1")
+	}
+}
+
+func TestMiddleware_KeysByClient(t *testing.T) {
+	router := newTestRouter(New(Config{Default: Limit{RequestsPerSecond: 1, Burst: 1}}, WithAPIKeys(APIKeys{"batch-key": "batch"})))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		apiKey     string
+		want       int
+	}{
+		{name: "first ip", remoteAddr: "10.0.0.1:1000", want: http.StatusOK},
+		{name: "same ip other port", remoteAddr: "10.0.0.1:2000", want: http.StatusTooManyRequests},
+		{name: "other ip", remoteAddr: "10.0.0.2:1000", want: http.StatusOK},
+		{name: "api key on limited ip", remoteAddr: "10.0.0.1:1000", apiKey: "batch-key", want: http.StatusOK},
+		{name: "same api key elsewhere", remoteAddr: "10.0.0.3:1000", apiKey: "batch-key", want: http.StatusTooManyRequests},
+		{name: "unlisted api key on limited ip", remoteAddr: "10.0.0.1:1000", apiKey: "made-up", want: http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serve(router, http.MethodGet, "/object/a", tt.remoteAddr, tt.apiKey)
+			if rr.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rr.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddleware_PerRouteLimits(t *testing.T) {
+	router := newTestRouter(New(Config{
+		Default: Limit{RequestsPerSecond: 1, Burst: 1},
+		Routes: map[string]Limit{
+			"GET /object/{id}": {RequestsPerSecond: 100, Burst: 100},
+			"GET /health":      {},
+		},
+	}))
+
+	for i := 0; i < 5; i++ {
+		if rr := serve(router, http.MethodGet, "/object/a", "10.0.0.1:1", ""); rr.Code != http.StatusOK {
+			t.Fatalf("GET request %d: status = %d", i, rr.Code)
+		}
+		if rr := serve(router, http.MethodGet, "/health", "10.0.0.1:1", ""); rr.Code != http.StatusOK {
+			t.Fatalf("health request %d: status = %d", i, rr.Code)
+		}
+	}
+
+	if rr := serve(router, http.MethodPut, "/object/a", "10.0.0.1:1", ""); rr.Code != http.StatusOK {
+		t.Fatalf("first PUT: status = %d", rr.Code)
+	}
+	if rr := serve(router, http.MethodPut, "/object/a", "10.0.0.1:1", ""); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("second PUT: status = %d, want %d", rr.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestMiddleware_ThrottlesBandwidth(t *testing.T) {
+	limiter := New(Config{Default: Limit{BytesPerSecond: minByteBurst}})
+	router := newTestRouter(limiter)
+
+	// The first burst is free; the second has to wait for the bucket to refill.
+	start := time.Now()
+	rr := serve(router, http.MethodGet, "/download", "10.0.0.1:1", "")
+	if rr.Code != http.StatusOK || rr.Body.Len() != minByteBurst+minByteBurst/4 {
+		t.Fatalf("status = %d, body = %d bytes", rr.Code, rr.Body.Len())
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Fatalf("download took %v, expected it to be throttled", elapsed)
+	}
+}
+
+func TestMiddleware_ThrottlesUploads(t *testing.T) {
+	router := newTestRouter(New(Config{Default: Limit{BytesPerSecond: minByteBurst}}))
+
+	body := strings.Repeat("x", minByteBurst+minByteBurst/4)
+	req := httptest.NewRequest(http.MethodPut, "/object/a", strings.NewReader(body))
+	req.RemoteAddr = "10.0.0.1:1"
+	rr := httptest.NewRecorder()
+
+	start := time.Now()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || rr.Body.String() != body {
+		t.Fatalf("status = %d, echoed %d bytes", rr.Code, rr.Body.Len())
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Fatalf("upload took %v, expected it to be throttled", elapsed)
+	}
+}
+
+func TestMiddleware_BoundsTrackedClients(t *testing.T) {
+	limiter := New(Config{Default: Limit{RequestsPerSecond: 1, Burst: 1}})
+	limiter.maxClients = 2
+	router := newTestRouter(limiter)
+
+	for i := 1; i <= 5; i++ {
+		if rr := serve(router, http.MethodGet, "/object/a", fmt.Sprintf("10.0.0.%d:1", i), ""); rr.Code != http.StatusOK {
+			t.Fatalf("client %d: status = %d, want %d", i, rr.Code, http.StatusOK)
+		}
+	}
+	if len(limiter.clients) > 2 {
+		t.Fatalf("tracking %d clients, want at most 2", len(limiter.clients))
+	}
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    APIKeys
+		wantErr bool
+	}{
+		{name: "yaml", content: "key-a: team-a\nkey-b: team-b\n", want: APIKeys{"key-a": "team-a", "key-b": "team-b"}},
+		{name: "json", content: `{"key-a": "team-a"}`, want: APIKeys{"key-a": "team-a"}},
+		{name: "empty name", content: "key-a: \"\"\n", wantErr: true},
+		{name: "not a map", content: "- key-a\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keys.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			keys, err := LoadAPIKeys(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("LoadAPIKeys() = %v, want an error", keys)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadAPIKeys() unexpected error: %v", err)
+			}
+			if !maps.Equal(keys, tt.want) {
+				t.Fatalf("LoadAPIKeys() = %v, want %v", keys, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientKey(t *testing.T) {
+	keys := APIKeys{"secret": "team-a"}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		apiKey     string
+		want       string
+	}{
+		{name: "ipv4", remoteAddr: "10.0.0.1:1234", want: "ip:10.0.0.1"},
+		{name: "ipv6", remoteAddr: "[::1]:1234", want: "ip:::1"},
+		{name: "no port", remoteAddr: "10.0.0.1", want: "ip:10.0.0.1"},
+		{name: "listed api key", remoteAddr: "10.0.0.1:1234", apiKey: " secret ", want: "client:team-a"},
+		{name: "unlisted api key", remoteAddr: "10.0.0.1:1234", apiKey: "guess", want: "ip:10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.apiKey != "" {
+				req.Header.Set(APIKeyHeader, tt.apiKey)
+			}
+			if got := ClientKey(req, keys); got != tt.want {
+				t.Fatalf("ClientKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func newTestRouter(limiter *Limiter) *mux.Router {
+	router := mux.NewRouter()
+	router.Use(limiter.Middleware)
+
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	router.HandleFunc("/object/{id}", ok).Methods(http.MethodGet)
+	router.HandleFunc("/object/{id}", func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, r.Body)
+	}).Methods(http.MethodPut)
+	router.HandleFunc("/health", ok).Methods(http.MethodGet)
+	router.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", minByteBurst+minByteBurst/4)))
+	}).Methods(http.MethodGet)
+
+	return router
+}
+
+func serve(handler http.Handler, method, target, remoteAddr, apiKey string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	req.RemoteAddr = remoteAddr
+	if apiKey != "" {
+		req.Header.Set(APIKeyHeader, apiKey)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestStripVariablePatterns(t *testing.T) {
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{template: "/object/{id}", want: "/object/{id}"},
+		{template: "/object/{id:.+}", want: "/object/{id}"},
+		{template: "/buckets/{bucket}/objects/{id:.+}", want: "/buckets/{bucket}/objects/{id}"},
+		{template: "/items/{id:[0-9]{3}}", want: "/items/{id}"},
+	}
+
+	for _, tt := range tests {
+		if got := stripVariablePatterns(tt.template); got != tt.want {
+			t.Fatalf("stripVariablePatterns(%q) = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// authErrorReportInterval is the least time between two reports of rejected
+// credentials for the same instance, so a burst of failing requests triggers
+// one rediscovery.
+const authErrorReportInterval = 10 * time.Second
+
+// isAuthError reports whether MinIO rejected the access or secret key.
+func isAuthError(err error) bool {
+	switch minio.ToErrorResponse(err).Code {
+	case "InvalidAccessKeyId", "SignatureDoesNotMatch":
+		return true
+	default:
+		return false
+	}
+}
+
+// authErrorReporter passes rejected credentials on to a handler, at most once
+// per authErrorReportInterval and instance.
+type authErrorReporter struct {
+	handle func(instanceID string)
+	now    func() time.Time
+
+	mu       sync.Mutex
+	reported map[string]time.Time
+}
+
+func newAuthErrorReporter(handle func(instanceID string)) *authErrorReporter {
+	return &authErrorReporter{
+		handle:   handle,
+		now:      time.Now,
+		reported: make(map[string]time.Time),
+	}
+}
+
+// check reports err if it is an authentication error and returns it unchanged.
+func (r *authErrorReporter) check(instanceID string, err error) error {
+	if err == nil || !isAuthError(err) {
+		return err
+	}
+
+	r.mu.Lock()
+	now := r.now()
+	last, seen := r.reported[instanceID]
+	due := !seen || now.Sub(last) >= authErrorReportInterval
+	if due {
+		r.reported[instanceID] = now
+	}
+	r.mu.Unlock()
+
+	if due {
+		log.Printf("instance %s rejected the gateway credentials: %v", instanceID, err)
+		r.handle(instanceID)
+	}
+	return err
+}
+
+// authCheckedStore reports authentication errors of one instance.
+type authCheckedStore struct {
+	objectStore
+	instanceID string
+	reporter   *authErrorReporter
+}
+
+func (s authCheckedStore) BucketExists(ctx context.Context, bucketName string) (bool, error) {
+	exists, err := s.objectStore.BucketExists(ctx, bucketName)
+	return exists, s.reporter.check(s.instanceID, err)
+}
+
+func (s authCheckedStore) MakeBucket(ctx context.Context, bucketName string) error {
+	return s.reporter.check(s.instanceID, s.objectStore.MakeBucket(ctx, bucketName))
+}
+
+func (s authCheckedStore) RemoveBucket(ctx context.Context, bucketName string) error {
+	return s.reporter.check(s.instanceID, s.objectStore.RemoveBucket(ctx, bucketName))
+}
+
+func (s authCheckedStore) ListBuckets(ctx context.Context) ([]string, error) {
+	buckets, err := s.objectStore.ListBuckets(ctx)
+	return buckets, s.reporter.check(s.instanceID, err)
+}
+
+func (s authCheckedStore) PutObject(ctx context.Context, bucketName, objectKey string, data io.Reader, size int64, opts storeObject) error {
+	return s.reporter.check(s.instanceID, s.objectStore.PutObject(ctx, bucketName, objectKey, data, size, opts))
+}
+
+func (s authCheckedStore) StatObject(ctx context.Context, bucketName, objectKey string) (storeObject, error) {
+	stat, err := s.objectStore.StatObject(ctx, bucketName, objectKey)
+	return stat, s.reporter.check(s.instanceID, err)
+}
+
+// GetObject only sees errors raised before the first read; reads are
+// normally preceded by StatObject, which reports rejected credentials.
+func (s authCheckedStore) GetObject(ctx context.Context, bucketName, objectKey string) (io.ReadCloser, error) {
+	reader, err := s.objectStore.GetObject(ctx, bucketName, objectKey)
+	return reader, s.reporter.check(s.instanceID, err)
+}
+
+func (s authCheckedStore) ReplaceMetadata(ctx context.Context, bucketName, objectKey string, opts storeObject) error {
+	return s.reporter.check(s.instanceID, s.objectStore.ReplaceMetadata(ctx, bucketName, objectKey, opts))
+}
+
+func (s authCheckedStore) RemoveObject(ctx context.Context, bucketName, objectKey string) error {
+	return s.reporter.check(s.instanceID, s.objectStore.RemoveObject(ctx, bucketName, objectKey))
+}
+
+func (s authCheckedStore) ListObjects(ctx context.Context, bucketName, prefix string) ([]storeObject, error) {
+	objects, err := s.objectStore.ListObjects(ctx, bucketName, prefix)
+	return objects, s.reporter.check(s.instanceID, err)
+}
+
+func (s authCheckedStore) PrefixEmpty(ctx context.Context, bucketName, prefix string) (bool, error) {
+	empty, err := s.objectStore.PrefixEmpty(ctx, bucketName, prefix)
+	return empty, s.reporter.check(s.instanceID, err)
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// rejectingStore fails every stat with err.
+type rejectingStore struct {
+	*fakeStore
+	err error
+}
+
+func (s rejectingStore) StatObject(ctx context.Context, bucketName, objectKey string) (storeObject, error) {
+	return storeObject{}, s.err
+}
+
+func TestAuthCheckedStoreReportsRejectedCredentials(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "invalid access key", err: minio.ErrorResponse{Code: "InvalidAccessKeyId"}, want: 1},
+		{name: "signature mismatch", err: minio.ErrorResponse{Code: "SignatureDoesNotMatch"}, want: 1},
+		{name: "missing object", err: minio.ErrorResponse{Code: "NoSuchKey"}, want: 0},
+		{name: "network failure", err: errors.New("connection refused"), want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reported []string
+			reporter := newAuthErrorReporter(func(instanceID string) {
+				reported = append(reported, instanceID)
+			})
+			store := authCheckedStore{
+				objectStore: rejectingStore{fakeStore: newFakeStore(), err: tt.err},
+				instanceID:  "instance-1",
+				reporter:    reporter,
+			}
+
+			_, err := store.StatObject(context.Background(), defaultBucketName, "key")
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("StatObject() error = %v, want %v", err, tt.err)
+			}
+			if len(reported) != tt.want {
+				t.Fatalf("reported %v, want %d report(s)", reported, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthErrorReporterThrottlesPerInstance(t *testing.T) {
+	var reported []string
+	reporter := newAuthErrorReporter(func(instanceID string) {
+		reported = append(reported, instanceID)
+	})
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	reporter.now = func() time.Time { return now }
+
+	authErr := minio.ErrorResponse{Code: "InvalidAccessKeyId"}
+	reporter.check("instance-1", authErr)
+	reporter.check("instance-1", authErr)
+	reporter.check("instance-2", authErr)
+	now = now.Add(authErrorReportInterval)
+	reporter.check("instance-1", authErr)
+
+	want := []string{"instance-1", "instance-2", "instance-1"}
+	if len(reported) != len(want) {
+		t.Fatalf("reported %v, want %v", reported, want)
+	}
+	for i := range want {
+		if reported[i] != want[i] {
+			t.Fatalf("reported %v, want %v", reported, want)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+)
+
+// Buckets are namespaces backed by a bucket of the same name on every
+// instance. Creating a bucket only creates it on its home instance, the one
+// the hasher picks for the bucket name; the other instances create it lazily
+// on their first write. A bucket therefore exists while any instance has it.
+
+// objectPath qualifies objectKey with its bucket for gateway-wide bookkeeping
+// such as cache entries, read flights and repairs.
+func objectPath(bucketName, objectKey string) string {
+	return bucketName + "/" + objectKey
+}
+
+// DefaultBucket returns the bucket used when a request names none.
+func (g *Gateway) DefaultBucket() string {
+	return g.defaultBucket
+}
+
+// missingBucketTTL is how long resolveBucket remembers that a bucket does
+// not exist, sparing every instance a BucketExists call per request.
+const missingBucketTTL = 2 * time.Second
+
+// resolveBucket maps an empty bucket name to the default bucket and makes sure
+// any other bucket has been created.
+func (g *Gateway) resolveBucket(ctx context.Context, bucketName string) (string, error) {
+	if bucketName == "" || bucketName == g.defaultBucket {
+		return g.defaultBucket, nil
+	}
+	if err := ValidateBucketName(bucketName); err != nil {
+		return "", err
+	}
+	if _, ok := g.knownBuckets.Load(bucketName); ok {
+		return bucketName, nil
+	}
+	if expires, ok := g.absentBuckets.Load(bucketName); ok && time.Now().Before(expires.(time.Time)) {
+		return "", fmt.Errorf("%w: %s", ErrBucketNotFound, bucketName)
+	}
+
+	holders, err := g.bucketHolders(ctx, bucketName)
+	if err != nil {
+		return "", err
+	}
+	if len(holders) == 0 {
+		g.absentBuckets.Store(bucketName, time.Now().Add(missingBucketTTL))
+		return "", fmt.Errorf("%w: %s", ErrBucketNotFound, bucketName)
+	}
+
+	g.absentBuckets.Delete(bucketName)
+	g.knownBuckets.Store(bucketName, struct{}{})
+	return bucketName, nil
+}
+
+// bucketHolders returns the instances that have bucketName.
+func (g *Gateway) bucketHolders(ctx context.Context, bucketName string) ([]string, error) {
+	var holders []string
+	for _, instanceID := range g.hasher.Instances() {
+		store, err := g.storeFor(instanceID)
+		if err != nil {
+			return nil, err
+		}
+		exists, err := store.BucketExists(ctx, bucketName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check bucket %q on instance %s: %w", bucketName, instanceID, err)
+		}
+		if exists {
+			holders = append(holders, instanceID)
+		}
+	}
+	return holders, nil
+}
+
+// ensureBucket creates bucketName on store unless it is already there. It
+// holds the bucket lock so a write cannot recreate a bucket DeleteBucket is
+// removing, and refuses to recreate a bucket that has been deleted since the
+// write resolved it.
+func (g *Gateway) ensureBucket(ctx context.Context, store objectStore, bucketName string) error {
+	defer g.bucketLocks.Lock(bucketName)()
+
+	exists, err := store.BucketExists(ctx, bucketName)
+	if err != nil {
+		return fmt.Errorf("failed to check bucket %q existence: %w", bucketName, err)
+	}
+	if exists {
+		return nil
+	}
+
+	if bucketName != g.defaultBucket {
+		if _, ok := g.knownBuckets.Load(bucketName); !ok {
+			return fmt.Errorf("%w: %s", ErrBucketNotFound, bucketName)
+		}
+	}
+	if err := store.MakeBucket(ctx, bucketName); err != nil {
+		return fmt.Errorf("failed to create bucket %q: %w", bucketName, err)
+	}
+
+	return nil
+}
+
+// CreateBucket creates a bucket on its home instance.
+func (g *Gateway) CreateBucket(ctx context.Context, bucketName string) error {
+	if err := ValidateBucketName(bucketName); err != nil {
+		return err
+	}
+	if bucketName == g.defaultBucket {
+		return fmt.Errorf("%w: %s", ErrBucketExists, bucketName)
+	}
+	defer g.bucketLocks.Lock(bucketName)()
+
+	holders, err := g.bucketHolders(ctx, bucketName)
+	if err != nil {
+		return err
+	}
+	if len(holders) > 0 {
+		return fmt.Errorf("%w: %s", ErrBucketExists, bucketName)
+	}
+
+	home, err := g.hasher.SelectInstance(bucketName)
+	if err != nil {
+		return fmt.Errorf("failed to select instance: %w", err)
+	}
+	store, err := g.storeFor(home)
+	if err != nil {
+		return err
+	}
+	if err := store.MakeBucket(ctx, bucketName); err != nil {
+		return fmt.Errorf("failed to create bucket %q: %w", bucketName, err)
+	}
+
+	g.absentBuckets.Delete(bucketName)
+	g.knownBuckets.Store(bucketName, struct{}{})
+	log.Printf("created bucket %s on instance %s", bucketName, home)
+	return nil
+}
+
+// ListBuckets returns the names of all buckets, including the default bucket.
+func (g *Gateway) ListBuckets(ctx context.Context) ([]string, error) {
+	names := []string{g.defaultBucket}
+	for _, instanceID := range g.hasher.Instances() {
+		store, err := g.storeFor(instanceID)
+		if err != nil {
+			return nil, err
+		}
+		buckets, err := store.ListBuckets(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list buckets on instance %s: %w", instanceID, err)
+		}
+		names = append(names, buckets...)
+	}
+
+	slices.Sort(names)
+	return slices.Compact(names), nil
+}
+
+// DeleteBucket removes an empty bucket from every instance. The default
+// bucket cannot be deleted. The home instance's copy goes last, so a failure
+// part-way leaves the bucket where CreateBucket puts it and a retry can
+// finish the job.
+func (g *Gateway) DeleteBucket(ctx context.Context, bucketName string) error {
+	if err := ValidateBucketName(bucketName); err != nil {
+		return err
+	}
+	if bucketName == g.defaultBucket {
+		return fmt.Errorf("%w: the default bucket cannot be deleted", ErrInvalidBucketName)
+	}
+	defer g.bucketLocks.Lock(bucketName)()
+
+	holders, err := g.bucketHolders(ctx, bucketName)
+	if err != nil {
+		return err
+	}
+	if len(holders) == 0 {
+		return fmt.Errorf("%w: %s", ErrBucketNotFound, bucketName)
+	}
+
+	home, err := g.hasher.SelectInstance(bucketName)
+	if err != nil {
+		return fmt.Errorf("failed to select instance: %w", err)
+	}
+	if i := slices.Index(holders, home); i >= 0 {
+		holders = append(slices.Delete(holders, i, i+1), home)
+	}
+
+	stores := make([]objectStore, len(holders))
+	for i, instanceID := range holders {
+		store, err := g.storeFor(instanceID)
+		if err != nil {
+			return err
+		}
+		empty, err := store.PrefixEmpty(ctx, bucketName, "")
+		if err != nil {
+			return fmt.Errorf("failed to list bucket %q on instance %s: %w", bucketName, instanceID, err)
+		}
+		if !empty {
+			return fmt.Errorf("%w: %s", ErrBucketNotEmpty, bucketName)
+		}
+		stores[i] = store
+	}
+
+	g.knownBuckets.Delete(bucketName)
+	for i, store := range stores {
+		if err := store.RemoveBucket(ctx, bucketName); err != nil {
+			return fmt.Errorf("failed to remove bucket %q from instance %s: %w", bucketName, holders[i], err)
+		}
+	}
+
+	g.absentBuckets.Store(bucketName, time.Now().Add(missingBucketTTL))
+	log.Printf("deleted bucket %s", bucketName)
+	return nil
+}
@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGatewayBucketLifecycle(t *testing.T) {
+	gateway, stores := newBucketTestGateway(t, 3)
+	ctx := context.Background()
+
+	if err := gateway.CreateBucket(ctx, "team-a"); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if err := gateway.CreateBucket(ctx, "team-a"); !errors.Is(err, ErrBucketExists) {
+		t.Fatalf("expected ErrBucketExists, got %v", err)
+	}
+	if err := gateway.CreateBucket(ctx, defaultBucketName); !errors.Is(err, ErrBucketExists) {
+		t.Fatalf("expected ErrBucketExists for the default bucket, got %v", err)
+	}
+
+	// Only the home instance holds a new bucket.
+	home, _ := gateway.hasher.SelectInstance("team-a")
+	for instanceID, store := range stores {
+		if exists, _ := store.BucketExists(ctx, "team-a"); exists != (instanceID == home) {
+			t.Fatalf("instance %s has bucket: %v, home is %s", instanceID, exists, home)
+		}
+	}
+
+	buckets, err := gateway.ListBuckets(ctx)
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if !slices.Equal(buckets, []string{defaultBucketName, "team-a"}) {
+		t.Fatalf("unexpected buckets %v", buckets)
+	}
+
+	if _, err := gateway.PutObject(ctx, "team-a", "object1", strings.NewReader("data"), 4, PutOptions{}); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if err := gateway.DeleteBucket(ctx, "team-a"); !errors.Is(err, ErrBucketNotEmpty) {
+		t.Fatalf("expected ErrBucketNotEmpty, got %v", err)
+	}
+	if err := gateway.DeleteObject(ctx, "team-a", "object1"); err != nil {
+		t.Fatalf("delete object failed: %v", err)
+	}
+	if err := gateway.DeleteBucket(ctx, "team-a"); err != nil {
+		t.Fatalf("delete bucket failed: %v", err)
+	}
+	for instanceID, store := range stores {
+		if exists, _ := store.BucketExists(ctx, "team-a"); exists {
+			t.Fatalf("bucket still exists on instance %s", instanceID)
+		}
+	}
+
+	if _, err := gateway.GetObject(ctx, "team-a", "object1", GetOptions{}); !errors.Is(err, ErrBucketNotFound) {
+		t.Fatalf("expected ErrBucketNotFound after delete, got %v", err)
+	}
+	if err := gateway.DeleteBucket(ctx, "team-a"); !errors.Is(err, ErrBucketNotFound) {
+		t.Fatalf("expected ErrBucketNotFound, got %v", err)
+	}
+	if err := gateway.DeleteBucket(ctx, defaultBucketName); !errors.Is(err, ErrInvalidBucketName) {
+		t.Fatalf("expected the default bucket to be protected, got %v", err)
+	}
+}
+
+func TestGatewayBucketsAreSeparateNamespaces(t *testing.T) {
+	gateway, stores := newBucketTestGateway(t, 3)
+	ctx := context.Background()
+
+	if err := gateway.CreateBucket(ctx, "team-a"); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+
+	put := func(bucketName, data string) {
+		t.Helper()
+		if _, err := gateway.PutObject(ctx, bucketName, "object1", strings.NewReader(data), int64(len(data)), PutOptions{}); err != nil {
+			t.Fatalf("put to %q failed: %v", bucketName, err)
+		}
+	}
+	put("", "default")
+	put("team-a", "team")
+
+	for bucketName, want := range map[string]string{"": "default", defaultBucketName: "default", "team-a": "team"} {
+		object, err := gateway.GetObject(ctx, bucketName, "object1", GetOptions{})
+		if err != nil {
+			t.Fatalf("get from %q failed: %v", bucketName, err)
+		}
+		got, _ := io.ReadAll(object)
+		object.Close()
+		if string(got) != want {
+			t.Fatalf("bucket %q returned %q, want %q", bucketName, got, want)
+		}
+	}
+
+	// The write created the bucket lazily on the object's owner.
+	owner, _ := gateway.hasher.SelectInstance("object1")
+	if exists, _ := stores[owner].BucketExists(ctx, "team-a"); !exists {
+		t.Fatalf("bucket was not created on owner %s", owner)
+	}
+
+	if err := gateway.DeleteObject(ctx, "team-a", "object1"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if _, err := gateway.StatObject(ctx, "", "object1", GetOptions{}); err != nil {
+		t.Fatalf("default bucket object affected by delete: %v", err)
+	}
+}
+
+func TestGatewayUnknownBucket(t *testing.T) {
+	gateway, _ := newBucketTestGateway(t, 2)
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		bucketName string
+		want       error
+	}{
+		{name: "missing", bucketName: "missing", want: ErrBucketNotFound},
+		{name: "invalid", bucketName: "Not_Valid", want: ErrInvalidBucketName},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := gateway.PutObject(ctx, tt.bucketName, "object1", strings.NewReader("data"), 4, PutOptions{}); !errors.Is(err, tt.want) {
+				t.Fatalf("PutObject() error = %v, want %v", err, tt.want)
+			}
+			if _, err := gateway.GetObject(ctx, tt.bucketName, "object1", GetOptions{}); !errors.Is(err, tt.want) {
+				t.Fatalf("GetObject() error = %v, want %v", err, tt.want)
+			}
+			if err := gateway.DeleteObject(ctx, tt.bucketName, "object1"); !errors.Is(err, tt.want) {
+				t.Fatalf("DeleteObject() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// newBucketTestGateway returns a gateway with a separate fake store per instance.
+func newBucketTestGateway(t *testing.T, instances int) (*Gateway, map[string]*fakeStore) {
+	t.Helper()
+
+	gateway, err := NewGateway(testInstances(instances))
+	if err != nil {
+		t.Fatalf("failed to create gateway: %v", err)
+	}
+	t.Cleanup(func() { _ = gateway.Close() })
+
+	stores := make(map[string]*fakeStore, instances)
+	for _, instanceID := range gateway.hasher.instances {
+		stores[instanceID] = newFakeStore()
+	}
+	gateway.storeFor = func(instanceID string) (objectStore, error) {
+		return stores[instanceID], nil
+	}
+
+	return gateway, stores
+}
+
+func TestGatewayRemembersAbsentBuckets(t *testing.T) {
+	gateway, stores := newBucketTestGateway(t, 3)
+	ctx := context.Background()
+
+	bucketChecks := func() int {
+		total := 0
+		for _, store := range stores {
+			store.mu.Lock()
+			total += store.bucketChecks
+			store.mu.Unlock()
+		}
+		return total
+	}
+
+	if _, err := gateway.GetObject(ctx, "missing", "object1", GetOptions{}); !errors.Is(err, ErrBucketNotFound) {
+		t.Fatalf("expected ErrBucketNotFound, got %v", err)
+	}
+	checks := bucketChecks()
+	if _, err := gateway.GetObject(ctx, "missing", "object1", GetOptions{}); !errors.Is(err, ErrBucketNotFound) {
+		t.Fatalf("expected ErrBucketNotFound, got %v", err)
+	}
+	if got := bucketChecks(); got != checks {
+		t.Fatalf("absent bucket was checked again: %d BucketExists calls, want %d", got, checks)
+	}
+
+	// Creating the bucket forgets that it was absent.
+	if err := gateway.CreateBucket(ctx, "missing"); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if _, err := gateway.PutObject(ctx, "missing", "object1", strings.NewReader("data"), 4, PutOptions{}); err != nil {
+		t.Fatalf("put after create failed: %v", err)
+	}
+}
+
+func TestGatewayWriteDoesNotRecreateDeletedBucket(t *testing.T) {
+	gateway, stores := newBucketTestGateway(t, 3)
+	ctx := context.Background()
+
+	if err := gateway.CreateBucket(ctx, "team-a"); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	bucketName, err := gateway.resolveBucket(ctx, "team-a")
+	if err != nil {
+		t.Fatalf("resolve failed: %v", err)
+	}
+	if err := gateway.DeleteBucket(ctx, bucketName); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+
+	// A write that resolved the bucket before it was deleted must not bring
+	// it back on an instance that never had it.
+	for instanceID, store := range stores {
+		if err := gateway.ensureBucket(ctx, store, bucketName); !errors.Is(err, ErrBucketNotFound) {
+			t.Fatalf("ensureBucket on %s: expected ErrBucketNotFound, got %v", instanceID, err)
+		}
+		if exists, _ := store.BucketExists(ctx, bucketName); exists {
+			t.Fatalf("bucket recreated on instance %s", instanceID)
+		}
+	}
+}
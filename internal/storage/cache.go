@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"container/list"
+	"sync"
+)
+
+// CacheStats reports the activity of the in-memory object cache.
+type CacheStats struct {
+	Enabled   bool  `json:"enabled"`
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+	Entries   int   `json:"entries"`
+	Bytes     int64 `json:"bytes"`
+	MaxBytes  int64 `json:"maxBytes"`
+}
+
+// objectCache is a size-bounded LRU of small object bodies. Invalidating a
+// key fences off the reads of that key still in flight, so a read that
+// started before a write can not put the old body back afterwards.
+type objectCache struct {
+	mu            sync.Mutex
+	maxBytes      int64
+	maxObjectSize int64
+	bytes         int64
+	entries       *list.List
+	items         map[string]*list.Element
+	inflight      map[string]*inflightReads
+	hits          int64
+	misses        int64
+	evictions     int64
+}
+
+// inflightReads counts the reads of one key that may still add a body and
+// the invalidations of the key since the first of them began.
+type inflightReads struct {
+	readers       int
+	invalidations uint64
+}
+
+// fetchToken identifies a read that may add its body to the cache.
+type fetchToken struct {
+	key           string
+	invalidations uint64
+}
+
+type cacheEntry struct {
+	key  string
+	info ObjectInfo
+	data []byte
+}
+
+func newObjectCache(maxBytes, maxObjectSize int64) *objectCache {
+	return &objectCache{
+		maxBytes:      maxBytes,
+		maxObjectSize: maxObjectSize,
+		entries:       list.New(),
+		items:         make(map[string]*list.Element),
+		inflight:      make(map[string]*inflightReads),
+	}
+}
+
+func (e *cacheEntry) cost() int64 {
+	return int64(len(e.key) + len(e.data))
+}
+
+// cacheable reports whether a body of the given size may be cached.
+func (c *objectCache) cacheable(size int64) bool {
+	return size >= 0 && size <= c.maxObjectSize && size <= c.maxBytes
+}
+
+// get returns the cached entry for objectKey if its body can be served to a
+// client with the given Accept-Encoding.
+func (c *objectCache) get(objectKey, acceptEncoding string) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.items[objectKey]
+	if ok {
+		entry := element.Value.(*cacheEntry)
+		if entry.info.ContentEncoding == "" || acceptsEncoding(acceptEncoding, entry.info.ContentEncoding) {
+			c.entries.MoveToFront(element)
+			c.hits++
+			return entry, true
+		}
+	}
+
+	c.misses++
+	return nil, false
+}
+
+// beginFetch registers a read of objectKey. The read passes the token to add
+// once it has the body and hands it to endFetch when it is done.
+func (c *objectCache) beginFetch(objectKey string) fetchToken {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	reads, ok := c.inflight[objectKey]
+	if !ok {
+		reads = &inflightReads{}
+		c.inflight[objectKey] = reads
+	}
+	reads.readers++
+	return fetchToken{key: objectKey, invalidations: reads.invalidations}
+}
+
+// endFetch unregisters the read holding token.
+func (c *objectCache) endFetch(token fetchToken) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if reads, ok := c.inflight[token.key]; ok {
+		if reads.readers--; reads.readers == 0 {
+			delete(c.inflight, token.key)
+		}
+	}
+}
+
+// add stores the body of the read holding token, unless its key was
+// invalidated since the read began.
+func (c *objectCache) add(token fetchToken, info ObjectInfo, data []byte) {
+	objectKey := token.key
+	entry := &cacheEntry{key: objectKey, info: info, data: data}
+	if !c.cacheable(int64(len(data))) || entry.cost() > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if reads, ok := c.inflight[objectKey]; !ok || reads.invalidations != token.invalidations {
+		return
+	}
+
+	if element, ok := c.items[objectKey]; ok {
+		c.remove(element)
+	}
+	c.items[objectKey] = c.entries.PushFront(entry)
+	c.bytes += entry.cost()
+
+	for c.bytes > c.maxBytes {
+		c.remove(c.entries.Back())
+		c.evictions++
+	}
+}
+
+// invalidate drops objectKey and fences off reads that are still in flight.
+func (c *objectCache) invalidate(objectKey string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if reads, ok := c.inflight[objectKey]; ok {
+		reads.invalidations++
+	}
+	if element, ok := c.items[objectKey]; ok {
+		c.remove(element)
+	}
+}
+
+func (c *objectCache) remove(element *list.Element) {
+	entry := c.entries.Remove(element).(*cacheEntry)
+	delete(c.items, entry.key)
+	c.bytes -= entry.cost()
+}
+
+func (c *objectCache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{
+		Enabled:   true,
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Entries:   len(c.items),
+		Bytes:     c.bytes,
+		MaxBytes:  c.maxBytes,
+	}
+}
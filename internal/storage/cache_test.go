@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestObjectCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newObjectCache(30, 10)
+
+	for _, key := range []string{"a", "b", "c"} {
+		addFetched(cache, key, ObjectInfo{Key: key}, []byte("123456789"))
+	}
+	if _, ok := cache.get("a", ""); !ok {
+		t.Fatal("expected a to be cached")
+	}
+
+	addFetched(cache, "d", ObjectInfo{Key: "d"}, []byte("123456789"))
+
+	if _, ok := cache.get("b", ""); ok {
+		t.Fatal("expected least recently used entry b to be evicted")
+	}
+	for _, key := range []string{"a", "c", "d"} {
+		if _, ok := cache.get(key, ""); !ok {
+			t.Fatalf("expected %s to be cached", key)
+		}
+	}
+
+	stats := cache.stats()
+	if stats.Entries != 3 || stats.Bytes != 30 || stats.Evictions != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if stats.Hits != 4 || stats.Misses != 1 {
+		t.Fatalf("expected 4 hits and 1 miss, got %+v", stats)
+	}
+}
+
+func TestObjectCache_SkipsLargeObjects(t *testing.T) {
+	cache := newObjectCache(100, 4)
+
+	addFetched(cache, "a", ObjectInfo{}, []byte("12345"))
+	if _, ok := cache.get("a", ""); ok {
+		t.Fatal("expected object above threshold not to be cached")
+	}
+}
+
+func TestObjectCache_InvalidateFencesInFlightReads(t *testing.T) {
+	cache := newObjectCache(100, 10)
+
+	stale := cache.beginFetch("a")
+	other := cache.beginFetch("b")
+	cache.invalidate("a")
+	cache.add(stale, ObjectInfo{}, []byte("stale"))
+	cache.add(other, ObjectInfo{}, []byte("fresh"))
+	cache.endFetch(stale)
+	cache.endFetch(other)
+
+	if _, ok := cache.get("a", ""); ok {
+		t.Fatal("expected read started before invalidation not to be cached")
+	}
+	if _, ok := cache.get("b", ""); !ok {
+		t.Fatal("expected read of another key to be cached")
+	}
+	if len(cache.inflight) != 0 {
+		t.Fatalf("finished reads still tracked: %v", cache.inflight)
+	}
+}
+
+// addFetched adds data as a read of objectKey that saw no invalidation.
+func addFetched(cache *objectCache, objectKey string, info ObjectInfo, data []byte) {
+	token := cache.beginFetch(objectKey)
+	cache.add(token, info, data)
+	cache.endFetch(token)
+}
+
+func TestObjectCache_MatchesEncoding(t *testing.T) {
+	cache := newObjectCache(100, 10)
+	addFetched(cache, "a", ObjectInfo{ContentEncoding: CompressionGzip}, []byte("gz"))
+
+	if _, ok := cache.get("a", ""); ok {
+		t.Fatal("expected compressed entry not to be served without Accept-Encoding")
+	}
+	if _, ok := cache.get("a", "gzip"); !ok {
+		t.Fatal("expected compressed entry to be served to gzip clients")
+	}
+}
+
+func TestGatewayObjectCache(t *testing.T) {
+	gateway, store := newTestGateway(t, WithObjectCache(1<<20, 64))
+	ctx := context.Background()
+
+	if _, err := gateway.PutObject(ctx, "", "object1", strings.NewReader("cached"), 6, PutOptions{}); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	assertCachedBody(t, gateway, "object1", GetOptions{}, "cached")
+
+	// Change the backend behind the gateway's back: cached reads do not see it.
+	store.setObject("object1", fakeObject{data: []byte("direct"), attrs: store.object("object1").attrs})
+	assertCachedBody(t, gateway, "object1", GetOptions{}, "cached")
+	assertCachedBody(t, gateway, "object1", GetOptions{BypassCache: true}, "direct")
+
+	if _, err := gateway.PutObject(ctx, "", "object1", strings.NewReader("updated"), 7, PutOptions{}); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	assertCachedBody(t, gateway, "object1", GetOptions{}, "updated")
+
+	info, err := gateway.StatObject(ctx, "", "object1", GetOptions{})
+	if err != nil || info.Size != 7 {
+		t.Fatalf("unexpected stat %+v, %v", info, err)
+	}
+
+	if err := gateway.DeleteObject(ctx, "", "object1"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if _, err := gateway.GetObject(ctx, "", "object1", GetOptions{}); err == nil {
+		t.Fatal("expected deleted object not to be served from cache")
+	}
+
+	stats := gateway.CacheStats()
+	if !stats.Enabled || stats.Hits != 2 || stats.Misses != 3 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestGatewayObjectCache_Disabled(t *testing.T) {
+	gateway, _ := newTestGateway(t)
+
+	if stats := gateway.CacheStats(); stats.Enabled {
+		t.Fatalf("expected cache to be disabled, got %+v", stats)
+	}
+}
+
+func assertCachedBody(t *testing.T, gateway *Gateway, objectKey string, opts GetOptions, want string) {
+	t.Helper()
+
+	object, err := gateway.GetObject(context.Background(), "", objectKey, opts)
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	defer object.Close()
+
+	got, err := io.ReadAll(object)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if !bytes.Equal(got, []byte(want)) {
+		t.Fatalf("body = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,253 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// Coalesced reads share one backend fetch. The body is pumped in chunks to
+// every reader through bounded channels, so a flight holds at most
+// coalesceBufferedChunks+2 chunks however many readers it serves; the
+// slowest reader sets the pace for all of them.
+const (
+	coalesceChunkSize      = 64 << 10
+	coalesceBufferedChunks = 8
+)
+
+// coalescer groups concurrent reads of the same object representation.
+// Readers can join a flight until its backend fetch has returned or every
+// reader has left it; later readers start a new flight.
+type coalescer struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+type flight struct {
+	objectKey string
+	ready     chan struct{}
+	info      ObjectInfo
+	err       error
+
+	cancel  context.CancelFunc
+	mu      sync.Mutex
+	readers []*flightReader
+	// abandoned is set when the last reader left and the fetch was cancelled.
+	abandoned bool
+}
+
+func newCoalescer() *coalescer {
+	return &coalescer{flights: make(map[string]*flight)}
+}
+
+func flightKey(objectKey string, opts GetOptions) string {
+	return objectKey + "\x00" + opts.AcceptEncoding + "\x00" + strconv.FormatBool(opts.BypassCache)
+}
+
+// get returns the object through the flight for its key, starting one with
+// fetch when none is open for joining.
+func (c *coalescer) get(ctx context.Context, objectKey string, opts GetOptions, fetch func(ctx context.Context) (*Object, error)) (*Object, error) {
+	key := flightKey(objectKey, opts)
+
+	c.mu.Lock()
+	var reader *flightReader
+	f, open := c.flights[key]
+	if open {
+		reader = f.join()
+	}
+	if reader == nil {
+		// The fetch outlives the request that started it: other readers
+		// may depend on it. It is cancelled once every reader has left.
+		fetchCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &flight{objectKey: objectKey, ready: make(chan struct{}), cancel: cancel}
+		c.flights[key] = f
+		go c.run(fetchCtx, key, f, fetch)
+		reader = f.join()
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-f.ready:
+	case <-ctx.Done():
+		reader.Close()
+		return nil, ctx.Err()
+	}
+
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &Object{ReadCloser: reader, Info: f.info}, nil
+}
+
+// forget closes the flights of objectKey to new readers, so reads that start
+// after a write never join a fetch that began before it.
+func (c *coalescer) forget(objectKey string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, f := range c.flights {
+		if f.objectKey == objectKey {
+			delete(c.flights, key)
+		}
+	}
+}
+
+func (c *coalescer) run(ctx context.Context, key string, f *flight, fetch func(ctx context.Context) (*Object, error)) {
+	object, err := fetch(ctx)
+
+	c.mu.Lock()
+	if c.flights[key] == f {
+		delete(c.flights, key)
+	}
+	c.mu.Unlock()
+
+	if err == nil {
+		f.info = object.Info
+	}
+	f.err = err
+	close(f.ready)
+
+	if err != nil {
+		f.cancel()
+		return
+	}
+	defer f.cancel()
+	defer object.Close()
+
+	f.pump(object)
+}
+
+// join attaches a new reader, or returns nil when the flight was abandoned.
+func (f *flight) join() *flightReader {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.abandoned {
+		return nil
+	}
+	reader := &flightReader{
+		flight: f,
+		chunks: make(chan []byte, coalesceBufferedChunks),
+		done:   make(chan struct{}),
+	}
+	f.readers = append(f.readers, reader)
+	return reader
+}
+
+// leave drops a reader and cancels the fetch once nobody is left. The
+// flight then takes no new readers, since they would only see the fetch
+// fail with context.Canceled.
+func (f *flight) leave(reader *flightReader) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, r := range f.readers {
+		if r == reader {
+			f.readers = append(f.readers[:i], f.readers[i+1:]...)
+			break
+		}
+	}
+	if len(f.readers) == 0 {
+		f.abandoned = true
+		f.cancel()
+	}
+}
+
+func (f *flight) activeReaders() []*flightReader {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*flightReader(nil), f.readers...)
+}
+
+// pump copies the body chunk by chunk to every reader still attached.
+func (f *flight) pump(body io.Reader) {
+	for {
+		readers := f.activeReaders()
+		if len(readers) == 0 {
+			return
+		}
+
+		chunk, err := readChunk(body)
+		if len(chunk) > 0 {
+			for _, reader := range readers {
+				reader.send(chunk)
+			}
+		}
+
+		if err != nil {
+			for _, reader := range f.activeReaders() {
+				reader.finish(err)
+			}
+			return
+		}
+	}
+}
+
+// readChunk reads up to coalesceChunkSize bytes, passing on the body's own
+// error so a truncated body is not mistaken for a complete one.
+func readChunk(body io.Reader) ([]byte, error) {
+	chunk := make([]byte, coalesceChunkSize)
+	n := 0
+	for n < len(chunk) {
+		read, err := body.Read(chunk[n:])
+		n += read
+		if err != nil {
+			return chunk[:n], err
+		}
+	}
+	return chunk[:n], nil
+}
+
+// flightReader is one reader's view of a shared body.
+type flightReader struct {
+	flight  *flight
+	chunks  chan []byte
+	done    chan struct{}
+	pending []byte
+	err     error
+
+	closeOnce sync.Once
+}
+
+// send blocks until the reader takes the chunk or goes away.
+func (r *flightReader) send(chunk []byte) {
+	select {
+	case r.chunks <- chunk:
+	case <-r.done:
+	}
+}
+
+func (r *flightReader) finish(err error) {
+	select {
+	case <-r.done:
+	default:
+		r.err = err
+		close(r.chunks)
+	}
+}
+
+func (r *flightReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		chunk, ok := <-r.chunks
+		if !ok {
+			if r.err == nil {
+				return 0, io.EOF
+			}
+			return 0, r.err
+		}
+		r.pending = chunk
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *flightReader) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.done)
+		r.flight.leave(r)
+	})
+	return nil
+}
@@ -0,0 +1,239 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGatewayRequestCoalescing(t *testing.T) {
+	gateway, store := newTestGateway(t, WithRequestCoalescing())
+	payload := bytes.Repeat([]byte("0123456789"), coalesceChunkSize/4)
+	if _, err := gateway.PutObject(context.Background(), "", "object1", bytes.NewReader(payload), int64(len(payload)), PutOptions{}); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+
+	blocking := newBlockingStore(store)
+	gateway.storeFor = func(instanceID string) (objectStore, error) {
+		return blocking, nil
+	}
+
+	const readers = 20
+	bodies := make([][]byte, readers)
+	errs := make([]error, readers)
+	var wg sync.WaitGroup
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			object, err := gateway.GetObject(context.Background(), "", "object1", GetOptions{})
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer object.Close()
+			bodies[i], errs[i] = io.ReadAll(object)
+		}(i)
+	}
+
+	waitForFlightReaders(t, gateway.coalescer, objectPath(defaultBucketName, "object1"), readers)
+	close(blocking.release)
+	wg.Wait()
+
+	for i := 0; i < readers; i++ {
+		if errs[i] != nil {
+			t.Fatalf("reader %d failed: %v", i, errs[i])
+		}
+		if !bytes.Equal(bodies[i], payload) {
+			t.Fatalf("reader %d got %d bytes, want %d", i, len(bodies[i]), len(payload))
+		}
+	}
+	if got := blocking.gets.Load(); got != 1 {
+		t.Fatalf("expected one backend read, got %d", got)
+	}
+}
+
+func TestGatewayRequestCoalescing_ReaderLeavesEarly(t *testing.T) {
+	gateway, store := newTestGateway(t, WithRequestCoalescing())
+	payload := bytes.Repeat([]byte("x"), 4*coalesceChunkSize)
+	if _, err := gateway.PutObject(context.Background(), "", "object1", bytes.NewReader(payload), int64(len(payload)), PutOptions{}); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+
+	blocking := newBlockingStore(store)
+	gateway.storeFor = func(instanceID string) (objectStore, error) {
+		return blocking, nil
+	}
+
+	results := make(chan *Object, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			object, err := gateway.GetObject(context.Background(), "", "object1", GetOptions{})
+			if err != nil {
+				t.Errorf("get failed: %v", err)
+			}
+			results <- object
+		}()
+	}
+	waitForFlightReaders(t, gateway.coalescer, objectPath(defaultBucketName, "object1"), 2)
+	close(blocking.release)
+
+	first, second := <-results, <-results
+	if first == nil || second == nil {
+		t.FailNow()
+	}
+
+	// A reader that stops early must not stall the other one.
+	first.Close()
+	got, err := io.ReadAll(second)
+	second.Close()
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Fatalf("got %d bytes, want %d", len(got), len(payload))
+	}
+}
+
+func TestGatewayRequestCoalescing_SharesErrors(t *testing.T) {
+	gateway, _ := newTestGateway(t, WithRequestCoalescing())
+
+	_, err := gateway.GetObject(context.Background(), "", "missing", GetOptions{})
+	if !errors.Is(err, ErrObjectNotFound) {
+		t.Fatalf("expected ErrObjectNotFound, got %v", err)
+	}
+}
+
+func TestGatewayRequestCoalescing_WriteStartsNewFlight(t *testing.T) {
+	gateway, store := newTestGateway(t, WithRequestCoalescing())
+	if _, err := gateway.PutObject(context.Background(), "", "object1", strings.NewReader("old"), 3, PutOptions{}); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+
+	blocking := newBlockingStore(store)
+	gateway.storeFor = func(instanceID string) (objectStore, error) {
+		return blocking, nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		object, err := gateway.GetObject(context.Background(), "", "object1", GetOptions{})
+		if err == nil {
+			io.Copy(io.Discard, object)
+			object.Close()
+		}
+	}()
+	waitForFlightReaders(t, gateway.coalescer, objectPath(defaultBucketName, "object1"), 1)
+
+	gateway.coalescer.forget(objectPath(defaultBucketName, "object1"))
+	if got := flightReaders(gateway.coalescer, objectPath(defaultBucketName, "object1")); got != 0 {
+		t.Fatalf("expected forgotten flight to take no new readers, found %d", got)
+	}
+	close(blocking.release)
+	<-done
+}
+
+func TestCoalescer_JoinAfterLastReaderLeft(t *testing.T) {
+	c := newCoalescer()
+	release := make(chan struct{})
+	var fetches atomic.Int64
+	fetch := func(ctx context.Context) (*Object, error) {
+		fetches.Add(1)
+		<-release
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return &Object{ReadCloser: io.NopCloser(strings.NewReader("body")), Info: ObjectInfo{Key: "object1"}}, nil
+	}
+
+	// The only reader gives up while the fetch is still running.
+	ctx, cancel := context.WithCancel(context.Background())
+	left := make(chan error, 1)
+	go func() {
+		_, err := c.get(ctx, "object1", GetOptions{}, fetch)
+		left <- err
+	}()
+	waitForFlightReaders(t, c, "object1", 1)
+	cancel()
+	if err := <-left; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the leaving reader to see context.Canceled, got %v", err)
+	}
+
+	// A reader arriving before the abandoned fetch returns gets a fresh one.
+	joined := make(chan error, 1)
+	var body []byte
+	go func() {
+		object, err := c.get(context.Background(), "object1", GetOptions{}, fetch)
+		if err == nil {
+			body, err = io.ReadAll(object)
+			object.Close()
+		}
+		joined <- err
+	}()
+	waitForFlightReaders(t, c, "object1", 1)
+	close(release)
+
+	if err := <-joined; err != nil {
+		t.Fatalf("get after the last reader left failed: %v", err)
+	}
+	if string(body) != "body" {
+		t.Fatalf("got body %q, want %q", body, "body")
+	}
+	if got := fetches.Load(); got != 2 {
+		t.Fatalf("expected a second fetch, got %d", got)
+	}
+}
+
+// blockingStore holds every StatObject until release is closed and counts GetObject calls.
+type blockingStore struct {
+	*fakeStore
+	release chan struct{}
+	gets    atomic.Int64
+}
+
+func newBlockingStore(store *fakeStore) *blockingStore {
+	return &blockingStore{fakeStore: store, release: make(chan struct{})}
+}
+
+func (b *blockingStore) StatObject(ctx context.Context, bucketName, objectKey string) (storeObject, error) {
+	<-b.release
+	return b.fakeStore.StatObject(ctx, bucketName, objectKey)
+}
+
+func (b *blockingStore) GetObject(ctx context.Context, bucketName, objectKey string) (io.ReadCloser, error) {
+	b.gets.Add(1)
+	return b.fakeStore.GetObject(ctx, bucketName, objectKey)
+}
+
+func flightReaders(c *coalescer, objectKey string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	count := 0
+	for _, f := range c.flights {
+		if f.objectKey == objectKey {
+			count += len(f.activeReaders())
+		}
+	}
+	return count
+}
+
+func waitForFlightReaders(t *testing.T, c *coalescer, objectKey string, want int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if flightReaders(c, objectKey) == want {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("expected %d readers to join the flight, found %d", want, flightReaders(c, objectKey))
+}
@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// CompressionNone stores objects exactly as received.
+	CompressionNone = "none"
+	// CompressionGzip stores objects gzip-compressed.
+	CompressionGzip = "gzip"
+	// CompressionZstd stores objects zstd-compressed.
+	CompressionZstd = "zstd"
+)
+
+// Metadata keys recorded on compressed objects.
+const (
+	metaCodec        = "Gateway-Codec"
+	metaOriginalSize = "Gateway-Original-Size"
+)
+
+// maxInlineCompressSize is the largest object compressed in memory so the
+// upload keeps a known length; larger objects are streamed.
+const maxInlineCompressSize = 8 << 20
+
+// defaultCompressibleTypes lists content type prefixes compressed when
+// compression is enabled without an explicit list.
+var defaultCompressibleTypes = []string{
+	"application/json",
+	"application/x-ndjson",
+	"application/xml",
+	"text/",
+}
+
+type compressionPolicy struct {
+	codec        string
+	contentTypes []string
+}
+
+// selectCodec returns the codec for an upload. An explicitly requested codec
+// wins; otherwise the policy codec applies when the content type matches.
+func (p compressionPolicy) selectCodec(requested, contentType string) (string, error) {
+	if requested != "" {
+		codec := strings.ToLower(strings.TrimSpace(requested))
+		if codec == "identity" {
+			codec = CompressionNone
+		}
+		if !isKnownCodec(codec) {
+			return "", fmt.Errorf("%w: %q", ErrUnsupportedCompression, requested)
+		}
+		return codec, nil
+	}
+
+	if p.codec == "" || p.codec == CompressionNone {
+		return CompressionNone, nil
+	}
+
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	if mediaType == "" {
+		return CompressionNone, nil
+	}
+	for _, prefix := range p.contentTypes {
+		if strings.HasPrefix(mediaType, prefix) {
+			return p.codec, nil
+		}
+	}
+
+	return CompressionNone, nil
+}
+
+func isKnownCodec(codec string) bool {
+	switch codec {
+	case CompressionNone, CompressionGzip, CompressionZstd:
+		return true
+	default:
+		return false
+	}
+}
+
+// compressObject returns the compressed form of data and its length, or -1
+// when the length is unknown because the data is compressed while streaming.
+func compressObject(data io.Reader, size int64, codec string) (io.ReadCloser, int64, error) {
+	if size <= maxInlineCompressSize {
+		var buf bytes.Buffer
+		encoder, err := newEncoder(&buf, codec)
+		if err != nil {
+			return nil, 0, err
+		}
+		if _, err := io.Copy(encoder, data); err != nil {
+			return nil, 0, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, 0, fmt.Errorf("failed to finish %s stream: %w", codec, err)
+		}
+		return io.NopCloser(&buf), int64(buf.Len()), nil
+	}
+
+	pr, pw := io.Pipe()
+	encoder, err := newEncoder(pw, codec)
+	if err != nil {
+		return nil, 0, err
+	}
+	go func() {
+		_, err := io.Copy(encoder, data)
+		if closeErr := encoder.Close(); err == nil {
+			err = closeErr
+		}
+		pw.CloseWithError(err)
+	}()
+
+	return pr, -1, nil
+}
+
+func newEncoder(w io.Writer, codec string) (io.WriteCloser, error) {
+	switch codec {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedCompression, codec)
+	}
+}
+
+// decompressObject wraps a compressed object body with a decoder for codec.
+func decompressObject(body io.ReadCloser, codec string) (io.ReadCloser, error) {
+	switch codec {
+	case CompressionGzip:
+		decoder, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open gzip stream: %w", err)
+		}
+		return &decodingReadCloser{Reader: decoder, body: body, close: decoder.Close}, nil
+	case CompressionZstd:
+		decoder, err := zstd.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open zstd stream: %w", err)
+		}
+		return &decodingReadCloser{Reader: decoder, body: body, close: func() error {
+			decoder.Close()
+			return nil
+		}}, nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedCompression, codec)
+	}
+}
+
+type decodingReadCloser struct {
+	io.Reader
+	body  io.Closer
+	close func() error
+}
+
+func (d *decodingReadCloser) Close() error {
+	decoderErr := d.close()
+	if err := d.body.Close(); err != nil {
+		return err
+	}
+	return decoderErr
+}
+
+// storedCodec reports the codec recorded for an object and its original size.
+func storedCodec(metadata map[string]string) (codec string, originalSize int64, err error) {
+	codec = metadata[metaCodec]
+	if codec == "" || codec == CompressionNone {
+		return CompressionNone, -1, nil
+	}
+	if !isKnownCodec(codec) {
+		return "", 0, fmt.Errorf("%w: %q", ErrUnsupportedCompression, codec)
+	}
+
+	originalSize, err = strconv.ParseInt(metadata[metaOriginalSize], 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid original size metadata: %w", err)
+	}
+
+	return codec, originalSize, nil
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header value allows codec.
+func acceptsEncoding(acceptEncoding, codec string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), codec) {
+			continue
+		}
+		quality := strings.TrimSpace(params)
+		if q, ok := strings.CutPrefix(quality, "q="); ok {
+			if value, err := strconv.ParseFloat(q, 64); err == nil && value == 0 {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCompressionPolicySelectCodec(t *testing.T) {
+	policy := compressionPolicy{codec: CompressionZstd, contentTypes: defaultCompressibleTypes}
+
+	tests := []struct {
+		name        string
+		policy      compressionPolicy
+		requested   string
+		contentType string
+		want        string
+		wantErr     bool
+	}{
+		{name: "json", policy: policy, contentType: "application/json; charset=utf-8", want: CompressionZstd},
+		{name: "text prefix", policy: policy, contentType: "text/plain", want: CompressionZstd},
+		{name: "binary", policy: policy, contentType: "application/octet-stream", want: CompressionNone},
+		{name: "missing content type", policy: policy, want: CompressionNone},
+		{name: "requested overrides type", policy: policy, requested: "GZIP", contentType: "image/png", want: CompressionGzip},
+		{name: "identity disables", policy: policy, requested: "identity", contentType: "text/plain", want: CompressionNone},
+		{name: "policy disabled", contentType: "application/json", want: CompressionNone},
+		{name: "unknown codec", policy: policy, requested: "brotli", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.policy.selectCodec(tt.requested, tt.contentType)
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnsupportedCompression) {
+					t.Fatalf("selectCodec() error = %v, want ErrUnsupportedCompression", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("selectCodec() unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("selectCodec() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompressObjectRoundTrip(t *testing.T) {
+	small := strings.Repeat("log line\n", 100)
+	large := strings.Repeat("x", maxInlineCompressSize+1)
+
+	for _, codec := range []string{CompressionGzip, CompressionZstd} {
+		for _, payload := range []string{small, large} {
+			compressed, size, err := compressObject(strings.NewReader(payload), int64(len(payload)), codec)
+			if err != nil {
+				t.Fatalf("compressObject(%s) unexpected error: %v", codec, err)
+			}
+			if payload == large && size != -1 {
+				t.Fatalf("compressObject(%s) size = %d, want -1 for streamed object", codec, size)
+			}
+
+			decoded, err := decompressObject(compressed, codec)
+			if err != nil {
+				t.Fatalf("decompressObject(%s) unexpected error: %v", codec, err)
+			}
+			body, err := io.ReadAll(decoded)
+			if err != nil {
+				t.Fatalf("failed to read %s stream: %v", codec, err)
+			}
+			if err := decoded.Close(); err != nil {
+				t.Fatalf("Close() unexpected error: %v", err)
+			}
+			if string(body) != payload {
+				t.Fatalf("%s round trip mismatch: got %d bytes, want %d", codec, len(body), len(payload))
+			}
+		}
+	}
+}
+
+func TestAcceptsEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		codec  string
+		want   bool
+	}{
+		{header: "gzip, deflate, br", codec: CompressionGzip, want: true},
+		{header: "gzip, zstd", codec: CompressionZstd, want: true},
+		{header: "ZSTD;q=0.8", codec: CompressionZstd, want: true},
+		{header: "zstd;q=0", codec: CompressionZstd, want: false},
+		{header: "", codec: CompressionGzip, want: false},
+		{header: "deflate", codec: CompressionGzip, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := acceptsEncoding(tt.header, tt.codec); got != tt.want {
+			t.Fatalf("acceptsEncoding(%q, %q) = %v, want %v", tt.header, tt.codec, got, tt.want)
+		}
+	}
+}
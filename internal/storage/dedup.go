@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Deduplicated payloads live under reserved prefixes that object IDs can
+// never produce. A blob is stored once per content hash on the instance the
+// hasher picks for that hash, and every object referencing it owns an empty
+// marker next to it. Counting the markers gives the blob's reference count.
+const (
+	dedupBlobPrefix = ".dedup/blobs/"
+	dedupRefPrefix  = ".dedup/refs/"
+)
+
+// metaBlob is the metadata key marking a pointer object and naming its blob hash.
+const metaBlob = "Gateway-Blob"
+
+func blobKey(blobHash string) string {
+	return dedupBlobPrefix + blobHash
+}
+
+func blobRefPrefix(blobHash string) string {
+	return dedupRefPrefix + blobHash + "/"
+}
+
+func blobRefKey(blobHash, objectKey string) string {
+	return blobRefPrefix(blobHash) + objectKey
+}
+
+// putDeduplicated spools the upload to disk to learn its hash, stores the blob
+// if it is not present yet and points objectKey at it.
+func (g *Gateway) putDeduplicated(ctx context.Context, bucketName, objectKey string, verifier *verifyingReader, codec string, attrs storeObject) (ObjectInfo, error) {
+	spool, err := os.CreateTemp("", "gateway-dedup-*")
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("failed to create spool file: %w", err)
+	}
+	defer func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}()
+
+	if _, err := io.Copy(spool, verifier); err != nil {
+		return ObjectInfo{}, err
+	}
+	blobHash := verifier.sha256Hex()
+	size := verifier.size
+
+	pointerStore, err := g.selectStore(objectKey)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	blobStore, err := g.selectStore(blobHash)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if err := g.ensureBucket(ctx, pointerStore, bucketName); err != nil {
+		return ObjectInfo{}, err
+	}
+	if err := g.ensureBucket(ctx, blobStore, bucketName); err != nil {
+		return ObjectInfo{}, err
+	}
+
+	previous := ""
+	if stat, err := pointerStore.StatObject(ctx, bucketName, objectKey); err == nil {
+		previous = stat.Metadata[metaBlob]
+	} else if !errors.Is(err, ErrObjectNotFound) {
+		return ObjectInfo{}, fmt.Errorf("failed to stat object: %w", err)
+	}
+
+	if err := g.retainBlob(ctx, blobStore, bucketName, blobHash, objectKey, spool, size, codec); err != nil {
+		return ObjectInfo{}, err
+	}
+
+	pointer := storeObject{
+		ContentType: attrs.ContentType,
+		Metadata:    maps.Clone(attrs.Metadata),
+	}
+	if pointer.Metadata == nil {
+		pointer.Metadata = map[string]string{}
+	}
+	pointer.Metadata[metaBlob] = blobHash
+	pointer.Metadata[metaSHA256] = blobHash
+	pointer.Metadata[metaOriginalSize] = strconv.FormatInt(size, 10)
+	if err := pointerStore.PutObject(ctx, bucketName, objectKey, strings.NewReader(""), 0, pointer); err != nil {
+		if previous != blobHash {
+			if releaseErr := g.releaseBlob(ctx, bucketName, blobHash, objectKey); releaseErr != nil {
+				log.Printf("PUT /object/%s - failed to release blob %s: %v", objectKey, blobHash, releaseErr)
+			}
+		}
+		return ObjectInfo{}, fmt.Errorf("failed to put pointer in minio: %w", err)
+	}
+
+	if previous != "" && previous != blobHash {
+		if err := g.releaseBlob(ctx, bucketName, previous, objectKey); err != nil {
+			log.Printf("PUT /object/%s - failed to release blob %s: %v", objectKey, previous, err)
+		}
+	}
+
+	return ObjectInfo{
+		Key:            objectKey,
+		ContentType:    attrs.ContentType,
+		Size:           size,
+		ChecksumSHA256: blobHash,
+	}, nil
+}
+
+// retainBlob records objectKey as a reference to blobHash and uploads the
+// spooled payload if the blob does not exist yet.
+func (g *Gateway) retainBlob(ctx context.Context, store objectStore, bucketName, blobHash, objectKey string, spool *os.File, size int64, codec string) error {
+	unlock := g.blobLocks.Lock(objectPath(bucketName, blobHash))
+	defer unlock()
+
+	if err := store.PutObject(ctx, bucketName, blobRefKey(blobHash, objectKey), strings.NewReader(""), 0, storeObject{}); err != nil {
+		return fmt.Errorf("failed to record blob reference: %w", err)
+	}
+
+	_, err := store.StatObject(ctx, bucketName, blobKey(blobHash))
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, ErrObjectNotFound) {
+		return fmt.Errorf("failed to stat blob: %w", err)
+	}
+
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind spool file: %w", err)
+	}
+	verifier, err := newVerifyingReader(spool, size, "", blobHash)
+	if err != nil {
+		return err
+	}
+	if size == 0 {
+		if _, err := io.Copy(io.Discard, verifier); err != nil {
+			return err
+		}
+	}
+
+	if _, err := g.writeObject(ctx, store, bucketName, blobKey(blobHash), verifier, codec, storeObject{}); err != nil {
+		return fmt.Errorf("failed to store blob: %w", err)
+	}
+
+	return nil
+}
+
+// releaseBlob drops the reference objectKey holds on blobHash in bucketName
+// and removes the blob once nothing references it any more.
+func (g *Gateway) releaseBlob(ctx context.Context, bucketName, blobHash, objectKey string) error {
+	store, err := g.selectStore(blobHash)
+	if err != nil {
+		return err
+	}
+
+	unlock := g.blobLocks.Lock(objectPath(bucketName, blobHash))
+	defer unlock()
+
+	if err := store.RemoveObject(ctx, bucketName, blobRefKey(blobHash, objectKey)); err != nil {
+		return fmt.Errorf("failed to remove blob reference: %w", err)
+	}
+
+	unreferenced, err := store.PrefixEmpty(ctx, bucketName, blobRefPrefix(blobHash))
+	if err != nil {
+		return fmt.Errorf("failed to check blob references: %w", err)
+	}
+	if !unreferenced {
+		return nil
+	}
+
+	if err := store.RemoveObject(ctx, bucketName, blobKey(blobHash)); err != nil {
+		return fmt.Errorf("failed to remove blob: %w", err)
+	}
+
+	return nil
+}
+
+// keyedMutex serializes work per key while letting distinct keys proceed
+// concurrently.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	mu      sync.Mutex
+	holders int
+}
+
+// Lock acquires the lock for key and returns the function releasing it.
+func (km *keyedMutex) Lock(key string) func() {
+	km.mu.Lock()
+	if km.locks == nil {
+		km.locks = make(map[string]*keyedLock)
+	}
+	lock, ok := km.locks[key]
+	if !ok {
+		lock = &keyedLock{}
+		km.locks[key] = lock
+	}
+	lock.holders++
+	km.mu.Unlock()
+
+	lock.mu.Lock()
+
+	return func() {
+		lock.mu.Unlock()
+
+		km.mu.Lock()
+		lock.holders--
+		if lock.holders == 0 {
+			delete(km.locks, key)
+		}
+		km.mu.Unlock()
+	}
+}
@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGatewayDeduplication(t *testing.T) {
+	gateway, store := newTestGateway(t, WithDeduplication())
+	ctx := context.Background()
+
+	payload := "identical build artifact"
+	sum := sha256.Sum256([]byte(payload))
+	blobHash := hex.EncodeToString(sum[:])
+
+	for _, objectKey := range []string{"artifact1", "artifact2"} {
+		info, err := gateway.PutObject(ctx, "", objectKey, strings.NewReader(payload), int64(len(payload)), PutOptions{ContentType: "application/zip"})
+		if err != nil {
+			t.Fatalf("PutObject(%s) unexpected error: %v", objectKey, err)
+		}
+		if info.ChecksumSHA256 != blobHash {
+			t.Fatalf("ChecksumSHA256 = %q, want %q", info.ChecksumSHA256, blobHash)
+		}
+	}
+
+	if got := len(store.keysWithPrefix(dedupBlobPrefix)); got != 1 {
+		t.Fatalf("stored %d blobs, want 1", got)
+	}
+	if got := len(store.keysWithPrefix(blobRefPrefix(blobHash))); got != 2 {
+		t.Fatalf("blob has %d references, want 2", got)
+	}
+	if pointer := store.object("artifact1"); len(pointer.data) != 0 || pointer.attrs.Metadata[metaBlob] != blobHash {
+		t.Fatalf("artifact1 is not a pointer to %s: %+v", blobHash, pointer.attrs)
+	}
+
+	object, err := gateway.GetObject(ctx, "", "artifact2", GetOptions{})
+	if err != nil {
+		t.Fatalf("GetObject() unexpected error: %v", err)
+	}
+	body, err := io.ReadAll(object)
+	object.Close()
+	if err != nil {
+		t.Fatalf("failed to read object: %v", err)
+	}
+	if string(body) != payload {
+		t.Fatalf("body = %q, want %q", body, payload)
+	}
+	if object.Info.ContentType != "application/zip" || object.Info.Size != int64(len(payload)) {
+		t.Fatalf("info = %+v, want pointer content type and payload size", object.Info)
+	}
+
+	if err := gateway.DeleteObject(ctx, "", "artifact1"); err != nil {
+		t.Fatalf("DeleteObject(artifact1) unexpected error: %v", err)
+	}
+	if got := len(store.keysWithPrefix(dedupBlobPrefix)); got != 1 {
+		t.Fatalf("blob removed while still referenced")
+	}
+
+	if err := gateway.DeleteObject(ctx, "", "artifact2"); err != nil {
+		t.Fatalf("DeleteObject(artifact2) unexpected error: %v", err)
+	}
+	if keys := store.keysWithPrefix(".dedup/"); len(keys) != 0 {
+		t.Fatalf("unreferenced dedup objects left behind: %v", keys)
+	}
+	if store.listings != 0 {
+		t.Fatalf("releasing blobs listed objects %d times, want a single-key probe", store.listings)
+	}
+}
+
+func TestGatewayDeduplicationOverwrite(t *testing.T) {
+	gateway, store := newTestGateway(t, WithDeduplication(), WithCompression(CompressionZstd))
+	ctx := context.Background()
+
+	for _, payload := range []string{`{"version":1}`, `{"version":2}`} {
+		_, err := gateway.PutObject(ctx, "", "config", strings.NewReader(payload), int64(len(payload)), PutOptions{ContentType: "application/json"})
+		if err != nil {
+			t.Fatalf("PutObject() unexpected error: %v", err)
+		}
+	}
+
+	blobs := store.keysWithPrefix(dedupBlobPrefix)
+	if len(blobs) != 1 {
+		t.Fatalf("stored blobs = %v, want only the current version", blobs)
+	}
+	if codec := store.object(blobs[0]).attrs.Metadata[metaCodec]; codec != CompressionZstd {
+		t.Fatalf("blob codec = %q, want %q", codec, CompressionZstd)
+	}
+
+	object, err := gateway.GetObject(ctx, "", "config", GetOptions{})
+	if err != nil {
+		t.Fatalf("GetObject() unexpected error: %v", err)
+	}
+	defer object.Close()
+	body, _ := io.ReadAll(object)
+	if string(body) != `{"version":2}` {
+		t.Fatalf("body = %q, want second version", body)
+	}
+}
+
+func TestGatewayDeduplicationConcurrentOverwrite(t *testing.T) {
+	gateway, store := newTestGateway(t, WithDeduplication())
+	store.statDelay = time.Millisecond
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			payload := strings.Repeat("v", i+1)
+			if _, err := gateway.PutObject(ctx, "", "config", strings.NewReader(payload), int64(len(payload)), PutOptions{}); err != nil {
+				t.Errorf("PutObject() unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Only the blob of the winning upload may stay referenced.
+	blobHash := store.object("config").attrs.Metadata[metaBlob]
+	if blobs := store.keysWithPrefix(dedupBlobPrefix); len(blobs) != 1 || blobs[0] != blobKey(blobHash) {
+		t.Fatalf("blobs = %v, want only %s", blobs, blobKey(blobHash))
+	}
+	if refs := store.keysWithPrefix(dedupRefPrefix); len(refs) != 1 || refs[0] != blobRefKey(blobHash, "config") {
+		t.Fatalf("references = %v, want only the one of config", refs)
+	}
+}
+
+func TestGatewayDeleteObjectNotFound(t *testing.T) {
+	gateway, _ := newTestGateway(t, WithDeduplication())
+
+	if err := gateway.DeleteObject(context.Background(), "", "missing"); !errors.Is(err, ErrObjectNotFound) {
+		t.Fatalf("DeleteObject() error = %v, want ErrObjectNotFound", err)
+	}
+}
+
+func TestKeyedMutex(t *testing.T) {
+	var km keyedMutex
+	var wg sync.WaitGroup
+	counter := 0
+
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := km.Lock("blob")
+			counter++
+			unlock()
+		}()
+	}
+	wg.Wait()
+
+	if counter != 50 {
+		t.Fatalf("counter = %d, want 50", counter)
+	}
+	if len(km.locks) != 0 {
+		t.Fatalf("keyedMutex kept %d idle locks", len(km.locks))
+	}
+}
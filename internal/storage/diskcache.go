@@ -0,0 +1,403 @@
+package storage
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Each cached object is a pair of files named after the SHA-256 of its key:
+// the body and a small JSON record. Both are written to a temporary file and
+// renamed into place, body first, so a record always describes a complete body.
+const (
+	diskCacheDataExt = ".data"
+	diskCacheMetaExt = ".meta"
+	diskCacheTempExt = ".tmp"
+)
+
+// diskCache is a read-through cache of object bodies on local disk, evicting
+// the least recently used bodies once maxBytes is exceeded. Entries are
+// revalidated against the backend ETag on every read.
+//
+// The files of a key are only touched while holding its lock in files, so
+// the index entry of a key always describes what is on disk for it. mu only
+// guards the index and is never held for disk I/O; take files first.
+type diskCache struct {
+	dir      string
+	maxBytes int64
+	files    keyedMutex
+
+	mu      sync.Mutex
+	bytes   int64
+	entries *list.List
+	items   map[string]*list.Element
+}
+
+// diskCacheRecord is the persisted description of a cached body.
+type diskCacheRecord struct {
+	Key             string `json:"key"`
+	ETag            string `json:"etag"`
+	ContentEncoding string `json:"contentEncoding,omitempty"`
+	Size            int64  `json:"size"`
+}
+
+// openDiskCache prepares dir and rebuilds the index from the records left by
+// a previous run, discarding partial writes and bodies without a record.
+func openDiskCache(dir string, maxBytes int64) (*diskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create disk cache directory: %w", err)
+	}
+
+	cache := &diskCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		entries:  list.New(),
+		items:    make(map[string]*list.Element),
+	}
+	if err := cache.recover(); err != nil {
+		return nil, err
+	}
+
+	return cache, nil
+}
+
+func (c *diskCache) recover() error {
+	files, err := os.ReadDir(c.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read disk cache directory: %w", err)
+	}
+
+	type recovered struct {
+		record diskCacheRecord
+		usedAt time.Time
+	}
+	var found []recovered
+	valid := make(map[string]bool)
+
+	for _, file := range files {
+		name := file.Name()
+		if strings.HasSuffix(name, diskCacheTempExt) {
+			os.Remove(filepath.Join(c.dir, name))
+			continue
+		}
+		if !strings.HasSuffix(name, diskCacheMetaExt) {
+			continue
+		}
+
+		id := strings.TrimSuffix(name, diskCacheMetaExt)
+		record, usedAt, err := c.readRecord(id)
+		if err != nil {
+			log.Printf("disk cache - dropping entry %s: %v", id, err)
+			c.removeFiles(id)
+			continue
+		}
+		found = append(found, recovered{record: record, usedAt: usedAt})
+		valid[id] = true
+	}
+
+	for _, file := range files {
+		name := file.Name()
+		if id, ok := strings.CutSuffix(name, diskCacheDataExt); ok && !valid[id] {
+			os.Remove(filepath.Join(c.dir, name))
+		}
+	}
+
+	// Oldest first, so the most recently used entry ends up at the front.
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].usedAt.Before(found[j].usedAt)
+	})
+
+	c.mu.Lock()
+	for _, entry := range found {
+		c.insert(entry.record)
+	}
+	evicted := c.evict()
+	c.mu.Unlock()
+	c.removeEvicted(evicted)
+
+	return nil
+}
+
+// readRecord loads the record with the given file id and checks it against its body.
+func (c *diskCache) readRecord(id string) (diskCacheRecord, time.Time, error) {
+	raw, err := os.ReadFile(filepath.Join(c.dir, id+diskCacheMetaExt))
+	if err != nil {
+		return diskCacheRecord{}, time.Time{}, err
+	}
+
+	var record diskCacheRecord
+	if err := json.Unmarshal(raw, &record); err != nil {
+		return diskCacheRecord{}, time.Time{}, fmt.Errorf("invalid record: %w", err)
+	}
+	if cacheFileID(record.Key) != id {
+		return diskCacheRecord{}, time.Time{}, fmt.Errorf("record belongs to another key")
+	}
+
+	info, err := os.Stat(filepath.Join(c.dir, id+diskCacheDataExt))
+	if err != nil {
+		return diskCacheRecord{}, time.Time{}, err
+	}
+	if info.Size() != record.Size {
+		return diskCacheRecord{}, time.Time{}, fmt.Errorf("body has %d bytes, record says %d", info.Size(), record.Size)
+	}
+
+	return record, info.ModTime(), nil
+}
+
+func cacheFileID(objectKey string) string {
+	sum := sha256.Sum256([]byte(objectKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// open returns the cached body of objectKey if it still matches etag and the
+// representation described by info.
+func (c *diskCache) open(objectKey, etag string, info ObjectInfo) (io.ReadCloser, bool) {
+	unlock := c.files.Lock(objectKey)
+	defer unlock()
+
+	c.mu.Lock()
+	element, ok := c.items[objectKey]
+	if !ok {
+		c.mu.Unlock()
+		return nil, false
+	}
+	record := element.Value.(diskCacheRecord)
+	if etag == "" || record.ETag != etag || record.ContentEncoding != info.ContentEncoding || record.Size != info.Size {
+		c.mu.Unlock()
+		return nil, false
+	}
+	c.entries.MoveToFront(element)
+	c.mu.Unlock()
+
+	path := filepath.Join(c.dir, cacheFileID(objectKey)+diskCacheDataExt)
+	file, err := os.Open(path)
+	if err != nil {
+		log.Printf("disk cache - failed to open %s: %v", objectKey, err)
+		c.mu.Lock()
+		if element, ok := c.items[objectKey]; ok && element.Value.(diskCacheRecord) == record {
+			c.unlink(element)
+		}
+		c.mu.Unlock()
+		c.removeFiles(cacheFileID(objectKey))
+		return nil, false
+	}
+
+	// The modification time orders entries when the index is rebuilt.
+	now := time.Now()
+	os.Chtimes(path, now, now)
+
+	return file, true
+}
+
+// fill wraps body so that a complete read stores it in the cache. Bodies that
+// are not read to the end, or fail, leave the cache untouched.
+func (c *diskCache) fill(objectKey, etag string, info ObjectInfo, body io.ReadCloser) io.ReadCloser {
+	if etag == "" || info.Size < 0 || info.Size > c.maxBytes {
+		return body
+	}
+
+	temp, err := os.CreateTemp(c.dir, "fill-*"+diskCacheTempExt)
+	if err != nil {
+		log.Printf("disk cache - failed to create temporary file for %s: %v", objectKey, err)
+		return body
+	}
+
+	return &diskCacheFiller{
+		ReadCloser: body,
+		cache:      c,
+		temp:       temp,
+		record: diskCacheRecord{
+			Key:             objectKey,
+			ETag:            etag,
+			ContentEncoding: info.ContentEncoding,
+			Size:            info.Size,
+		},
+	}
+}
+
+// commit moves a completely written body and its record into place.
+func (c *diskCache) commit(temp *os.File, record diskCacheRecord) error {
+	if err := temp.Sync(); err != nil {
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	unlock := c.files.Lock(record.Key)
+	err = c.replaceFiles(temp.Name(), record, raw)
+	var evicted []string
+	if err == nil {
+		c.mu.Lock()
+		c.insert(record)
+		evicted = c.evict()
+		c.mu.Unlock()
+	}
+	unlock()
+
+	c.removeEvicted(evicted)
+	return err
+}
+
+// replaceFiles puts the body at tempPath and its record in place of the
+// files of record.Key. The caller holds the key's lock in files.
+func (c *diskCache) replaceFiles(tempPath string, record diskCacheRecord, raw []byte) error {
+	c.mu.Lock()
+	if element, ok := c.items[record.Key]; ok {
+		c.unlink(element)
+	}
+	c.mu.Unlock()
+
+	// Drop the old record before replacing its body so a crash in between
+	// cannot leave a record describing the wrong bytes.
+	id := cacheFileID(record.Key)
+	if err := os.Remove(filepath.Join(c.dir, id+diskCacheMetaExt)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(tempPath, filepath.Join(c.dir, id+diskCacheDataExt)); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(c.dir, id+diskCacheMetaExt), raw); err != nil {
+		os.Remove(filepath.Join(c.dir, id+diskCacheDataExt))
+		return err
+	}
+	return nil
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), "record-*"+diskCacheTempExt)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), path)
+}
+
+// remove drops objectKey from the cache.
+func (c *diskCache) remove(objectKey string) {
+	unlock := c.files.Lock(objectKey)
+	defer unlock()
+
+	c.mu.Lock()
+	if element, ok := c.items[objectKey]; ok {
+		c.unlink(element)
+	}
+	c.mu.Unlock()
+	c.removeFiles(cacheFileID(objectKey))
+}
+
+func (c *diskCache) insert(record diskCacheRecord) {
+	c.items[record.Key] = c.entries.PushFront(record)
+	c.bytes += record.Size
+}
+
+func (c *diskCache) unlink(element *list.Element) {
+	record := c.entries.Remove(element).(diskCacheRecord)
+	delete(c.items, record.Key)
+	c.bytes -= record.Size
+}
+
+// evict unlinks the least recently used entries until the cache fits and
+// returns their keys, whose files removeEvicted deletes once mu is released.
+func (c *diskCache) evict() []string {
+	var evicted []string
+	for c.bytes > c.maxBytes {
+		element := c.entries.Back()
+		evicted = append(evicted, element.Value.(diskCacheRecord).Key)
+		c.unlink(element)
+	}
+	return evicted
+}
+
+// removeEvicted deletes the files of evicted keys that were not cached again
+// in the meantime.
+func (c *diskCache) removeEvicted(keys []string) {
+	for _, key := range keys {
+		unlock := c.files.Lock(key)
+		c.mu.Lock()
+		_, cached := c.items[key]
+		c.mu.Unlock()
+		if !cached {
+			c.removeFiles(cacheFileID(key))
+		}
+		unlock()
+	}
+}
+
+func (c *diskCache) removeFiles(id string) {
+	os.Remove(filepath.Join(c.dir, id+diskCacheMetaExt))
+	os.Remove(filepath.Join(c.dir, id+diskCacheDataExt))
+}
+
+// diskCacheFiller copies a backend body into a temporary file as the client
+// reads it and commits the file once the whole body has arrived.
+type diskCacheFiller struct {
+	io.ReadCloser
+	cache   *diskCache
+	temp    *os.File
+	record  diskCacheRecord
+	written int64
+	failed  bool
+	done    bool
+}
+
+func (f *diskCacheFiller) Read(p []byte) (int, error) {
+	n, err := f.ReadCloser.Read(p)
+	if n > 0 && !f.failed {
+		if _, writeErr := f.temp.Write(p[:n]); writeErr != nil {
+			log.Printf("disk cache - failed to write %s: %v", f.record.Key, writeErr)
+			f.failed = true
+		}
+		f.written += int64(n)
+	}
+
+	if err == io.EOF && !f.failed && !f.done && f.written == f.record.Size {
+		f.done = true
+		if commitErr := f.cache.commit(f.temp, f.record); commitErr != nil {
+			log.Printf("disk cache - failed to store %s: %v", f.record.Key, commitErr)
+			f.temp.Close()
+			os.Remove(f.temp.Name())
+		}
+	} else if err != nil && err != io.EOF {
+		f.failed = true
+	}
+
+	return n, err
+}
+
+func (f *diskCacheFiller) Close() error {
+	if !f.done {
+		f.done = true
+		f.temp.Close()
+		os.Remove(f.temp.Name())
+	}
+	return f.ReadCloser.Close()
+}
@@ -0,0 +1,245 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDiskCache_FillAndOpen(t *testing.T) {
+	cache, err := openDiskCache(t.TempDir(), 100)
+	if err != nil {
+		t.Fatalf("failed to open cache: %v", err)
+	}
+	info := ObjectInfo{Size: 5}
+
+	fillDiskCache(t, cache, "a", "etag1", info, "hello")
+
+	assertDiskCacheBody(t, cache, "a", "etag1", info, "hello")
+	if _, ok := cache.open("a", "etag2", info); ok {
+		t.Fatal("expected changed ETag to miss")
+	}
+	if _, ok := cache.open("a", "etag1", ObjectInfo{Size: 5, ContentEncoding: CompressionGzip}); ok {
+		t.Fatal("expected different representation to miss")
+	}
+}
+
+func TestDiskCache_IgnoresIncompleteReads(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := openDiskCache(dir, 100)
+	if err != nil {
+		t.Fatalf("failed to open cache: %v", err)
+	}
+
+	body := cache.fill("a", "etag1", ObjectInfo{Size: 5}, io.NopCloser(strings.NewReader("hello")))
+	if _, err := body.Read(make([]byte, 2)); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	body.Close()
+
+	if _, ok := cache.open("a", "etag1", ObjectInfo{Size: 5}); ok {
+		t.Fatal("expected partially read body not to be cached")
+	}
+	assertDirEmpty(t, dir)
+}
+
+func TestDiskCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	cache, err := openDiskCache(t.TempDir(), 10)
+	if err != nil {
+		t.Fatalf("failed to open cache: %v", err)
+	}
+	info := ObjectInfo{Size: 4}
+
+	fillDiskCache(t, cache, "a", "etag", info, "aaaa")
+	fillDiskCache(t, cache, "b", "etag", info, "bbbb")
+	assertDiskCacheBody(t, cache, "a", "etag", info, "aaaa")
+	fillDiskCache(t, cache, "c", "etag", info, "cccc")
+
+	if _, ok := cache.open("b", "etag", info); ok {
+		t.Fatal("expected least recently used entry b to be evicted")
+	}
+	assertDiskCacheBody(t, cache, "a", "etag", info, "aaaa")
+	assertDiskCacheBody(t, cache, "c", "etag", info, "cccc")
+}
+
+func TestDiskCache_RecoversIndex(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := openDiskCache(dir, 100)
+	if err != nil {
+		t.Fatalf("failed to open cache: %v", err)
+	}
+	fillDiskCache(t, cache, "a", "etag1", ObjectInfo{Size: 5}, "hello")
+	fillDiskCache(t, cache, "b", "etag2", ObjectInfo{Size: 5}, "world")
+
+	// Leftovers of a crash: a partial write and a body without a record.
+	if err := os.WriteFile(filepath.Join(dir, "fill-1"+diskCacheTempExt), []byte("par"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, cacheFileID("b")+diskCacheMetaExt)); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := openDiskCache(dir, 100)
+	if err != nil {
+		t.Fatalf("failed to reopen cache: %v", err)
+	}
+
+	assertDiskCacheBody(t, reopened, "a", "etag1", ObjectInfo{Size: 5}, "hello")
+	if _, ok := reopened.open("b", "etag2", ObjectInfo{Size: 5}); ok {
+		t.Fatal("expected entry without record to be dropped")
+	}
+
+	files, _ := os.ReadDir(dir)
+	if len(files) != 2 {
+		t.Fatalf("expected only entry a to remain on disk, found %d files", len(files))
+	}
+}
+
+func TestDiskCache_RecoveryKeepsRecentlyUsed(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := openDiskCache(dir, 100)
+	if err != nil {
+		t.Fatalf("failed to open cache: %v", err)
+	}
+	info := ObjectInfo{Size: 4}
+	fillDiskCache(t, cache, "a", "etag", info, "aaaa")
+	fillDiskCache(t, cache, "b", "etag", info, "bbbb")
+
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, cacheFileID("b")+diskCacheDataExt), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// A smaller budget after the restart keeps only the most recent entry.
+	reopened, err := openDiskCache(dir, 4)
+	if err != nil {
+		t.Fatalf("failed to reopen cache: %v", err)
+	}
+	assertDiskCacheBody(t, reopened, "a", "etag", info, "aaaa")
+	if _, ok := reopened.open("b", "etag", info); ok {
+		t.Fatal("expected older entry b to be evicted on recovery")
+	}
+}
+
+func TestGatewayDiskCache(t *testing.T) {
+	gateway, store := newTestGateway(t, WithDiskCache(t.TempDir(), 1<<20))
+	ctx := context.Background()
+
+	if _, err := gateway.PutObject(ctx, "", "object1", strings.NewReader("artifact"), 8, PutOptions{}); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	assertCachedBody(t, gateway, "object1", GetOptions{}, "artifact")
+
+	// Same ETag: the cached body is served even though the backend changed.
+	attrs := store.object("object1").attrs
+	store.setObject("object1", fakeObject{data: []byte("backend!"), attrs: attrs})
+	assertCachedBody(t, gateway, "object1", GetOptions{}, "artifact")
+
+	// A new upload changes the ETag and the cached copy is refreshed.
+	if _, err := gateway.PutObject(ctx, "", "object1", strings.NewReader("updated!"), 8, PutOptions{}); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	assertCachedBody(t, gateway, "object1", GetOptions{}, "updated!")
+	assertCachedBody(t, gateway, "object1", GetOptions{}, "updated!")
+
+	if err := gateway.DeleteObject(ctx, "", "object1"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if _, ok := gateway.disk.open(objectPath(defaultBucketName, "object1"), attrs.ETag, ObjectInfo{Size: 8}); ok {
+		t.Fatal("expected deleted object to leave the disk cache")
+	}
+}
+
+func TestDiskCache_ConcurrentFillAndOpen(t *testing.T) {
+	cache, err := openDiskCache(t.TempDir(), 100)
+	if err != nil {
+		t.Fatalf("failed to open cache: %v", err)
+	}
+	info := ObjectInfo{Size: 5}
+	bodies := map[string]string{"etag1": "11111", "etag2": "22222"}
+
+	var wg sync.WaitGroup
+	for etag, data := range bodies {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				fillDiskCache(t, cache, "a", etag, info, data)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				body, ok := cache.open("a", etag, info)
+				if !ok {
+					continue
+				}
+				got, err := io.ReadAll(body)
+				body.Close()
+				if err != nil || string(got) != data {
+					t.Errorf("open(%s) = %q, %v, want %q", etag, got, err, data)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The index and the files agree once the writers are done.
+	for etag, data := range bodies {
+		if body, ok := cache.open("a", etag, info); ok {
+			got, _ := io.ReadAll(body)
+			body.Close()
+			if string(got) != data {
+				t.Fatalf("open(%s) = %q, want %q", etag, got, data)
+			}
+			return
+		}
+	}
+	t.Fatal("expected one of the bodies to stay cached")
+}
+
+func fillDiskCache(t *testing.T, cache *diskCache, objectKey, etag string, info ObjectInfo, data string) {
+	t.Helper()
+
+	body := cache.fill(objectKey, etag, info, io.NopCloser(strings.NewReader(data)))
+	if _, err := io.ReadAll(body); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	body.Close()
+}
+
+func assertDiskCacheBody(t *testing.T, cache *diskCache, objectKey, etag string, info ObjectInfo, want string) {
+	t.Helper()
+
+	body, ok := cache.open(objectKey, etag, info)
+	if !ok {
+		t.Fatalf("expected %s to be cached", objectKey)
+	}
+	defer body.Close()
+
+	got, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if string(got) != want {
+		t.Fatalf("body = %q, want %q", got, want)
+	}
+}
+
+func assertDirEmpty(t *testing.T, dir string) {
+	t.Helper()
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("expected %s to be empty, found %d files", dir, len(files))
+	}
+}
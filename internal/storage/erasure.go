@@ -0,0 +1,772 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/klauspost/reedsolomon"
+)
+
+// Erasure coded objects keep a JSON manifest under the object ID on the
+// parity+1 highest ranked instances, so it survives as many failures as the
+// shards do. Shard i lives on the i-th ranked instance under a
+// generation-specific key, so an overwrite never mixes shards of two versions.
+const (
+	erasurePrefix           = ".erasure/"
+	metaErasure             = "Gateway-Erasure"
+	erasureManifestMarker   = "manifest"
+	erasureShardMarker      = "shard"
+	defaultErasureBlockSize = 1 << 20
+	erasureRepairTimeout    = 5 * time.Minute
+)
+
+type erasureConfig struct {
+	dataShards   int
+	parityShards int
+	blockSize    int64
+}
+
+func (c erasureConfig) enabled() bool {
+	return c.dataShards != 0 || c.parityShards != 0
+}
+
+// validate checks the shard counts against the number of instances, since
+// every shard of an object must live on a different instance.
+func (c erasureConfig) validate(instances int) error {
+	if c.dataShards < 1 || c.parityShards < 1 {
+		return fmt.Errorf("erasure coding needs at least one data and one parity shard, got %d+%d", c.dataShards, c.parityShards)
+	}
+	if c.totalShards() > 256 {
+		return fmt.Errorf("erasure coding supports at most 256 shards, got %d", c.totalShards())
+	}
+	if c.totalShards() > instances {
+		return fmt.Errorf("erasure coding with %d+%d shards needs at least %d instances, got %d", c.dataShards, c.parityShards, c.totalShards(), instances)
+	}
+	if c.blockSize < 1 {
+		return fmt.Errorf("erasure block size must be positive")
+	}
+	return nil
+}
+
+func (c erasureConfig) totalShards() int {
+	return c.dataShards + c.parityShards
+}
+
+type erasureManifest struct {
+	DataShards   int    `json:"dataShards"`
+	ParityShards int    `json:"parityShards"`
+	BlockSize    int64  `json:"blockSize"`
+	Size         int64  `json:"size"`
+	SHA256       string `json:"sha256"`
+	ContentType  string `json:"contentType,omitempty"`
+	// Metadata holds the object attributes copied onto every manifest replica.
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	Generation string            `json:"generation"`
+	Replicas   []string          `json:"replicas"`
+	Shards     []erasureShard    `json:"shards"`
+}
+
+type erasureShard struct {
+	Instance string `json:"instance"`
+	SHA256   string `json:"sha256"`
+}
+
+func newErasureManifest(cfg erasureConfig, size int64, contentType string, placement []string) (erasureManifest, error) {
+	var generation [8]byte
+	if _, err := rand.Read(generation[:]); err != nil {
+		return erasureManifest{}, fmt.Errorf("failed to generate shard generation: %w", err)
+	}
+
+	// Small objects use one short stripe instead of padding every shard to
+	// a full block.
+	blockSize := cfg.blockSize
+	if perShard := ceilDiv(size, int64(cfg.dataShards)); perShard < blockSize {
+		blockSize = perShard
+	}
+
+	manifest := erasureManifest{
+		DataShards:   cfg.dataShards,
+		ParityShards: cfg.parityShards,
+		BlockSize:    blockSize,
+		Size:         size,
+		ContentType:  contentType,
+		Generation:   hex.EncodeToString(generation[:]),
+		Replicas:     append([]string(nil), placement[:cfg.parityShards+1]...),
+		Shards:       make([]erasureShard, len(placement)),
+	}
+	for i, instanceID := range placement {
+		manifest.Shards[i].Instance = instanceID
+	}
+
+	return manifest, nil
+}
+
+func (m erasureManifest) totalShards() int {
+	return m.DataShards + m.ParityShards
+}
+
+func (m erasureManifest) stripes() int64 {
+	if m.Size == 0 || m.BlockSize == 0 {
+		return 0
+	}
+	return ceilDiv(m.Size, int64(m.DataShards)*m.BlockSize)
+}
+
+func (m erasureManifest) shardSize() int64 {
+	return m.stripes() * m.BlockSize
+}
+
+func (m erasureManifest) shardKey(objectKey string, index int) string {
+	return erasurePrefix + objectKey + "/" + m.Generation + "/" + strconv.Itoa(index)
+}
+
+func ceilDiv(a, b int64) int64 {
+	return (a + b - 1) / b
+}
+
+func isErasureManifest(stat storeObject) bool {
+	return stat.Metadata[metaErasure] == erasureManifestMarker
+}
+
+// putErasureCoded splits the upload into data and parity shards, uploads them
+// to the top ranked instances and then publishes the manifest.
+func (g *Gateway) putErasureCoded(ctx context.Context, bucketName, objectKey string, verifier *verifyingReader, attrs storeObject) (ObjectInfo, error) {
+	total := g.erasure.totalShards()
+	placement, err := g.hasher.RankInstances(objectKey, total)
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("failed to rank instances: %w", err)
+	}
+	if len(placement) < total {
+		return ObjectInfo{}, fmt.Errorf("erasure coding needs %d instances, %d available", total, len(placement))
+	}
+
+	manifest, err := newErasureManifest(g.erasure, verifier.size, attrs.ContentType, placement)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	manifest.Metadata = attrs.Metadata
+
+	previous, err := g.findManifest(ctx, bucketName, objectKey)
+	if err != nil && !errors.Is(err, ErrObjectNotFound) {
+		return ObjectInfo{}, err
+	}
+
+	encoder, err := reedsolomon.New(manifest.DataShards, manifest.ParityShards)
+	if err != nil {
+		return ObjectInfo{}, fmt.Errorf("failed to create erasure encoder: %w", err)
+	}
+
+	remaining := verifier.size
+	hashes, err := g.uploadShards(ctx, bucketName, objectKey, manifest, allShards(total), func(shards [][]byte) error {
+		for i := 0; i < manifest.DataShards; i++ {
+			n := min(remaining, manifest.BlockSize)
+			if _, err := io.ReadFull(verifier, shards[i][:n]); err != nil {
+				return err
+			}
+			clear(shards[i][n:])
+			remaining -= n
+		}
+		return encoder.Encode(shards)
+	})
+	if err == nil && !verifier.checked {
+		err = fmt.Errorf("%w: upload ended before %d bytes were stored", ErrIncompleteUpload, verifier.size)
+	}
+	if err != nil {
+		g.removeShards(ctx, bucketName, objectKey, manifest, allShards(total))
+		if verifier.err != nil {
+			return ObjectInfo{}, verifier.err
+		}
+		return ObjectInfo{}, err
+	}
+
+	manifest.SHA256 = verifier.sha256Hex()
+	for index, sum := range hashes {
+		manifest.Shards[index].SHA256 = sum
+	}
+
+	if err := g.writeManifest(ctx, bucketName, objectKey, manifest); err != nil {
+		g.removeShards(ctx, bucketName, objectKey, manifest, allShards(total))
+		return ObjectInfo{}, err
+	}
+
+	if previous != nil && previous.Generation != manifest.Generation {
+		g.removeShards(ctx, bucketName, objectKey, *previous, allShards(previous.totalShards()))
+		for _, instanceID := range previous.Replicas {
+			if !slices.Contains(manifest.Replicas, instanceID) {
+				g.removeFrom(ctx, instanceID, bucketName, objectKey)
+			}
+		}
+	}
+
+	return ObjectInfo{
+		Key:            objectKey,
+		ContentType:    attrs.ContentType,
+		Size:           manifest.Size,
+		ChecksumSHA256: manifest.SHA256,
+	}, nil
+}
+
+func allShards(total int) []int {
+	indices := make([]int, total)
+	for i := range indices {
+		indices[i] = i
+	}
+	return indices
+}
+
+// uploadShards uploads the shards listed in indices concurrently, feeding
+// them the stripes produced by next, and returns the SHA-256 of each.
+func (g *Gateway) uploadShards(ctx context.Context, bucketName, objectKey string, manifest erasureManifest, indices []int, next func(shards [][]byte) error) (map[int]string, error) {
+	stores := make(map[int]objectStore, len(indices))
+	for _, index := range indices {
+		store, err := g.instanceStore(manifest.Shards[index].Instance)
+		if err != nil {
+			return nil, err
+		}
+		if err := g.ensureBucket(ctx, store, bucketName); err != nil {
+			return nil, err
+		}
+		stores[index] = store
+	}
+
+	uploadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	writers := make(map[int]*io.PipeWriter, len(indices))
+	hashes := make(map[int]hash.Hash, len(indices))
+	errCh := make(chan error, len(indices))
+	var wg sync.WaitGroup
+	for _, index := range indices {
+		pr, pw := io.Pipe()
+		writers[index] = pw
+		hashes[index] = sha256.New()
+
+		wg.Add(1)
+		go func(index int, store objectStore) {
+			defer wg.Done()
+			attrs := storeObject{Metadata: map[string]string{metaErasure: erasureShardMarker}}
+			err := store.PutObject(uploadCtx, bucketName, manifest.shardKey(objectKey, index), pr, manifest.shardSize(), attrs)
+			if err != nil {
+				err = fmt.Errorf("failed to upload shard %d to instance %s: %w", index, manifest.Shards[index].Instance, err)
+				errCh <- err
+				cancel()
+			}
+			pr.CloseWithError(err)
+		}(index, stores[index])
+	}
+
+	shards := make([][]byte, manifest.totalShards())
+	for i := range shards {
+		shards[i] = make([]byte, manifest.BlockSize)
+	}
+
+	var streamErr error
+	for stripe := int64(0); stripe < manifest.stripes() && streamErr == nil; stripe++ {
+		if streamErr = next(shards); streamErr != nil {
+			break
+		}
+		for _, index := range indices {
+			hashes[index].Write(shards[index])
+			if _, err := writers[index].Write(shards[index]); err != nil {
+				streamErr = err
+				break
+			}
+		}
+	}
+	for _, pw := range writers {
+		pw.CloseWithError(streamErr)
+	}
+	wg.Wait()
+	close(errCh)
+
+	if streamErr != nil {
+		return nil, streamErr
+	}
+	for err := range errCh {
+		return nil, err
+	}
+
+	sums := make(map[int]string, len(hashes))
+	for index, h := range hashes {
+		sums[index] = hex.EncodeToString(h.Sum(nil))
+	}
+	return sums, nil
+}
+
+// writeManifest stores a copy of the manifest under objectKey on every replica instance.
+func (g *Gateway) writeManifest(ctx context.Context, bucketName, objectKey string, manifest erasureManifest) error {
+	body, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to encode erasure manifest: %w", err)
+	}
+
+	attrs := storeObject{
+		ContentType: manifest.ContentType,
+		Metadata:    maps.Clone(manifest.Metadata),
+	}
+	if attrs.Metadata == nil {
+		attrs.Metadata = map[string]string{}
+	}
+	attrs.Metadata[metaErasure] = erasureManifestMarker
+	attrs.Metadata[metaOriginalSize] = strconv.FormatInt(manifest.Size, 10)
+	attrs.Metadata[metaSHA256] = manifest.SHA256
+
+	for _, instanceID := range manifest.Replicas {
+		store, err := g.instanceStore(instanceID)
+		if err != nil {
+			return err
+		}
+		if err := g.ensureBucket(ctx, store, bucketName); err != nil {
+			return err
+		}
+		if err := store.PutObject(ctx, bucketName, objectKey, bytes.NewReader(body), int64(len(body)), attrs); err != nil {
+			return fmt.Errorf("failed to store erasure manifest on instance %s: %w", instanceID, err)
+		}
+	}
+
+	return nil
+}
+
+// findManifest returns the manifest of an erasure coded object, consulting
+// replicas when the owner cannot answer. It returns nil for plain objects.
+func (g *Gateway) findManifest(ctx context.Context, bucketName, objectKey string) (*erasureManifest, error) {
+	store, _, stat, err := g.resolveObject(ctx, bucketName, objectKey)
+	if err != nil {
+		return nil, err
+	}
+	if !isErasureManifest(stat) {
+		return nil, nil
+	}
+
+	manifest, err := g.readManifest(ctx, store, bucketName, objectKey)
+	if err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+func (g *Gateway) readManifest(ctx context.Context, store objectStore, bucketName, objectKey string) (erasureManifest, error) {
+	body, err := store.GetObject(ctx, bucketName, objectKey)
+	if err != nil {
+		return erasureManifest{}, fmt.Errorf("failed to get erasure manifest: %w", err)
+	}
+	defer body.Close()
+
+	var manifest erasureManifest
+	if err := json.NewDecoder(body).Decode(&manifest); err != nil {
+		return erasureManifest{}, fmt.Errorf("failed to decode erasure manifest: %w", err)
+	}
+	if manifest.DataShards < 1 || manifest.ParityShards < 0 || len(manifest.Shards) != manifest.totalShards() {
+		return erasureManifest{}, fmt.Errorf("invalid erasure manifest for %s", objectKey)
+	}
+
+	return manifest, nil
+}
+
+// statManifestReplica looks for a manifest copy on the replicas behind the owner.
+func (g *Gateway) statManifestReplica(ctx context.Context, bucketName, objectKey string) (objectStore, storeObject, bool) {
+	replicas, err := g.hasher.RankInstances(objectKey, g.erasure.parityShards+1)
+	if err != nil {
+		return nil, storeObject{}, false
+	}
+
+	for _, instanceID := range replicas[1:] {
+		store, err := g.instanceStore(instanceID)
+		if err != nil {
+			continue
+		}
+		stat, err := store.StatObject(ctx, bucketName, objectKey)
+		if err == nil && isErasureManifest(stat) {
+			return store, stat, true
+		}
+	}
+
+	return nil, storeObject{}, false
+}
+
+// openErasureObject returns a reader rebuilding the object from the first
+// data shards that can be opened, falling back to parity shards.
+func (g *Gateway) openErasureObject(ctx context.Context, store objectStore, bucketName, objectKey string) (io.ReadCloser, error) {
+	manifest, err := g.readManifest(ctx, store, bucketName, objectKey)
+	if err != nil {
+		return nil, err
+	}
+
+	encoder, err := reedsolomon.New(manifest.DataShards, manifest.ParityShards)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create erasure decoder: %w", err)
+	}
+
+	readers := make([]io.ReadCloser, manifest.totalShards())
+	opened, degraded := 0, false
+	for index := range readers {
+		if opened == manifest.DataShards {
+			break
+		}
+		reader, err := g.openShard(ctx, bucketName, objectKey, manifest, index)
+		if err != nil {
+			log.Printf("GET /object/%s - shard %d unavailable: %v", objectKey, index, err)
+			degraded = true
+			continue
+		}
+		readers[index] = reader
+		opened++
+	}
+
+	if degraded {
+		g.scheduleRepair(bucketName, objectKey)
+	}
+	if opened < manifest.DataShards {
+		closeAll(readers)
+		return nil, fmt.Errorf("%w: %d of %d required shards for %s", ErrShardsUnavailable, opened, manifest.DataShards, objectKey)
+	}
+
+	return &erasureReader{
+		gateway:    g,
+		bucketName: bucketName,
+		objectKey:  objectKey,
+		encoder:    encoder,
+		manifest:   manifest,
+		readers:    readers,
+		shards:     make([][]byte, manifest.totalShards()),
+		blocks:     make([][]byte, manifest.totalShards()),
+		out:        make([]byte, 0, int64(manifest.DataShards)*manifest.BlockSize),
+		remaining:  manifest.Size,
+		hash:       sha256.New(),
+	}, nil
+}
+
+func (g *Gateway) openShard(ctx context.Context, bucketName, objectKey string, manifest erasureManifest, index int) (io.ReadCloser, error) {
+	store, err := g.instanceStore(manifest.Shards[index].Instance)
+	if err != nil {
+		return nil, err
+	}
+
+	shardKey := manifest.shardKey(objectKey, index)
+	stat, err := store.StatObject(ctx, bucketName, shardKey)
+	if err != nil {
+		return nil, err
+	}
+	if stat.Size != manifest.shardSize() {
+		return nil, fmt.Errorf("shard size %d, want %d", stat.Size, manifest.shardSize())
+	}
+
+	return store.GetObject(ctx, bucketName, shardKey)
+}
+
+// erasureReader decodes an erasure coded object stripe by stripe.
+type erasureReader struct {
+	gateway    *Gateway
+	bucketName string
+	objectKey  string
+	encoder    reedsolomon.Encoder
+	manifest   erasureManifest
+	readers    []io.ReadCloser
+	shards     [][]byte
+	blocks     [][]byte
+	out        []byte
+	pending    []byte
+	remaining  int64
+	hash       hash.Hash
+	err        error
+}
+
+func (r *erasureReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.remaining == 0 {
+			r.err = io.EOF
+			if got := hex.EncodeToString(r.hash.Sum(nil)); r.manifest.SHA256 != "" && got != r.manifest.SHA256 {
+				r.err = fmt.Errorf("%w: rebuilt object does not match its SHA-256", ErrChecksumMismatch)
+				r.gateway.scheduleRepair(r.bucketName, r.objectKey)
+			}
+			continue
+		}
+		r.err = r.nextStripe()
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *erasureReader) nextStripe() error {
+	available := 0
+	for index, reader := range r.readers {
+		if r.blocks[index] == nil {
+			r.blocks[index] = make([]byte, r.manifest.BlockSize)
+		}
+		r.shards[index] = r.blocks[index][:0]
+		if reader == nil {
+			continue
+		}
+
+		if _, err := io.ReadFull(reader, r.blocks[index]); err != nil {
+			log.Printf("GET /object/%s - shard %d failed mid-stream: %v", r.objectKey, index, err)
+			reader.Close()
+			r.readers[index] = nil
+			r.gateway.scheduleRepair(r.bucketName, r.objectKey)
+			continue
+		}
+		r.shards[index] = r.blocks[index]
+		available++
+	}
+
+	if available < r.manifest.DataShards {
+		return fmt.Errorf("%w: %d of %d required shards for %s", ErrShardsUnavailable, available, r.manifest.DataShards, r.objectKey)
+	}
+	if err := r.encoder.ReconstructData(r.shards); err != nil {
+		return fmt.Errorf("failed to reconstruct stripe: %w", err)
+	}
+
+	r.out = r.out[:0]
+	for index := 0; index < r.manifest.DataShards; index++ {
+		r.out = append(r.out, r.shards[index][:r.manifest.BlockSize]...)
+	}
+	if int64(len(r.out)) > r.remaining {
+		r.out = r.out[:r.remaining]
+	}
+
+	r.hash.Write(r.out)
+	r.remaining -= int64(len(r.out))
+	r.pending = r.out
+	return nil
+}
+
+func (r *erasureReader) Close() error {
+	closeAll(r.readers)
+	return nil
+}
+
+func closeAll(readers []io.ReadCloser) {
+	for _, reader := range readers {
+		if reader != nil {
+			reader.Close()
+		}
+	}
+}
+
+// RepairObject verifies every shard of an erasure coded object against its
+// recorded checksum and rebuilds missing or damaged shards from the healthy
+// ones. Shards whose instance has left the cluster move to the next ranked
+// instance not holding a shard yet. Plain objects need no repair. An empty
+// bucketName selects the default bucket. Writes and deletes of the object
+// wait for the repair to finish.
+func (g *Gateway) RepairObject(ctx context.Context, bucketName, objectKey string) error {
+	if err := g.keys.Validate(objectKey); err != nil {
+		return err
+	}
+
+	bucketName, err := g.resolveBucket(ctx, bucketName)
+	if err != nil {
+		return err
+	}
+	defer g.lockObject(objectPath(bucketName, objectKey))()
+
+	manifest, err := g.findManifest(ctx, bucketName, objectKey)
+	if err != nil || manifest == nil {
+		return err
+	}
+
+	healthy, damaged := g.checkShards(ctx, bucketName, objectKey, *manifest)
+	if len(damaged) == 0 {
+		return nil
+	}
+	if len(healthy) < manifest.DataShards {
+		return fmt.Errorf("%w: %d of %d required shards for %s", ErrShardsUnavailable, len(healthy), manifest.DataShards, objectKey)
+	}
+
+	updated := *manifest
+	updated.Shards = slices.Clone(manifest.Shards)
+	moved, err := g.relocateShards(objectKey, &updated, damaged)
+	if err != nil {
+		return err
+	}
+
+	encoder, err := reedsolomon.New(updated.DataShards, updated.ParityShards)
+	if err != nil {
+		return fmt.Errorf("failed to create erasure decoder: %w", err)
+	}
+
+	readers := make([]io.ReadCloser, updated.totalShards())
+	defer closeAll(readers)
+	for _, index := range healthy[:updated.DataShards] {
+		reader, err := g.openShard(ctx, bucketName, objectKey, updated, index)
+		if err != nil {
+			return fmt.Errorf("failed to reopen shard %d: %w", index, err)
+		}
+		readers[index] = reader
+	}
+
+	hashes, err := g.uploadShards(ctx, bucketName, objectKey, updated, damaged, func(shards [][]byte) error {
+		for index, reader := range readers {
+			shards[index] = shards[index][:0]
+			if reader == nil {
+				continue
+			}
+			shards[index] = shards[index][:updated.BlockSize]
+			if _, err := io.ReadFull(reader, shards[index]); err != nil {
+				return fmt.Errorf("failed to read shard %d: %w", index, err)
+			}
+		}
+		return encoder.Reconstruct(shards)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to rebuild shards: %w", err)
+	}
+
+	for index, sum := range hashes {
+		if sum != updated.Shards[index].SHA256 {
+			return fmt.Errorf("rebuilt shard %d of %s does not match its checksum", index, objectKey)
+		}
+	}
+
+	if moved {
+		// Another gateway may have replaced or deleted the object meanwhile;
+		// its manifest must not be overwritten with the repaired old one.
+		current, err := g.findManifest(ctx, bucketName, objectKey)
+		if err != nil {
+			return err
+		}
+		if current == nil || current.Generation != manifest.Generation {
+			return fmt.Errorf("%s changed during repair", objectKey)
+		}
+		if err := g.writeManifest(ctx, bucketName, objectKey, updated); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("REPAIR /object/%s - rebuilt shards %v", objectKey, damaged)
+	return nil
+}
+
+// checkShards reads every shard in full and sorts the indices by whether
+// their content still matches the manifest.
+func (g *Gateway) checkShards(ctx context.Context, bucketName, objectKey string, manifest erasureManifest) (healthy, damaged []int) {
+	for index := range manifest.Shards {
+		reader, err := g.openShard(ctx, bucketName, objectKey, manifest, index)
+		if err != nil {
+			damaged = append(damaged, index)
+			continue
+		}
+
+		h := sha256.New()
+		_, err = io.Copy(h, reader)
+		reader.Close()
+		if err != nil || hex.EncodeToString(h.Sum(nil)) != manifest.Shards[index].SHA256 {
+			damaged = append(damaged, index)
+			continue
+		}
+		healthy = append(healthy, index)
+	}
+
+	return healthy, damaged
+}
+
+// relocateShards moves damaged shards whose instance is gone to the next
+// ranked instance without a shard and reports whether anything moved.
+func (g *Gateway) relocateShards(objectKey string, manifest *erasureManifest, damaged []int) (bool, error) {
+	ranked, err := g.hasher.RankInstances(objectKey, len(g.hasher.Instances()))
+	if err != nil {
+		return false, fmt.Errorf("failed to rank instances: %w", err)
+	}
+
+	used := make(map[string]bool, len(manifest.Shards))
+	for _, shard := range manifest.Shards {
+		used[shard.Instance] = true
+	}
+
+	moved := false
+	for _, index := range damaged {
+		if slices.Contains(ranked, manifest.Shards[index].Instance) {
+			continue
+		}
+
+		replacement := ""
+		for _, instanceID := range ranked {
+			if !used[instanceID] {
+				replacement = instanceID
+				break
+			}
+		}
+		if replacement == "" {
+			return false, fmt.Errorf("no spare instance to hold shard %d of %s", index, objectKey)
+		}
+
+		used[replacement] = true
+		manifest.Shards[index].Instance = replacement
+		moved = true
+	}
+
+	if moved {
+		manifest.Replicas = append([]string(nil), ranked[:min(len(ranked), manifest.ParityShards+1)]...)
+	}
+	return moved, nil
+}
+
+// scheduleRepair repairs objectKey in the background unless a repair is already running.
+func (g *Gateway) scheduleRepair(bucketName, objectKey string) {
+	path := objectPath(bucketName, objectKey)
+	if _, running := g.repairs.LoadOrStore(path, struct{}{}); running {
+		return
+	}
+
+	go func() {
+		defer g.repairs.Delete(path)
+
+		ctx, cancel := context.WithTimeout(context.Background(), erasureRepairTimeout)
+		defer cancel()
+
+		if err := g.RepairObject(ctx, bucketName, objectKey); err != nil {
+			log.Printf("REPAIR /object/%s - failed: %v", objectKey, err)
+		}
+	}()
+}
+
+// deleteErasureObject removes every manifest copy and shard of an object.
+func (g *Gateway) deleteErasureObject(ctx context.Context, store objectStore, bucketName, objectKey string) error {
+	manifest, err := g.readManifest(ctx, store, bucketName, objectKey)
+	if err != nil {
+		return err
+	}
+
+	for _, instanceID := range manifest.Replicas {
+		g.removeFrom(ctx, instanceID, bucketName, objectKey)
+	}
+	g.removeShards(ctx, bucketName, objectKey, manifest, allShards(manifest.totalShards()))
+	return nil
+}
+
+// removeShards deletes the given shards, logging failures; orphaned shards
+// only cost space.
+func (g *Gateway) removeShards(ctx context.Context, bucketName, objectKey string, manifest erasureManifest, indices []int) {
+	for _, index := range indices {
+		g.removeFrom(ctx, manifest.Shards[index].Instance, bucketName, manifest.shardKey(objectKey, index))
+	}
+}
+
+func (g *Gateway) removeFrom(ctx context.Context, instanceID, bucketName, storageKey string) {
+	store, err := g.instanceStore(instanceID)
+	if err == nil {
+		err = store.RemoveObject(ctx, bucketName, storageKey)
+	}
+	if err != nil && !errors.Is(err, ErrObjectNotFound) {
+		log.Printf("failed to remove %s from instance %s: %v", storageKey, instanceID, err)
+	}
+}
@@ -0,0 +1,411 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/irensaltali/object-storage-gateway/internal/discovery"
+)
+
+func TestNewGatewayErasureCodingValidation(t *testing.T) {
+	instances := testInstances(3)
+
+	tests := []struct {
+		name string
+		opts []GatewayOption
+	}{
+		{name: "no parity", opts: []GatewayOption{WithErasureCoding(2, 0)}},
+		{name: "no data", opts: []GatewayOption{WithErasureCoding(0, 1)}},
+		{name: "more shards than instances", opts: []GatewayOption{WithErasureCoding(3, 1)}},
+		{name: "with deduplication", opts: []GatewayOption{WithErasureCoding(2, 1), WithDeduplication()}},
+		{name: "with compression", opts: []GatewayOption{WithErasureCoding(2, 1), WithCompression(CompressionZstd)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewGateway(instances, tt.opts...); err == nil {
+				t.Fatal("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestGatewayErasureCodingRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+	}{
+		{name: "empty", size: 0},
+		{name: "smaller than data shards", size: 2},
+		{name: "single stripe", size: 1000},
+		{name: "several stripes with partial tail", size: 5*64 + 17},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gateway, stores, _ := newErasureTestGateway(t, 5, 3, 2)
+			payload := testPayload(tt.size)
+
+			info, err := gateway.PutObject(context.Background(), "", "object1", bytes.NewReader(payload), int64(len(payload)), PutOptions{ContentType: "text/plain"})
+			if err != nil {
+				t.Fatalf("put failed: %v", err)
+			}
+			if info.Size != int64(tt.size) {
+				t.Fatalf("expected size %d, got %d", tt.size, info.Size)
+			}
+
+			shards := 0
+			for _, store := range stores {
+				shards += len(store.keysWithPrefix(erasurePrefix + "object1/"))
+			}
+			if shards != 5 {
+				t.Fatalf("expected 5 shards, got %d", shards)
+			}
+
+			stat, err := gateway.StatObject(context.Background(), "", "object1", GetOptions{})
+			if err != nil {
+				t.Fatalf("stat failed: %v", err)
+			}
+			if stat.Size != int64(tt.size) || stat.ContentType != "text/plain" || stat.ChecksumSHA256 != info.ChecksumSHA256 {
+				t.Fatalf("unexpected stat %+v", stat)
+			}
+
+			assertObjectBody(t, gateway, "object1", payload)
+		})
+	}
+}
+
+func TestGatewayErasureCodingToleratesLostInstances(t *testing.T) {
+	gateway, _, down := newErasureTestGateway(t, 5, 3, 2)
+	payload := testPayload(700)
+
+	if _, err := gateway.PutObject(context.Background(), "", "object1", bytes.NewReader(payload), int64(len(payload)), PutOptions{}); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+
+	placement, err := gateway.hasher.RankInstances("object1", 5)
+	if err != nil {
+		t.Fatalf("rank failed: %v", err)
+	}
+
+	// Losing the owner and a data shard holder forces a manifest lookup on a
+	// replica and reconstruction from parity.
+	down.set(placement[0], placement[1])
+	assertObjectBody(t, gateway, "object1", payload)
+
+	down.set(placement[1], placement[2], placement[3])
+	if _, err := gateway.GetObject(context.Background(), "", "object1", GetOptions{}); !errors.Is(err, ErrShardsUnavailable) {
+		t.Fatalf("expected ErrShardsUnavailable with three instances down, got %v", err)
+	}
+	waitForRepairs(t, gateway)
+}
+
+func TestGatewayErasureCodingRepairObject(t *testing.T) {
+	gateway, stores, _ := newErasureTestGateway(t, 4, 2, 2)
+	payload := testPayload(900)
+
+	if _, err := gateway.PutObject(context.Background(), "", "object1", bytes.NewReader(payload), int64(len(payload)), PutOptions{}); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+
+	manifest, err := gateway.findManifest(context.Background(), defaultBucketName, "object1")
+	if err != nil || manifest == nil {
+		t.Fatalf("failed to read manifest: %v", err)
+	}
+
+	corrupted := stores[manifest.Shards[0].Instance]
+	corruptedKey := manifest.shardKey("object1", 0)
+	original := corrupted.object(corruptedKey)
+	damaged := bytes.Clone(original.data)
+	damaged[0] ^= 0xff
+	corrupted.setObject(corruptedKey, fakeObject{data: damaged, attrs: original.attrs})
+
+	missing := stores[manifest.Shards[3].Instance]
+	missingKey := manifest.shardKey("object1", 3)
+	want := missing.object(missingKey).data
+	if err := missing.RemoveObject(context.Background(), "", missingKey); err != nil {
+		t.Fatalf("failed to remove shard: %v", err)
+	}
+
+	if err := gateway.RepairObject(context.Background(), "", "object1"); err != nil {
+		t.Fatalf("repair failed: %v", err)
+	}
+
+	if got := corrupted.object(corruptedKey).data; !bytes.Equal(got, original.data) {
+		t.Fatal("corrupted shard was not rebuilt")
+	}
+	if got := missing.object(missingKey).data; !bytes.Equal(got, want) {
+		t.Fatal("missing shard was not rebuilt")
+	}
+	assertObjectBody(t, gateway, "object1", payload)
+}
+
+func TestGatewayErasureCodingRepairRelocatesShards(t *testing.T) {
+	gateway, stores, down := newErasureTestGateway(t, 4, 2, 1)
+	payload := testPayload(300)
+
+	if _, err := gateway.PutObject(context.Background(), "", "object1", bytes.NewReader(payload), int64(len(payload)), PutOptions{}); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+
+	manifest, err := gateway.findManifest(context.Background(), defaultBucketName, "object1")
+	if err != nil || manifest == nil {
+		t.Fatalf("failed to read manifest: %v", err)
+	}
+
+	// The holder of the last shard leaves the cluster for good.
+	gone := manifest.Shards[2].Instance
+	down.set(gone)
+	remaining := make([]string, 0, 3)
+	for _, instanceID := range gateway.hasher.instances {
+		if instanceID != gone {
+			remaining = append(remaining, instanceID)
+		}
+	}
+	gateway.hasher, err = NewConsistentHasher(remaining)
+	if err != nil {
+		t.Fatalf("failed to create hasher: %v", err)
+	}
+
+	if err := gateway.RepairObject(context.Background(), "", "object1"); err != nil {
+		t.Fatalf("repair failed: %v", err)
+	}
+
+	repaired, err := gateway.findManifest(context.Background(), defaultBucketName, "object1")
+	if err != nil || repaired == nil {
+		t.Fatalf("failed to read manifest: %v", err)
+	}
+	moved := repaired.Shards[2].Instance
+	if moved == gone {
+		t.Fatal("expected shard to move off the departed instance")
+	}
+	if len(stores[moved].keysWithPrefix(repaired.shardKey("object1", 2))) != 1 {
+		t.Fatalf("expected shard on instance %s", moved)
+	}
+	assertObjectBody(t, gateway, "object1", payload)
+}
+
+func TestGatewayErasureCodingOverwriteDuringRepair(t *testing.T) {
+	gateway, stores, down := newErasureTestGateway(t, 4, 2, 1)
+	payload := testPayload(300)
+
+	if _, err := gateway.PutObject(context.Background(), "", "object1", bytes.NewReader(payload), int64(len(payload)), PutOptions{}); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	manifest, err := gateway.findManifest(context.Background(), defaultBucketName, "object1")
+	if err != nil || manifest == nil {
+		t.Fatalf("failed to read manifest: %v", err)
+	}
+
+	// A shard holder leaves, so the repair rewrites the manifest, and every
+	// shard read is slowed down to keep the repair running while the
+	// object is overwritten.
+	gone := manifest.Shards[2].Instance
+	down.set(gone)
+	var remaining []string
+	for _, instanceID := range gateway.hasher.instances {
+		if instanceID != gone {
+			remaining = append(remaining, instanceID)
+		}
+	}
+	if err := gateway.hasher.UpdateInstances(remaining); err != nil {
+		t.Fatalf("failed to update hasher: %v", err)
+	}
+	for _, store := range stores {
+		store.mu.Lock()
+		store.statDelay = 5 * time.Millisecond
+		store.mu.Unlock()
+	}
+
+	repaired := make(chan error, 1)
+	go func() { repaired <- gateway.RepairObject(context.Background(), "", "object1") }()
+	time.Sleep(2 * time.Millisecond)
+
+	overwrite := testPayload(120)
+	if _, err := gateway.PutObject(context.Background(), "", "object1", bytes.NewReader(overwrite), int64(len(overwrite)), PutOptions{}); err != nil {
+		t.Fatalf("overwrite failed: %v", err)
+	}
+	if err := <-repaired; err != nil {
+		t.Fatalf("repair failed: %v", err)
+	}
+
+	current, err := gateway.findManifest(context.Background(), defaultBucketName, "object1")
+	if err != nil || current == nil {
+		t.Fatalf("failed to read manifest: %v", err)
+	}
+	if current.Generation == manifest.Generation {
+		t.Fatal("the repair restored the manifest of the overwritten version")
+	}
+	assertObjectBody(t, gateway, "object1", overwrite)
+}
+
+func TestGatewayErasureCodingOverwriteAndDelete(t *testing.T) {
+	gateway, stores, _ := newErasureTestGateway(t, 3, 2, 1)
+
+	for _, payload := range [][]byte{testPayload(500), testPayload(50)} {
+		if _, err := gateway.PutObject(context.Background(), "", "object1", bytes.NewReader(payload), int64(len(payload)), PutOptions{}); err != nil {
+			t.Fatalf("put failed: %v", err)
+		}
+	}
+
+	shards := 0
+	for _, store := range stores {
+		shards += len(store.keysWithPrefix(erasurePrefix))
+	}
+	if shards != 3 {
+		t.Fatalf("expected the previous generation to be removed, found %d shards", shards)
+	}
+	assertObjectBody(t, gateway, "object1", testPayload(50))
+
+	if err := gateway.DeleteObject(context.Background(), "", "object1"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	for instanceID, store := range stores {
+		if keys := store.keysWithPrefix(""); len(keys) != 0 {
+			t.Fatalf("expected instance %s to be empty, found %v", instanceID, keys)
+		}
+	}
+	if _, err := gateway.GetObject(context.Background(), "", "object1", GetOptions{}); !errors.Is(err, ErrObjectNotFound) {
+		t.Fatalf("expected ErrObjectNotFound, got %v", err)
+	}
+}
+
+func TestGatewayErasureCodingIncompleteUpload(t *testing.T) {
+	gateway, stores, _ := newErasureTestGateway(t, 3, 2, 1)
+
+	_, err := gateway.PutObject(context.Background(), "", "object1", strings.NewReader("short"), 100, PutOptions{})
+	if !errors.Is(err, ErrIncompleteUpload) {
+		t.Fatalf("expected ErrIncompleteUpload, got %v", err)
+	}
+	for instanceID, store := range stores {
+		if keys := store.keysWithPrefix(""); len(keys) != 0 {
+			t.Fatalf("expected instance %s to be empty, found %v", instanceID, keys)
+		}
+	}
+}
+
+func TestGatewayErasureCodingRejectsCompression(t *testing.T) {
+	gateway, _, _ := newErasureTestGateway(t, 3, 2, 1)
+
+	_, err := gateway.PutObject(context.Background(), "", "object1", strings.NewReader("data"), 4, PutOptions{Compression: CompressionGzip})
+	if !errors.Is(err, ErrUnsupportedCompression) {
+		t.Fatalf("expected ErrUnsupportedCompression, got %v", err)
+	}
+}
+
+// downInstances marks instances whose store cannot be reached.
+type downInstances struct {
+	mu  sync.Mutex
+	ids map[string]bool
+}
+
+func (d *downInstances) set(instanceIDs ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.ids = make(map[string]bool, len(instanceIDs))
+	for _, instanceID := range instanceIDs {
+		d.ids[instanceID] = true
+	}
+}
+
+func (d *downInstances) has(instanceID string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.ids[instanceID]
+}
+
+// newErasureTestGateway returns a gateway with a separate fake store per
+// instance and a small block size so tests span several stripes.
+func newErasureTestGateway(t *testing.T, instances, dataShards, parityShards int) (*Gateway, map[string]*fakeStore, *downInstances) {
+	t.Helper()
+
+	gateway, err := NewGateway(testInstances(instances), WithErasureCoding(dataShards, parityShards))
+	if err != nil {
+		t.Fatalf("failed to create gateway: %v", err)
+	}
+	t.Cleanup(func() { _ = gateway.Close() })
+	gateway.erasure.blockSize = 64
+
+	stores := make(map[string]*fakeStore, instances)
+	for _, instanceID := range gateway.hasher.instances {
+		stores[instanceID] = newFakeStore()
+	}
+	down := &downInstances{}
+	gateway.storeFor = func(instanceID string) (objectStore, error) {
+		if down.has(instanceID) {
+			return nil, fmt.Errorf("instance %s is down", instanceID)
+		}
+		return stores[instanceID], nil
+	}
+
+	return gateway, stores, down
+}
+
+func testInstances(n int) []discovery.MinioInstance {
+	instances := make([]discovery.MinioInstance, n)
+	for i := range instances {
+		instances[i] = discovery.MinioInstance{
+			ID:        fmt.Sprintf("instance-%d", i+1),
+			Host:      "localhost",
+			Port:      fmt.Sprintf("%d", 9000+i),
+			AccessKey: "minioadmin",
+			SecretKey: "minioadmin",
+		}
+	}
+	return instances
+}
+
+func testPayload(size int) []byte {
+	payload := make([]byte, size)
+	for i := range payload {
+		payload[i] = byte(i*7 + i/13)
+	}
+	return payload
+}
+
+func assertObjectBody(t *testing.T, gateway *Gateway, objectKey string, want []byte) {
+	t.Helper()
+
+	object, err := gateway.GetObject(context.Background(), "", objectKey, GetOptions{})
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	defer object.Close()
+
+	got, err := io.ReadAll(object)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("body mismatch: got %d bytes, want %d", len(got), len(want))
+	}
+	if object.Info.Size != int64(len(want)) {
+		t.Fatalf("expected size %d, got %d", len(want), object.Info.Size)
+	}
+}
+
+// waitForRepairs blocks until background repairs scheduled by reads finish.
+func waitForRepairs(t *testing.T, gateway *Gateway) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		pending := false
+		gateway.repairs.Range(func(key, value any) bool {
+			pending = true
+			return false
+		})
+		if !pending {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("background repairs did not finish")
+}
@@ -3,7 +3,9 @@ package storage
 import (
 	"errors"
 	"fmt"
+	"net"
 	"regexp"
+	"strings"
 )
 
 var (
@@ -11,14 +13,46 @@ var (
 	ErrInvalidObjectID = errors.New("invalid object id")
 	// ErrObjectNotFound is returned when the object does not exist in storage.
 	ErrObjectNotFound = errors.New("object not found")
+	// ErrUnsupportedCompression is returned when a compression codec is not supported.
+	ErrUnsupportedCompression = errors.New("unsupported compression")
+	// ErrInvalidChecksum is returned when a client supplied digest is malformed.
+	ErrInvalidChecksum = errors.New("invalid checksum")
+	// ErrChecksumMismatch is returned when uploaded data does not match the client supplied digest.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrIncompleteUpload is returned when an upload does not deliver its declared size.
+	ErrIncompleteUpload = errors.New("incomplete upload")
+	// ErrShardsUnavailable is returned when too few erasure shards remain to rebuild an object.
+	ErrShardsUnavailable = errors.New("not enough erasure shards available")
+	// ErrQuotaExceeded is returned when an upload would take a tenant or instance over its quota.
+	ErrQuotaExceeded = errors.New("storage quota exceeded")
+	// ErrInvalidBucketName is returned when a bucket name does not match naming rules.
+	ErrInvalidBucketName = errors.New("invalid bucket name")
+	// ErrBucketNotFound is returned when a bucket has not been created.
+	ErrBucketNotFound = errors.New("bucket not found")
+	// ErrBucketExists is returned when creating a bucket that already exists.
+	ErrBucketExists = errors.New("bucket already exists")
+	// ErrBucketNotEmpty is returned when deleting a bucket that still holds objects.
+	ErrBucketNotEmpty = errors.New("bucket not empty")
 )
 
-var objectIDPattern = regexp.MustCompile(`^[a-zA-Z0-9]{1,32}$`)
+var bucketNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
 
-// ValidateObjectID validates the object identifier against API requirements.
+// ValidateObjectID validates the object identifier against the default key policy.
 func ValidateObjectID(objectID string) error {
-	if !objectIDPattern.MatchString(objectID) {
-		return fmt.Errorf("%w: expected 1-32 alphanumeric characters", ErrInvalidObjectID)
+	return DefaultKeyPolicy().Validate(objectID)
+}
+
+// ValidateBucketName validates a bucket name against the S3 naming rules the
+// backends enforce.
+func ValidateBucketName(bucketName string) error {
+	if !bucketNamePattern.MatchString(bucketName) {
+		return fmt.Errorf("%w: expected 3-63 lowercase letters, digits, dots or dashes, starting and ending with a letter or digit", ErrInvalidBucketName)
+	}
+	if strings.Contains(bucketName, "..") || strings.Contains(bucketName, ".-") || strings.Contains(bucketName, "-.") {
+		return fmt.Errorf("%w: dots cannot be adjacent to dots or dashes", ErrInvalidBucketName)
+	}
+	if net.ParseIP(bucketName) != nil {
+		return fmt.Errorf("%w: cannot be formatted as an IP address", ErrInvalidBucketName)
 	}
 
 	return nil
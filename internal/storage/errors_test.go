@@ -2,6 +2,7 @@ package storage
 
 import (
 	"errors"
+	"strings"
 	"testing"
 )
 
@@ -35,3 +36,37 @@ func TestValidateObjectID(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateBucketName(t *testing.T) {
+	tests := []struct {
+		bucketName string
+		wantErr    bool
+	}{
+		{bucketName: "objects", wantErr: false},
+		{bucketName: "team-a.logs", wantErr: false},
+		{bucketName: "abc", wantErr: false},
+		{bucketName: "ab", wantErr: true},
+		{bucketName: "UpperCase", wantErr: true},
+		{bucketName: "with_underscore", wantErr: true},
+		{bucketName: "-leading", wantErr: true},
+		{bucketName: "trailing.", wantErr: true},
+		{bucketName: "double..dot", wantErr: true},
+		{bucketName: "dot.-dash", wantErr: true},
+		{bucketName: "192.168.1.1", wantErr: true},
+		{bucketName: strings.Repeat("a", 64), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		err := ValidateBucketName(tt.bucketName)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidBucketName) {
+				t.Fatalf("ValidateBucketName(%q) expected ErrInvalidBucketName, got %v", tt.bucketName, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("ValidateBucketName(%q) unexpected error: %v", tt.bucketName, err)
+		}
+	}
+}
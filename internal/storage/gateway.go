@@ -1,39 +1,206 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"maps"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/irensaltali/object-storage-gateway/internal/discovery"
-	"github.com/minio/minio-go/v7"
 )
 
 const defaultBucketName = "objects"
 
 // Gateway provides the main object storage gateway functionality.
 type Gateway struct {
-	hasher     *ConsistentHasher
-	clients    *MinioClientManager
-	bucketName string
+	hasher        *ConsistentHasher
+	clients       *MinioClientManager
+	topologyMu    sync.Mutex
+	defaultBucket string
+	knownBuckets  sync.Map
+	// absentBuckets maps bucket names found on no instance to when that
+	// answer expires.
+	absentBuckets sync.Map
+	bucketLocks   keyedMutex
+	keys          KeyPolicy
+	compression   compressionPolicy
+	dedup         bool
+	blobLocks     keyedMutex
+	objectLocks   keyedMutex
+	erasure       erasureConfig
+	repairs       sync.Map
+	cache         *objectCache
+	disk          *diskCache
+	coalescer     *coalescer
+	usage         *usageTracker
+	authErrors    *authErrorReporter
+	storeFor      func(instanceID string) (objectStore, error)
+}
+
+// PutOptions holds per-request settings for PutObject.
+type PutOptions struct {
+	// ContentType is the media type of the object as sent by the client.
+	ContentType string
+	// Compression forces a codec for this object; empty selects one from ContentType.
+	Compression string
+	// ContentMD5 is the base64 Content-MD5 header value the upload must match.
+	ContentMD5 string
+	// ChecksumSHA256 is a hex SHA-256 digest the upload must match.
+	ChecksumSHA256 string
+	// Tenant is the authenticated identity the object is charged to.
+	Tenant string
+}
+
+// GetOptions holds per-request settings for GetObject.
+type GetOptions struct {
+	// AcceptEncoding is the client's Accept-Encoding header. When it admits the
+	// stored codec, the compressed bytes are returned as they are.
+	AcceptEncoding string
+	// BypassCache reads the object from its backend even when it is cached.
+	BypassCache bool
+}
+
+// ObjectInfo describes an object returned by the gateway.
+type ObjectInfo struct {
+	Key         string
+	ContentType string
+	// ContentEncoding is set when the body is returned still compressed.
+	ContentEncoding string
+	// Size is the length of the returned body, or -1 when unknown.
+	Size int64
+	// ChecksumSHA256 is the hex SHA-256 of the original object bytes, if recorded.
+	ChecksumSHA256 string
+}
+
+// Object is an object body together with its metadata.
+type Object struct {
+	io.ReadCloser
+	Info ObjectInfo
 }
 
 type gatewayConfig struct {
-	bucketName string
+	bucketName  string
+	keys        KeyPolicy
+	compression compressionPolicy
+	dedup       bool
+	erasure     erasureConfig
+	cache       cacheConfig
+	disk        diskCacheConfig
+	coalesce    bool
+	quotas      *QuotaConfig
+	onAuthError func(instanceID string)
+}
+
+type diskCacheConfig struct {
+	dir      string
+	maxBytes int64
+}
+
+type cacheConfig struct {
+	maxBytes      int64
+	maxObjectSize int64
 }
 
 // GatewayOption configures gateway construction.
 type GatewayOption func(*gatewayConfig)
 
-// WithBucketName configures the bucket used for object storage.
+// WithBucketName configures the default bucket, used by requests that do not
+// name a bucket.
 func WithBucketName(bucketName string) GatewayOption {
 	return func(cfg *gatewayConfig) {
 		cfg.bucketName = bucketName
 	}
 }
 
+// WithKeyPolicy replaces the strict default rules object keys must follow.
+func WithKeyPolicy(policy KeyPolicy) GatewayOption {
+	return func(cfg *gatewayConfig) {
+		cfg.keys = policy
+	}
+}
+
+// WithCompression compresses objects whose content type starts with one of
+// contentTypes using codec. Without content types a default set of text
+// formats is used.
+func WithCompression(codec string, contentTypes ...string) GatewayOption {
+	return func(cfg *gatewayConfig) {
+		cfg.compression.codec = strings.ToLower(strings.TrimSpace(codec))
+		cfg.compression.contentTypes = contentTypes
+	}
+}
+
+// WithDeduplication stores each distinct payload once as a content-addressed
+// blob and keeps only a pointer under the object ID.
+func WithDeduplication() GatewayOption {
+	return func(cfg *gatewayConfig) {
+		cfg.dedup = true
+	}
+}
+
+// WithErasureCoding splits every object into dataShards data shards and
+// parityShards parity shards stored on distinct instances, so any
+// parityShards of them may be lost without losing the object.
+func WithErasureCoding(dataShards, parityShards int) GatewayOption {
+	return func(cfg *gatewayConfig) {
+		cfg.erasure = erasureConfig{
+			dataShards:   dataShards,
+			parityShards: parityShards,
+			blockSize:    defaultErasureBlockSize,
+		}
+	}
+}
+
+// WithObjectCache keeps objects of up to maxObjectSize bytes in an in-memory
+// LRU cache holding at most maxBytes. Writes and deletes through the gateway
+// invalidate cached entries.
+func WithObjectCache(maxBytes, maxObjectSize int64) GatewayOption {
+	return func(cfg *gatewayConfig) {
+		cfg.cache = cacheConfig{maxBytes: maxBytes, maxObjectSize: maxObjectSize}
+	}
+}
+
+// WithDiskCache keeps object bodies read through the gateway in dir, up to
+// maxBytes in total. Cached bodies are revalidated against the owner's ETag on
+// every read and the cache survives restarts.
+func WithDiskCache(dir string, maxBytes int64) GatewayOption {
+	return func(cfg *gatewayConfig) {
+		cfg.disk = diskCacheConfig{dir: dir, maxBytes: maxBytes}
+	}
+}
+
+// WithRequestCoalescing lets concurrent reads of the same object share a
+// single backend fetch.
+func WithRequestCoalescing() GatewayOption {
+	return func(cfg *gatewayConfig) {
+		cfg.coalesce = true
+	}
+}
+
+// WithQuotas tracks stored bytes and objects per tenant and per instance and
+// rejects uploads that would exceed the configured quotas.
+func WithQuotas(quotas QuotaConfig) GatewayOption {
+	return func(cfg *gatewayConfig) {
+		cfg.quotas = &quotas
+	}
+}
+
+// WithAuthErrorHandler calls fn when an instance rejects the gateway's
+// credentials, for example to rediscover rotated keys. Calls are spaced at
+// least authErrorReportInterval apart per instance.
+func WithAuthErrorHandler(fn func(instanceID string)) GatewayOption {
+	return func(cfg *gatewayConfig) {
+		cfg.onAuthError = fn
+	}
+}
+
 // NewGateway creates a new object storage gateway.
 func NewGateway(instances []discovery.MinioInstance, opts ...GatewayOption) (*Gateway, error) {
 	if len(instances) == 0 {
@@ -42,6 +209,7 @@ func NewGateway(instances []discovery.MinioInstance, opts ...GatewayOption) (*Ga
 
 	cfg := gatewayConfig{
 		bucketName: defaultBucketName,
+		keys:       DefaultKeyPolicy(),
 	}
 	for _, opt := range opts {
 		opt(&cfg)
@@ -50,6 +218,39 @@ func NewGateway(instances []discovery.MinioInstance, opts ...GatewayOption) (*Ga
 	if strings.TrimSpace(cfg.bucketName) == "" {
 		return nil, fmt.Errorf("bucket name cannot be empty")
 	}
+	if err := ValidateBucketName(cfg.bucketName); err != nil {
+		return nil, err
+	}
+	if err := cfg.keys.validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.compression.codec != "" && !isKnownCodec(cfg.compression.codec) {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedCompression, cfg.compression.codec)
+	}
+	if len(cfg.compression.contentTypes) == 0 {
+		cfg.compression.contentTypes = defaultCompressibleTypes
+	}
+
+	if cfg.cache != (cacheConfig{}) && (cfg.cache.maxBytes <= 0 || cfg.cache.maxObjectSize <= 0) {
+		return nil, fmt.Errorf("object cache sizes must be positive")
+	}
+
+	if cfg.disk != (diskCacheConfig{}) && (strings.TrimSpace(cfg.disk.dir) == "" || cfg.disk.maxBytes <= 0) {
+		return nil, fmt.Errorf("disk cache needs a directory and a positive size")
+	}
+
+	if cfg.erasure.enabled() {
+		if err := cfg.erasure.validate(len(instances)); err != nil {
+			return nil, err
+		}
+		if cfg.dedup {
+			return nil, fmt.Errorf("erasure coding cannot be combined with deduplication")
+		}
+		if cfg.compression.codec != "" && cfg.compression.codec != CompressionNone {
+			return nil, fmt.Errorf("erasure coding cannot be combined with compression")
+		}
+	}
 
 	// Extract instance IDs for hashing
 	instanceIDs := make([]string, len(instances))
@@ -61,106 +262,645 @@ func NewGateway(instances []discovery.MinioInstance, opts ...GatewayOption) (*Ga
 	if err != nil {
 		return nil, fmt.Errorf("failed to create hasher: %w", err)
 	}
+	if err := hasher.UpdateWeightedInstances(instanceIDs, instanceWeights(instances)); err != nil {
+		return nil, fmt.Errorf("failed to create hasher: %w", err)
+	}
 
 	clients := NewMinioClientManager()
 	if err := clients.UpdateInstances(instances); err != nil {
 		return nil, fmt.Errorf("failed to initialize clients: %w", err)
 	}
 
-	return &Gateway{
-		hasher:     hasher,
-		clients:    clients,
-		bucketName: cfg.bucketName,
-	}, nil
+	gateway := &Gateway{
+		hasher:        hasher,
+		clients:       clients,
+		defaultBucket: cfg.bucketName,
+		keys:          cfg.keys,
+		compression:   cfg.compression,
+		dedup:         cfg.dedup,
+		erasure:       cfg.erasure,
+	}
+	if cfg.cache != (cacheConfig{}) {
+		gateway.cache = newObjectCache(cfg.cache.maxBytes, cfg.cache.maxObjectSize)
+	}
+	if cfg.coalesce {
+		gateway.coalescer = newCoalescer()
+	}
+	if cfg.quotas != nil {
+		gateway.usage = newUsageTracker(*cfg.quotas)
+	}
+	if cfg.onAuthError != nil {
+		gateway.authErrors = newAuthErrorReporter(cfg.onAuthError)
+	}
+	if cfg.disk != (diskCacheConfig{}) {
+		gateway.disk, err = openDiskCache(cfg.disk.dir, cfg.disk.maxBytes)
+		if err != nil {
+			clients.Close()
+			return nil, err
+		}
+	}
+	gateway.storeFor = gateway.minioStore
+
+	return gateway, nil
 }
 
-// PutObject stores an object in the gateway.
-func (g *Gateway) PutObject(ctx context.Context, objectKey string, data io.Reader, size int64) error {
-	if err := ValidateObjectID(objectKey); err != nil {
-		return err
+// UpdateInstances replaces the instances objects are placed on, for example
+// after discovery reports a change. Clients of added instances exist before
+// the hasher can select them, and clients of removed instances are dropped
+// only after it no longer does, so requests never see half an update.
+// Instances whose address or credentials changed get a new client.
+// Existing objects are not migrated, so objects whose owner changed are not
+// found until they are written again.
+func (g *Gateway) UpdateInstances(instances []discovery.MinioInstance) error {
+	if len(instances) == 0 {
+		return fmt.Errorf("at least one minio instance is required")
+	}
+	if g.erasure.enabled() {
+		if err := g.erasure.validate(len(instances)); err != nil {
+			return err
+		}
+	}
+
+	instanceIDs := make([]string, len(instances))
+	incoming := make(map[string]bool, len(instances))
+	for i, inst := range instances {
+		if incoming[inst.ID] {
+			return fmt.Errorf("duplicate minio instance %s", inst.ID)
+		}
+		instanceIDs[i] = inst.ID
+		incoming[inst.ID] = true
+	}
+
+	g.topologyMu.Lock()
+	defer g.topologyMu.Unlock()
+
+	current := g.hasher.Instances()
+	merged := append([]discovery.MinioInstance(nil), instances...)
+	var added, removed []string
+	for _, instanceID := range current {
+		if incoming[instanceID] {
+			continue
+		}
+		inst, err := g.clients.GetInstance(instanceID)
+		if err != nil {
+			return err
+		}
+		merged = append(merged, inst)
+		removed = append(removed, instanceID)
+	}
+	var changed []string
+	for _, inst := range instances {
+		if !slices.Contains(current, inst.ID) {
+			added = append(added, inst.ID)
+		} else if known, err := g.clients.GetInstance(inst.ID); err == nil && !sameConnection(known, inst) {
+			changed = append(changed, inst.ID)
+		}
+	}
+
+	if err := g.clients.UpdateInstances(merged); err != nil {
+		return fmt.Errorf("failed to update clients: %w", err)
+	}
+	if err := g.hasher.UpdateWeightedInstances(instanceIDs, instanceWeights(instances)); err != nil {
+		return fmt.Errorf("failed to update hasher: %w", err)
+	}
+	if err := g.clients.UpdateInstances(instances); err != nil {
+		return fmt.Errorf("failed to update clients: %w", err)
+	}
+
+	log.Printf("instances updated: %d active, added %v, removed %v, reconnected %v", len(instanceIDs), added, removed, changed)
+	return nil
+}
+
+// instanceWeights returns the placement weights of the instances.
+func instanceWeights(instances []discovery.MinioInstance) map[string]int {
+	weights := make(map[string]int, len(instances))
+	for _, inst := range instances {
+		weights[inst.ID] = inst.Weight
+	}
+	return weights
+}
+
+// PutObject stores an object in a bucket of the gateway; an empty bucketName
+// selects the default bucket. The upload is hashed while it streams and
+// rejected before it is committed if it does not match the digests in opts.
+func (g *Gateway) PutObject(ctx context.Context, bucketName, objectKey string, data io.Reader, size int64, opts PutOptions) (ObjectInfo, error) {
+	if err := g.keys.Validate(objectKey); err != nil {
+		return ObjectInfo{}, err
 	}
 
 	if data == nil {
-		return fmt.Errorf("data cannot be nil")
+		return ObjectInfo{}, fmt.Errorf("data cannot be nil")
 	}
 	if size < 0 {
-		return fmt.Errorf("size cannot be negative")
+		return ObjectInfo{}, fmt.Errorf("size cannot be negative")
 	}
 
-	// Select instance based on object ID
-	instanceID, err := g.hasher.SelectInstance(objectKey)
+	bucketName, err := g.resolveBucket(ctx, bucketName)
 	if err != nil {
-		return fmt.Errorf("failed to select instance: %w", err)
+		return ObjectInfo{}, err
+	}
+	path := objectPath(bucketName, objectKey)
+	defer g.lockObject(path)()
+	if g.usage != nil {
+		ctx = withEntryCache(ctx)
 	}
 
-	// Get the Minio client for the selected instance
-	client, err := g.clients.GetClient(instanceID)
+	if g.cache != nil {
+		// Invalidate on both sides of the write so neither an earlier read
+		// nor one racing the upload leaves the old body behind.
+		g.cache.invalidate(path)
+		defer g.cache.invalidate(path)
+	}
+	if g.coalescer != nil {
+		defer g.coalescer.forget(path)
+	}
+
+	codec, err := g.compression.selectCodec(opts.Compression, opts.ContentType)
 	if err != nil {
-		return fmt.Errorf("failed to get client: %w", err)
+		return ObjectInfo{}, err
 	}
 
-	exists, err := client.BucketExists(ctx, g.bucketName)
+	verifier, err := newVerifyingReader(data, size, opts.ContentMD5, opts.ChecksumSHA256)
 	if err != nil {
-		return fmt.Errorf("failed to check bucket %q existence: %w", g.bucketName, err)
+		return ObjectInfo{}, err
 	}
 
-	if !exists {
-		err = client.MakeBucket(ctx, g.bucketName, minio.MakeBucketOptions{})
+	attrs := storeObject{ContentType: opts.ContentType, Metadata: map[string]string{}}
+	if g.usage == nil {
+		return g.putObject(ctx, bucketName, objectKey, verifier, codec, attrs)
+	}
+
+	tenant, settle, err := g.chargeUpload(ctx, bucketName, objectKey, size, opts.Tenant)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	attrs.Metadata[metaTenant] = tenant
+
+	info, err := g.putObject(ctx, bucketName, objectKey, verifier, codec, attrs)
+	settle(err == nil)
+	return info, err
+}
+
+// lockObject serializes writes and deletes of the object at path while they
+// read the version they replace. With deduplication, two overwrites racing
+// between reading the old pointer and writing the new one would both release
+// the old blob and leave one of the new ones unreferenced; with usage
+// tracking, both would be charged as new objects; with erasure coding, a
+// repair would write the manifest of the version it started from.
+func (g *Gateway) lockObject(path string) (unlock func()) {
+	if !g.dedup && g.usage == nil && !g.erasure.enabled() {
+		return func() {}
+	}
+	return g.objectLocks.Lock(path)
+}
+
+// putObject stores the verified upload in the layout the gateway is configured for.
+func (g *Gateway) putObject(ctx context.Context, bucketName, objectKey string, verifier *verifyingReader, codec string, attrs storeObject) (ObjectInfo, error) {
+	if verifier.size == 0 {
+		// Backends may never read an empty body, so settle it up front.
+		if _, err := io.Copy(io.Discard, verifier); err != nil {
+			return ObjectInfo{}, err
+		}
+	}
+
+	if g.dedup {
+		return g.putDeduplicated(ctx, bucketName, objectKey, verifier, codec, attrs)
+	}
+	if g.erasure.enabled() {
+		if codec != CompressionNone {
+			return ObjectInfo{}, fmt.Errorf("%w: %q is not available with erasure coding", ErrUnsupportedCompression, codec)
+		}
+		return g.putErasureCoded(ctx, bucketName, objectKey, verifier, attrs)
+	}
+
+	store, err := g.selectStore(objectKey)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	if err := g.ensureBucket(ctx, store, bucketName); err != nil {
+		return ObjectInfo{}, err
+	}
+
+	checksum, err := g.writeObject(ctx, store, bucketName, objectKey, verifier, codec, attrs)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	return ObjectInfo{
+		Key:            objectKey,
+		ContentType:    attrs.ContentType,
+		Size:           verifier.size,
+		ChecksumSHA256: checksum,
+	}, nil
+}
+
+// writeObject uploads the verified stream to store under storageKey in
+// bucketName, compressing it with codec, and returns the SHA-256 of the
+// original bytes.
+func (g *Gateway) writeObject(ctx context.Context, store objectStore, bucketName, storageKey string, verifier *verifyingReader, codec string, attrs storeObject) (string, error) {
+	metadata := maps.Clone(attrs.Metadata)
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	attrs.Metadata = metadata
+
+	var body io.Reader = verifier
+	uploadSize := verifier.size
+	if codec != CompressionNone {
+		compressed, compressedSize, err := compressObject(verifier, verifier.size, codec)
 		if err != nil {
-			errResp := minio.ToErrorResponse(err)
-			if errResp.Code != "BucketAlreadyOwnedByYou" && errResp.Code != "BucketAlreadyExists" {
-				return fmt.Errorf("failed to create bucket %q: %w", g.bucketName, err)
+			if verifier.err != nil {
+				return "", verifier.err
 			}
+			return "", fmt.Errorf("failed to compress object: %w", err)
+		}
+		defer compressed.Close()
+
+		body, uploadSize = compressed, compressedSize
+		attrs.Metadata[metaCodec] = codec
+		attrs.Metadata[metaOriginalSize] = strconv.FormatInt(verifier.size, 10)
+	}
+
+	// Metadata travels with the upload request, so the digest can only be
+	// attached up front when it is already known: supplied by the client, or
+	// computed because the object was compressed in memory. Otherwise the
+	// backend records the SHA-256 it computes while the body streams.
+	digestKnown := verifier.checked || verifier.wantSHA256 != nil
+	if digestKnown {
+		attrs.Metadata[metaSHA256] = hex.EncodeToString(verifier.wantSHA256)
+		if verifier.checked {
+			attrs.Metadata[metaSHA256] = verifier.sha256Hex()
+		}
+	} else {
+		attrs.RecordSHA256 = uploadSize <= maxSinglePutSize
+	}
+
+	if err := store.PutObject(ctx, bucketName, storageKey, body, uploadSize, attrs); err != nil {
+		if verifier.err != nil {
+			return "", verifier.err
 		}
+		return "", fmt.Errorf("failed to put object in minio: %w", err)
 	}
 
-	_, err = client.PutObject(ctx, g.bucketName, objectKey, data, size, minio.PutObjectOptions{})
+	if !verifier.checked {
+		// The backend accepted the object without consuming the declared
+		// size, so what it stored cannot be trusted.
+		if err := store.RemoveObject(ctx, bucketName, storageKey); err != nil {
+			log.Printf("PUT /object/%s - failed to remove incomplete object: %v", storageKey, err)
+		}
+		return "", fmt.Errorf("%w: upload ended before %d bytes were stored", ErrIncompleteUpload, verifier.size)
+	}
+
+	checksum := verifier.sha256Hex()
+	if !digestKnown && !attrs.RecordSHA256 {
+		// Too large for a single request, so the digest is attached by
+		// rewriting the metadata once the upload is done.
+		attrs.Metadata[metaSHA256] = checksum
+		if err := store.ReplaceMetadata(ctx, bucketName, storageKey, attrs); err != nil {
+			return "", fmt.Errorf("failed to record checksum: %w", err)
+		}
+	}
+
+	return checksum, nil
+}
+
+// StatObject returns the metadata GetObject would report for an object
+// without opening its body.
+func (g *Gateway) StatObject(ctx context.Context, bucketName, objectKey string, opts GetOptions) (ObjectInfo, error) {
+	if err := g.keys.Validate(objectKey); err != nil {
+		return ObjectInfo{}, err
+	}
+
+	bucketName, err := g.resolveBucket(ctx, bucketName)
 	if err != nil {
-		return fmt.Errorf("failed to put object in minio: %w", err)
+		return ObjectInfo{}, err
 	}
 
-	return nil
+	if g.cache != nil && !opts.BypassCache {
+		if entry, ok := g.cache.get(objectPath(bucketName, objectKey), opts.AcceptEncoding); ok {
+			return entry.info, nil
+		}
+	}
+
+	_, _, stat, err := g.resolveObject(ctx, bucketName, objectKey)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	info, _, err := describeObject(objectKey, stat, opts)
+	return info, err
 }
 
-// GetObject retrieves an object from the gateway.
-func (g *Gateway) GetObject(ctx context.Context, objectKey string) (io.ReadCloser, error) {
-	if err := ValidateObjectID(objectKey); err != nil {
+// GetObject retrieves an object from the gateway, serving small objects from
+// the object cache when one is configured.
+func (g *Gateway) GetObject(ctx context.Context, bucketName, objectKey string, opts GetOptions) (*Object, error) {
+	if err := g.keys.Validate(objectKey); err != nil {
+		return nil, err
+	}
+
+	bucketName, err := g.resolveBucket(ctx, bucketName)
+	if err != nil {
 		return nil, err
 	}
 
+	if g.cache == nil {
+		return g.sharedFetch(ctx, bucketName, objectKey, opts)
+	}
+
+	path := objectPath(bucketName, objectKey)
+	if !opts.BypassCache {
+		if entry, ok := g.cache.get(path, opts.AcceptEncoding); ok {
+			return &Object{ReadCloser: io.NopCloser(bytes.NewReader(entry.data)), Info: entry.info}, nil
+		}
+	}
+
+	token := g.cache.beginFetch(path)
+	defer g.cache.endFetch(token)
+	object, err := g.sharedFetch(ctx, bucketName, objectKey, opts)
+	if err != nil || !g.cache.cacheable(object.Info.Size) {
+		return object, err
+	}
+	defer object.Close()
+
+	data, err := io.ReadAll(object)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+	if int64(len(data)) != object.Info.Size {
+		return nil, fmt.Errorf("read %d bytes of object, expected %d", len(data), object.Info.Size)
+	}
+	g.cache.add(token, object.Info, data)
+
+	return &Object{ReadCloser: io.NopCloser(bytes.NewReader(data)), Info: object.Info}, nil
+}
+
+// sharedFetch fetches an object, joining a concurrent fetch of the same
+// object when request coalescing is enabled.
+func (g *Gateway) sharedFetch(ctx context.Context, bucketName, objectKey string, opts GetOptions) (*Object, error) {
+	if g.coalescer == nil {
+		return g.fetchObject(ctx, bucketName, objectKey, opts)
+	}
+
+	return g.coalescer.get(ctx, objectPath(bucketName, objectKey), opts, func(ctx context.Context) (*Object, error) {
+		return g.fetchObject(ctx, bucketName, objectKey, opts)
+	})
+}
+
+// fetchObject opens an object on its backend, or from the disk cache when
+// the cached copy still matches the backend ETag.
+func (g *Gateway) fetchObject(ctx context.Context, bucketName, objectKey string, opts GetOptions) (*Object, error) {
+	store, storageKey, stat, err := g.resolveObject(ctx, bucketName, objectKey)
+	if err != nil {
+		return nil, err
+	}
+
+	info, decode, err := describeObject(objectKey, stat, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	path := objectPath(bucketName, objectKey)
+	if g.disk != nil && !opts.BypassCache {
+		if body, ok := g.disk.open(path, stat.ETag, info); ok {
+			return &Object{ReadCloser: body, Info: info}, nil
+		}
+	}
+
+	body, err := g.openBody(ctx, store, bucketName, objectKey, storageKey, stat, decode)
+	if err != nil {
+		return nil, err
+	}
+
+	if g.disk != nil {
+		body = g.disk.fill(path, stat.ETag, info, body)
+	}
+
+	return &Object{ReadCloser: body, Info: info}, nil
+}
+
+// openBody opens the stored bytes of an object, undoing the decode codec.
+func (g *Gateway) openBody(ctx context.Context, store objectStore, bucketName, objectKey, storageKey string, stat storeObject, decode string) (io.ReadCloser, error) {
+	if isErasureManifest(stat) {
+		return g.openErasureObject(ctx, store, bucketName, objectKey)
+	}
+
+	body, err := store.GetObject(ctx, bucketName, storageKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+
+	if decode != CompressionNone {
+		decoded, err := decompressObject(body, decode)
+		if err != nil {
+			body.Close()
+			return nil, err
+		}
+		body = decoded
+	}
+
+	return body, nil
+}
+
+// DeleteObject removes an object from a bucket of the gateway; an empty
+// bucketName selects the default bucket.
+func (g *Gateway) DeleteObject(ctx context.Context, bucketName, objectKey string) error {
+	if err := g.keys.Validate(objectKey); err != nil {
+		return err
+	}
+
+	bucketName, err := g.resolveBucket(ctx, bucketName)
+	if err != nil {
+		return err
+	}
+	path := objectPath(bucketName, objectKey)
+	defer g.lockObject(path)()
+	if g.usage != nil {
+		ctx = withEntryCache(ctx)
+	}
+
+	if g.cache != nil {
+		defer g.cache.invalidate(path)
+	}
+	if g.disk != nil {
+		defer g.disk.remove(path)
+	}
+	if g.coalescer != nil {
+		defer g.coalescer.forget(path)
+	}
+
+	if g.erasure.enabled() {
+		store, _, stat, err := g.resolveObject(ctx, bucketName, objectKey)
+		if err != nil {
+			return err
+		}
+		if isErasureManifest(stat) {
+			if err := g.deleteErasureObject(ctx, store, bucketName, objectKey); err != nil {
+				return err
+			}
+			if g.usage != nil {
+				g.releaseObject(stat, objectKey)
+			}
+			return nil
+		}
+	}
+
+	store, err := g.selectStore(objectKey)
+	if err != nil {
+		return err
+	}
+
+	stat, err := g.statObject(ctx, store, bucketName, objectKey)
+	if err != nil {
+		return err
+	}
+
+	if err := store.RemoveObject(ctx, bucketName, objectKey); err != nil {
+		return fmt.Errorf("failed to remove object: %w", err)
+	}
+	if g.usage != nil {
+		g.releaseObject(stat, objectKey)
+	}
+
+	if blobHash := stat.Metadata[metaBlob]; blobHash != "" {
+		if err := g.releaseBlob(ctx, bucketName, blobHash, objectKey); err != nil {
+			log.Printf("DELETE /object/%s - failed to release blob %s: %v", objectKey, blobHash, err)
+		}
+	}
+
+	return nil
+}
+
+// CacheStats reports hit, miss and size counters of the object cache.
+func (g *Gateway) CacheStats() CacheStats {
+	if g.cache == nil {
+		return CacheStats{}
+	}
+	return g.cache.stats()
+}
+
+// Close closes the gateway and all connections.
+func (g *Gateway) Close() error {
+	return g.clients.Close()
+}
+
+// selectStore returns the backend store owning objectKey.
+func (g *Gateway) selectStore(objectKey string) (objectStore, error) {
 	// Select instance based on object ID
 	instanceID, err := g.hasher.SelectInstance(objectKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to select instance: %w", err)
 	}
 
-	// Get the Minio client for the selected instance
+	return g.instanceStore(instanceID)
+}
+
+// instanceStore returns the store of an instance, metered when usage is tracked.
+func (g *Gateway) instanceStore(instanceID string) (objectStore, error) {
+	store, err := g.storeFor(instanceID)
+	if err != nil || g.usage == nil {
+		return store, err
+	}
+	return meteredStore{objectStore: store, instanceID: instanceID, usage: g.usage}, nil
+}
+
+func (g *Gateway) minioStore(instanceID string) (objectStore, error) {
 	client, err := g.clients.GetClient(instanceID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get client: %w", err)
 	}
 
-	// Retrieve object from Minio
-	_, err = client.StatObject(ctx, g.bucketName, objectKey, minio.StatObjectOptions{})
+	if g.authErrors != nil {
+		return authCheckedStore{objectStore: minioStore{client: client}, instanceID: instanceID, reporter: g.authErrors}, nil
+	}
+	return minioStore{client: client}, nil
+}
 
+// resolveObject locates the stored bytes behind objectKey, following
+// deduplication pointers to their blob. The returned stat keeps the content
+// type recorded on the pointer. With erasure coding the manifest is looked up
+// on its replicas when the owner cannot provide it.
+func (g *Gateway) resolveObject(ctx context.Context, bucketName, objectKey string) (objectStore, string, storeObject, error) {
+	store, err := g.selectStore(objectKey)
+	var stat storeObject
+	if err == nil {
+		stat, err = g.statObject(ctx, store, bucketName, objectKey)
+	}
 	if err != nil {
-		errResponse := minio.ToErrorResponse(err)
-		if errResponse.Code == "NoSuchKey" || errResponse.Code == "NoSuchBucket" || errResponse.Code == "NoSuchObject" {
-			return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, objectKey)
+		if g.erasure.enabled() {
+			if replica, replicaStat, ok := g.statManifestReplica(ctx, bucketName, objectKey); ok {
+				return replica, objectKey, replicaStat, nil
+			}
 		}
-		log.Printf("GET /object/%s - error stat object: %v, code: %s", objectKey, errResponse, errResponse.Code)
-		return nil, fmt.Errorf("failed to stat object: %w", err)
+		return nil, "", storeObject{}, err
 	}
 
-	object, err := client.GetObject(ctx, g.bucketName, objectKey, minio.GetObjectOptions{})
+	blobHash := stat.Metadata[metaBlob]
+	if blobHash == "" {
+		return store, objectKey, stat, nil
+	}
+
+	blobStore, err := g.selectStore(blobHash)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get object: %w", err)
+		return nil, "", storeObject{}, err
 	}
 
-	return object, nil
+	blobStat, err := g.statObject(ctx, blobStore, bucketName, blobKey(blobHash))
+	if err != nil {
+		if errors.Is(err, ErrObjectNotFound) {
+			return nil, "", storeObject{}, fmt.Errorf("blob %s referenced by %s is missing: %v", blobHash, objectKey, err)
+		}
+		return nil, "", storeObject{}, err
+	}
+	blobStat.ContentType = stat.ContentType
+
+	return blobStore, blobKey(blobHash), blobStat, nil
 }
 
-// Close closes the gateway and all connections.
-func (g *Gateway) Close() error {
-	return g.clients.Close()
+func (g *Gateway) statObject(ctx context.Context, store objectStore, bucketName, objectKey string) (storeObject, error) {
+	stat, err := store.StatObject(ctx, bucketName, objectKey)
+	if err != nil {
+		if errors.Is(err, ErrObjectNotFound) {
+			return storeObject{}, err
+		}
+		log.Printf("GET /object/%s - error stat object: %v", objectKey, err)
+		return storeObject{}, fmt.Errorf("failed to stat object: %w", err)
+	}
+
+	return stat, nil
+}
+
+// describeObject builds the client facing metadata for a stored object and
+// reports which codec, if any, must be undone before returning its body.
+func describeObject(objectKey string, stat storeObject, opts GetOptions) (ObjectInfo, string, error) {
+	codec, originalSize, err := storedCodec(stat.Metadata)
+	if err != nil {
+		return ObjectInfo{}, "", fmt.Errorf("failed to read object metadata: %w", err)
+	}
+
+	info := ObjectInfo{
+		Key:            objectKey,
+		ContentType:    stat.ContentType,
+		Size:           stat.Size,
+		ChecksumSHA256: stat.Metadata[metaSHA256],
+	}
+
+	if isErasureManifest(stat) {
+		info.Size, err = strconv.ParseInt(stat.Metadata[metaOriginalSize], 10, 64)
+		if err != nil {
+			return ObjectInfo{}, "", fmt.Errorf("invalid original size metadata: %w", err)
+		}
+		return info, CompressionNone, nil
+	}
+
+	if codec == CompressionNone {
+		return info, CompressionNone, nil
+	}
+	if acceptsEncoding(opts.AcceptEncoding, codec) {
+		info.ContentEncoding = codec
+		return info, CompressionNone, nil
+	}
+
+	info.Size = originalSize
+	return info, codec, nil
 }
@@ -1,9 +1,21 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/irensaltali/object-storage-gateway/internal/discovery"
 )
@@ -46,6 +58,15 @@ func TestNewGateway(t *testing.T) {
 			wantErr: true,
 			errMsg:  "bucket name cannot be empty",
 		},
+		{
+			name: "unknown compression codec",
+			instances: []discovery.MinioInstance{
+				{ID: "instance-1", Host: "localhost", Port: "9000", AccessKey: "minioadmin", SecretKey: "minioadmin"},
+			},
+			options: []GatewayOption{WithCompression("lzma")},
+			wantErr: true,
+			errMsg:  "unsupported compression",
+		},
 	}
 
 	for _, tt := range tests {
@@ -77,6 +98,79 @@ func TestNewGateway(t *testing.T) {
 	}
 }
 
+func TestGatewayUpdateInstances(t *testing.T) {
+	gateway, err := NewGateway(testInstances(2))
+	if err != nil {
+		t.Fatalf("failed to create gateway: %v", err)
+	}
+	defer gateway.Close()
+
+	if err := gateway.UpdateInstances(testInstances(3)); err != nil {
+		t.Fatalf("UpdateInstances() unexpected error: %v", err)
+	}
+	if got := gateway.hasher.Instances(); len(got) != 3 {
+		t.Fatalf("hasher has %d instances, want 3", len(got))
+	}
+	if _, err := gateway.clients.GetClient("instance-3"); err != nil {
+		t.Fatalf("no client for added instance: %v", err)
+	}
+
+	if err := gateway.UpdateInstances(nil); err == nil {
+		t.Fatal("expected error for empty instance list")
+	}
+	if got := gateway.hasher.Instances(); len(got) != 3 {
+		t.Fatalf("rejected update changed the hasher to %v", got)
+	}
+
+	if err := gateway.UpdateInstances(testInstances(1)); err != nil {
+		t.Fatalf("UpdateInstances() unexpected error: %v", err)
+	}
+	if got := gateway.hasher.Instances(); !slices.Equal(got, []string{"instance-1"}) {
+		t.Fatalf("hasher has %v, want [instance-1]", got)
+	}
+	if _, err := gateway.clients.GetClient("instance-2"); err == nil {
+		t.Fatal("client of removed instance was kept")
+	}
+
+	duplicate := append(testInstances(1), testInstances(1)...)
+	if err := gateway.UpdateInstances(duplicate); err == nil {
+		t.Fatal("expected error for duplicate instances")
+	}
+}
+
+func TestGatewayInstanceWeights(t *testing.T) {
+	instances := testInstances(2)
+	instances[0].Weight = 3
+	gateway, err := NewGateway(instances)
+	if err != nil {
+		t.Fatalf("failed to create gateway: %v", err)
+	}
+	defer gateway.Close()
+
+	if got := gateway.hasher.weights["instance-1"]; got != 3 {
+		t.Fatalf("instance-1 weight = %v, want 3", got)
+	}
+
+	if err := gateway.UpdateInstances(testInstances(2)); err != nil {
+		t.Fatalf("UpdateInstances() unexpected error: %v", err)
+	}
+	if gateway.hasher.weights != nil {
+		t.Fatalf("default weights kept %v", gateway.hasher.weights)
+	}
+}
+
+func TestGatewayUpdateInstancesErasure(t *testing.T) {
+	gateway, err := NewGateway(testInstances(3), WithErasureCoding(2, 1))
+	if err != nil {
+		t.Fatalf("failed to create gateway: %v", err)
+	}
+	defer gateway.Close()
+
+	if err := gateway.UpdateInstances(testInstances(2)); err == nil {
+		t.Fatal("expected error when too few instances remain for the shards")
+	}
+}
+
 func TestGatewayPutObjectValidation(t *testing.T) {
 	instances := []discovery.MinioInstance{
 		{ID: "instance-1", Host: "localhost", Port: "9000", AccessKey: "minioadmin", SecretKey: "minioadmin"},
@@ -88,15 +182,15 @@ func TestGatewayPutObjectValidation(t *testing.T) {
 	}
 	defer gateway.Close()
 
-	if err := gateway.PutObject(context.Background(), "invalid-id!", strings.NewReader("data"), 4); err == nil {
+	if _, err := gateway.PutObject(context.Background(), "", "invalid-id!", strings.NewReader("data"), 4, PutOptions{}); err == nil {
 		t.Fatal("expected error for invalid object id")
 	}
 
-	if err := gateway.PutObject(context.Background(), "object1", nil, 0); err == nil {
+	if _, err := gateway.PutObject(context.Background(), "", "object1", nil, 0, PutOptions{}); err == nil {
 		t.Fatal("expected error for nil data")
 	}
 
-	if err := gateway.PutObject(context.Background(), "object1", strings.NewReader("data"), -1); err == nil {
+	if _, err := gateway.PutObject(context.Background(), "", "object1", strings.NewReader("data"), -1, PutOptions{}); err == nil {
 		t.Fatal("expected error for negative size")
 	}
 }
@@ -112,7 +206,435 @@ func TestGatewayGetObjectValidation(t *testing.T) {
 	}
 	defer gateway.Close()
 
-	if _, err := gateway.GetObject(context.Background(), "invalid-id!"); err == nil {
+	if _, err := gateway.GetObject(context.Background(), "", "invalid-id!", GetOptions{}); err == nil {
 		t.Fatal("expected error for invalid object id")
 	}
 }
+
+func TestGatewayCompressionRoundTrip(t *testing.T) {
+	payload := strings.Repeat(`{"level":"info","msg":"request served"}`+"\n", 200)
+
+	tests := []struct {
+		name           string
+		putOpts        PutOptions
+		acceptEncoding string
+		wantCodec      string
+		wantEncoding   string
+	}{
+		{
+			name:      "compressed by content type",
+			putOpts:   PutOptions{ContentType: "application/json"},
+			wantCodec: CompressionZstd,
+		},
+		{
+			name:      "uncompressed content type",
+			putOpts:   PutOptions{ContentType: "image/png"},
+			wantCodec: "",
+		},
+		{
+			name:      "codec requested explicitly",
+			putOpts:   PutOptions{ContentType: "image/png", Compression: "gzip"},
+			wantCodec: CompressionGzip,
+		},
+		{
+			name:      "compression disabled explicitly",
+			putOpts:   PutOptions{ContentType: "application/json", Compression: "none"},
+			wantCodec: "",
+		},
+		{
+			name:           "compressed passthrough",
+			putOpts:        PutOptions{ContentType: "text/plain"},
+			acceptEncoding: "gzip, zstd;q=0.5",
+			wantCodec:      CompressionZstd,
+			wantEncoding:   CompressionZstd,
+		},
+		{
+			name:           "passthrough refused with zero quality",
+			putOpts:        PutOptions{ContentType: "text/plain"},
+			acceptEncoding: "zstd;q=0",
+			wantCodec:      CompressionZstd,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gateway, store := newTestGateway(t, WithCompression(CompressionZstd))
+
+			_, err := gateway.PutObject(context.Background(), "", "object1", strings.NewReader(payload), int64(len(payload)), tt.putOpts)
+			if err != nil {
+				t.Fatalf("PutObject() unexpected error: %v", err)
+			}
+
+			stored := store.object("object1")
+			if got := stored.attrs.Metadata[metaCodec]; got != tt.wantCodec {
+				t.Fatalf("stored codec = %q, want %q", got, tt.wantCodec)
+			}
+			if tt.wantCodec != "" && len(stored.data) >= len(payload) {
+				t.Fatalf("stored %d bytes, want fewer than %d", len(stored.data), len(payload))
+			}
+
+			object, err := gateway.GetObject(context.Background(), "", "object1", GetOptions{AcceptEncoding: tt.acceptEncoding})
+			if err != nil {
+				t.Fatalf("GetObject() unexpected error: %v", err)
+			}
+			defer object.Close()
+
+			body, err := io.ReadAll(object)
+			if err != nil {
+				t.Fatalf("failed to read object: %v", err)
+			}
+
+			if object.Info.ContentEncoding != tt.wantEncoding {
+				t.Fatalf("ContentEncoding = %q, want %q", object.Info.ContentEncoding, tt.wantEncoding)
+			}
+			if object.Info.Size != int64(len(body)) {
+				t.Fatalf("Size = %d, want %d", object.Info.Size, len(body))
+			}
+			if tt.wantEncoding == "" && string(body) != payload {
+				t.Fatal("round-tripped body does not match payload")
+			}
+			if tt.wantEncoding != "" && !bytes.Equal(body, stored.data) {
+				t.Fatal("passthrough body does not match stored bytes")
+			}
+		})
+	}
+}
+
+func TestGatewayPutObjectUnsupportedCompression(t *testing.T) {
+	gateway, _ := newTestGateway(t)
+
+	_, err := gateway.PutObject(context.Background(), "", "object1", strings.NewReader("data"), 4, PutOptions{Compression: "lzma"})
+	if !errors.Is(err, ErrUnsupportedCompression) {
+		t.Fatalf("PutObject() error = %v, want ErrUnsupportedCompression", err)
+	}
+}
+
+func TestGatewayPutObjectChecksums(t *testing.T) {
+	payload := "checksummed payload"
+	sum := sha256.Sum256([]byte(payload))
+	md5Sum := md5.Sum([]byte(payload))
+	wantSHA256 := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name    string
+		opts    PutOptions
+		wantErr error
+	}{
+		{name: "no digests", opts: PutOptions{}},
+		{name: "matching sha256", opts: PutOptions{ChecksumSHA256: strings.ToUpper(wantSHA256)}},
+		{name: "matching md5", opts: PutOptions{ContentMD5: base64.StdEncoding.EncodeToString(md5Sum[:])}},
+		{name: "matching sha256 compressed", opts: PutOptions{ChecksumSHA256: wantSHA256, Compression: CompressionGzip}},
+		{name: "mismatched sha256", opts: PutOptions{ChecksumSHA256: strings.Repeat("0", 64)}, wantErr: ErrChecksumMismatch},
+		{name: "mismatched md5", opts: PutOptions{ContentMD5: "1B2M2Y8AsgTpgAmY7PhCfg=="}, wantErr: ErrChecksumMismatch},
+		{name: "mismatched compressed", opts: PutOptions{ChecksumSHA256: strings.Repeat("0", 64), Compression: CompressionZstd}, wantErr: ErrChecksumMismatch},
+		{name: "malformed sha256", opts: PutOptions{ChecksumSHA256: "xyz"}, wantErr: ErrInvalidChecksum},
+		{name: "malformed md5", opts: PutOptions{ContentMD5: "not base64"}, wantErr: ErrInvalidChecksum},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gateway, store := newTestGateway(t)
+
+			info, err := gateway.PutObject(context.Background(), "", "object1", strings.NewReader(payload), int64(len(payload)), tt.opts)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("PutObject() error = %v, want %v", err, tt.wantErr)
+				}
+				if store.hasObject("object1") {
+					t.Fatal("object stored despite failed verification")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PutObject() unexpected error: %v", err)
+			}
+			if info.ChecksumSHA256 != wantSHA256 {
+				t.Fatalf("ChecksumSHA256 = %q, want %q", info.ChecksumSHA256, wantSHA256)
+			}
+
+			stat, err := gateway.StatObject(context.Background(), "", "object1", GetOptions{})
+			if err != nil {
+				t.Fatalf("StatObject() unexpected error: %v", err)
+			}
+			if stat.ChecksumSHA256 != wantSHA256 {
+				t.Fatalf("stored checksum = %q, want %q", stat.ChecksumSHA256, wantSHA256)
+			}
+			if stat.Size != int64(len(payload)) {
+				t.Fatalf("Size = %d, want %d", stat.Size, len(payload))
+			}
+			if store.metadataRewrites != 0 {
+				t.Fatalf("metadata rewritten %d time(s), want the checksum recorded with the upload", store.metadataRewrites)
+			}
+		})
+	}
+}
+
+func TestGatewayPutObjectIncompleteUpload(t *testing.T) {
+	for _, codec := range []string{CompressionNone, CompressionZstd} {
+		t.Run(codec, func(t *testing.T) {
+			gateway, store := newTestGateway(t)
+
+			_, err := gateway.PutObject(context.Background(), "", "object1", strings.NewReader("partial"), 100, PutOptions{Compression: codec})
+			if !errors.Is(err, ErrIncompleteUpload) {
+				t.Fatalf("PutObject() error = %v, want ErrIncompleteUpload", err)
+			}
+			if store.hasObject("object1") {
+				t.Fatal("incomplete object is visible in the store")
+			}
+		})
+	}
+}
+
+func TestGatewayPutObjectRemovesUnconsumedUpload(t *testing.T) {
+	gateway, store := newTestGateway(t)
+	store.putLimit = 2
+
+	_, err := gateway.PutObject(context.Background(), "", "object1", strings.NewReader("payload"), 7, PutOptions{})
+	if !errors.Is(err, ErrIncompleteUpload) {
+		t.Fatalf("PutObject() error = %v, want ErrIncompleteUpload", err)
+	}
+	if store.hasObject("object1") {
+		t.Fatal("incomplete object is visible in the store")
+	}
+}
+
+func TestGatewayGetObjectNotFound(t *testing.T) {
+	gateway, _ := newTestGateway(t)
+
+	_, err := gateway.GetObject(context.Background(), "", "missing", GetOptions{})
+	if !errors.Is(err, ErrObjectNotFound) {
+		t.Fatalf("GetObject() error = %v, want ErrObjectNotFound", err)
+	}
+}
+
+// newTestGateway returns a gateway whose instances are backed by one in-memory store.
+func newTestGateway(t *testing.T, opts ...GatewayOption) (*Gateway, *fakeStore) {
+	t.Helper()
+
+	instances := []discovery.MinioInstance{
+		{ID: "instance-1", Host: "localhost", Port: "9000", AccessKey: "minioadmin", SecretKey: "minioadmin"},
+		{ID: "instance-2", Host: "localhost", Port: "9001", AccessKey: "minioadmin", SecretKey: "minioadmin"},
+	}
+
+	gateway, err := NewGateway(instances, opts...)
+	if err != nil {
+		t.Fatalf("failed to create gateway: %v", err)
+	}
+	t.Cleanup(func() { _ = gateway.Close() })
+
+	store := newFakeStore()
+	gateway.storeFor = func(instanceID string) (objectStore, error) {
+		return store, nil
+	}
+
+	return gateway, store
+}
+
+type fakeObject struct {
+	data  []byte
+	attrs storeObject
+}
+
+type fakeStore struct {
+	mu      sync.Mutex
+	buckets map[string]bool
+	// objects is keyed by objectPath(bucketName, objectKey).
+	objects map[string]fakeObject
+	// putLimit, when positive, makes PutObject store only that many bytes.
+	putLimit int64
+	// metadataRewrites counts ReplaceMetadata calls.
+	metadataRewrites int
+	// statDelay, when positive, stretches every StatObject call.
+	statDelay time.Duration
+	// stats counts StatObject calls.
+	stats int
+	// bucketChecks counts BucketExists calls.
+	bucketChecks int
+	// listings counts ListObjects calls.
+	listings int
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		buckets: make(map[string]bool),
+		objects: make(map[string]fakeObject),
+	}
+}
+
+// object returns objectKey from the default bucket.
+func (f *fakeStore) object(objectKey string) fakeObject {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.objects[objectPath(defaultBucketName, objectKey)]
+}
+
+// setObject replaces objectKey in the default bucket behind the gateway's back.
+func (f *fakeStore) setObject(objectKey string, object fakeObject) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.objects[objectPath(defaultBucketName, objectKey)] = object
+}
+
+// hasObject reports whether objectKey exists in the default bucket.
+func (f *fakeStore) hasObject(objectKey string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.objects[objectPath(defaultBucketName, objectKey)]
+	return ok
+}
+
+func (f *fakeStore) keysWithPrefix(prefix string) []string {
+	objects := f.list(defaultBucketName, prefix)
+	keys := make([]string, 0, len(objects))
+	for _, object := range objects {
+		keys = append(keys, object.Key)
+	}
+	return keys
+}
+
+func (f *fakeStore) BucketExists(ctx context.Context, bucketName string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.bucketChecks++
+	return f.buckets[bucketName], nil
+}
+
+func (f *fakeStore) MakeBucket(ctx context.Context, bucketName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.buckets[bucketName] = true
+	return nil
+}
+
+func (f *fakeStore) RemoveBucket(ctx context.Context, bucketName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for path := range f.objects {
+		if strings.HasPrefix(path, bucketName+"/") {
+			return fmt.Errorf("%w: %s", ErrBucketNotEmpty, bucketName)
+		}
+	}
+	delete(f.buckets, bucketName)
+	return nil
+}
+
+func (f *fakeStore) PrefixEmpty(ctx context.Context, bucketName, prefix string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for path := range f.objects {
+		if strings.HasPrefix(path, bucketName+"/"+prefix) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (f *fakeStore) ListBuckets(ctx context.Context) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Sorted(maps.Keys(f.buckets)), nil
+}
+
+func (f *fakeStore) PutObject(ctx context.Context, bucketName, objectKey string, data io.Reader, size int64, opts storeObject) error {
+	if f.putLimit > 0 {
+		data = io.LimitReader(data, f.putLimit)
+		size = f.putLimit
+	}
+	body, err := io.ReadAll(data)
+	if err != nil {
+		return err
+	}
+	if size >= 0 && int64(len(body)) != size {
+		return fmt.Errorf("read %d bytes, want %d", len(body), size)
+	}
+	opts.Metadata = maps.Clone(opts.Metadata)
+	if opts.RecordSHA256 {
+		if opts.Metadata == nil {
+			opts.Metadata = map[string]string{}
+		}
+		digest := sha256.Sum256(body)
+		opts.Metadata[metaSHA256] = hex.EncodeToString(digest[:])
+		opts.RecordSHA256 = false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.buckets[bucketName] {
+		return fmt.Errorf("bucket %s does not exist", bucketName)
+	}
+	opts.Size = int64(len(body))
+	sum := md5.Sum(body)
+	opts.ETag = hex.EncodeToString(sum[:])
+	f.objects[objectPath(bucketName, objectKey)] = fakeObject{data: body, attrs: opts}
+	return nil
+}
+
+func (f *fakeStore) StatObject(ctx context.Context, bucketName, objectKey string) (storeObject, error) {
+	if f.statDelay > 0 {
+		time.Sleep(f.statDelay)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stats++
+	object, ok := f.objects[objectPath(bucketName, objectKey)]
+	if !ok {
+		return storeObject{}, fmt.Errorf("%w: %s", ErrObjectNotFound, objectKey)
+	}
+	return object.attrs, nil
+}
+
+func (f *fakeStore) GetObject(ctx context.Context, bucketName, objectKey string) (io.ReadCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	object, ok := f.objects[objectPath(bucketName, objectKey)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, objectKey)
+	}
+	return io.NopCloser(bytes.NewReader(object.data)), nil
+}
+
+func (f *fakeStore) ReplaceMetadata(ctx context.Context, bucketName, objectKey string, opts storeObject) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	path := objectPath(bucketName, objectKey)
+	object, ok := f.objects[path]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrObjectNotFound, objectKey)
+	}
+	object.attrs.ContentType = opts.ContentType
+	object.attrs.Metadata = maps.Clone(opts.Metadata)
+	f.objects[path] = object
+	f.metadataRewrites++
+	return nil
+}
+
+func (f *fakeStore) RemoveObject(ctx context.Context, bucketName, objectKey string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.objects, objectPath(bucketName, objectKey))
+	return nil
+}
+
+func (f *fakeStore) ListObjects(ctx context.Context, bucketName, prefix string) ([]storeObject, error) {
+	f.mu.Lock()
+	f.listings++
+	f.mu.Unlock()
+	return f.list(bucketName, prefix), nil
+}
+
+// list returns the objects under prefix without counting as a listing.
+func (f *fakeStore) list(bucketName, prefix string) []storeObject {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var objects []storeObject
+	for path, object := range f.objects {
+		key, ok := strings.CutPrefix(path, bucketName+"/")
+		if ok && strings.HasPrefix(key, prefix) {
+			attrs := object.attrs
+			attrs.Key = key
+			objects = append(objects, attrs)
+		}
+	}
+	slices.SortFunc(objects, func(a, b storeObject) int { return strings.Compare(a.Key, b.Key) })
+	return objects
+}
@@ -3,12 +3,18 @@ package storage
 import (
 	"fmt"
 	"hash/fnv"
+	"math"
 	"sort"
+	"sync"
 )
 
-// ConsistentHasher provides deterministic mapping of IDs to instances.
+// ConsistentHasher provides deterministic mapping of IDs to instances. It is
+// safe for concurrent use.
 type ConsistentHasher struct {
+	mu        sync.RWMutex
 	instances []string
+	// weights holds the instances whose weight is not 1.
+	weights map[string]int
 }
 
 // NewConsistentHasher creates a new hasher for the given instances.
@@ -32,6 +38,9 @@ func (ch *ConsistentHasher) SelectInstance(objectKey string) (string, error) {
 		return "", fmt.Errorf("object id cannot be empty")
 	}
 
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
 	if len(ch.instances) == 0 {
 		return "", fmt.Errorf("no instances available")
 	}
@@ -39,11 +48,11 @@ func (ch *ConsistentHasher) SelectInstance(objectKey string) (string, error) {
 	// Rendezvous hashing (highest-random-weight) keeps selection deterministic
 	// while avoiding modulo based bucket assignment.
 	selected := ""
-	var maxScore uint64
+	var maxScore rendezvousScore
 
 	for idx, instance := range ch.instances {
-		score := calculateRendezvousScore(objectKey, instance)
-		if idx == 0 || score > maxScore || (score == maxScore && instance < selected) {
+		score := ch.score(objectKey, instance)
+		if idx == 0 || score.greater(maxScore) || (score == maxScore && instance < selected) {
 			selected = instance
 			maxScore = score
 		}
@@ -52,19 +61,115 @@ func (ch *ConsistentHasher) SelectInstance(objectKey string) (string, error) {
 	return selected, nil
 }
 
+// RankInstances returns up to n instance IDs ordered by descending rendezvous
+// score for objectKey. The first entry is the one SelectInstance returns.
+func (ch *ConsistentHasher) RankInstances(objectKey string, n int) ([]string, error) {
+	if objectKey == "" {
+		return nil, fmt.Errorf("object id cannot be empty")
+	}
+
+	ch.mu.RLock()
+	ranked := append([]string(nil), ch.instances...)
+	scores := make(map[string]rendezvousScore, len(ranked))
+	for _, instance := range ranked {
+		scores[instance] = ch.score(objectKey, instance)
+	}
+	ch.mu.RUnlock()
+
+	if len(ranked) == 0 {
+		return nil, fmt.Errorf("no instances available")
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return scores[ranked[i]].greater(scores[ranked[j]])
+	})
+
+	if n < len(ranked) {
+		ranked = ranked[:n]
+	}
+	return ranked, nil
+}
+
 // UpdateInstances updates the list of available instances.
 // This should be called when instances are added or removed.
 func (ch *ConsistentHasher) UpdateInstances(instances []string) error {
+	return ch.UpdateWeightedInstances(instances, nil)
+}
+
+// UpdateWeightedInstances updates the instances together with their weights.
+// An instance with weight 2 receives about twice the objects of one with
+// weight 1; instances missing from weights, or with a weight below 1, count
+// as 1. Changing the weight of one instance only moves objects to or from
+// that instance.
+func (ch *ConsistentHasher) UpdateWeightedInstances(instances []string, weights map[string]int) error {
 	if len(instances) == 0 {
 		return fmt.Errorf("at least one instance is required")
 	}
 
 	sortedInstances := append([]string(nil), instances...)
 	sort.Strings(sortedInstances)
+
+	var kept map[string]int
+	for _, instance := range sortedInstances {
+		if weight := weights[instance]; weight > 1 {
+			if kept == nil {
+				kept = make(map[string]int)
+			}
+			kept[instance] = weight
+		}
+	}
+
+	ch.mu.Lock()
 	ch.instances = sortedInstances
+	ch.weights = kept
+	ch.mu.Unlock()
 	return nil
 }
 
+// Instances returns the sorted instance IDs.
+func (ch *ConsistentHasher) Instances() []string {
+	ch.mu.RLock()
+	defer ch.mu.RUnlock()
+
+	return append([]string(nil), ch.instances...)
+}
+
+// rendezvousScore orders instances for one object: weighted decides and
+// hash breaks ties.
+type rendezvousScore struct {
+	weighted float64
+	hash     uint64
+}
+
+func (s rendezvousScore) greater(other rendezvousScore) bool {
+	if s.weighted != other.weighted {
+		return s.weighted > other.weighted
+	}
+	return s.hash > other.hash
+}
+
+// score returns the score of instance for objectKey, weight / -ln(u) with u
+// in (0, 1) taken from the mixed hash since the high bits of FNV differ
+// little between instances. Every instance is scored this way, weighted or
+// not, so an instance's weight only changes how it compares to the others.
+// The caller holds ch.mu.
+func (ch *ConsistentHasher) score(objectKey, instance string) rendezvousScore {
+	score := rendezvousScore{hash: calculateRendezvousScore(objectKey, instance)}
+	u := (float64(mixHash(score.hash)>>11) + 0.5) / (1 << 53)
+	score.weighted = float64(max(ch.weights[instance], 1)) / -math.Log(u)
+	return score
+}
+
+// mixHash is the splitmix64 finalizer.
+func mixHash(h uint64) uint64 {
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
+
 func calculateRendezvousScore(objectKey, instance string) uint64 {
 	hasher := fnv.New64a()
 	_, _ = hasher.Write([]byte(objectKey))
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"fmt"
 	"testing"
 )
 
@@ -118,3 +119,144 @@ func TestConsistentHasher_IsOrderIndependent(t *testing.T) {
 		t.Fatalf("selection differs by instance ordering: %s vs %s", selectedA, selectedB)
 	}
 }
+
+func TestConsistentHasher_RankInstances(t *testing.T) {
+	instances := []string{"instance-1", "instance-2", "instance-3", "instance-4", "instance-5"}
+
+	hasher, err := NewConsistentHasher(instances)
+	if err != nil {
+		t.Fatalf("failed to create hasher: %v", err)
+	}
+
+	for _, objectKey := range []string{"object1", "object2", "object3"} {
+		ranked, err := hasher.RankInstances(objectKey, 3)
+		if err != nil {
+			t.Fatalf("RankInstances(%s) unexpected error: %v", objectKey, err)
+		}
+		if len(ranked) != 3 {
+			t.Fatalf("RankInstances(%s) returned %d instances, want 3", objectKey, len(ranked))
+		}
+
+		selected, _ := hasher.SelectInstance(objectKey)
+		if ranked[0] != selected {
+			t.Fatalf("RankInstances(%s)[0] = %s, want SelectInstance result %s", objectKey, ranked[0], selected)
+		}
+
+		seen := make(map[string]bool)
+		for _, instance := range ranked {
+			if seen[instance] {
+				t.Fatalf("RankInstances(%s) returned duplicate %s", objectKey, instance)
+			}
+			seen[instance] = true
+		}
+
+		// Removing a ranked instance keeps the relative order of the others.
+		reduced, _ := NewConsistentHasher(slicesWithout(instances, ranked[0]))
+		reranked, _ := reduced.RankInstances(objectKey, 2)
+		if reranked[0] != ranked[1] || reranked[1] != ranked[2] {
+			t.Fatalf("ranking after removal = %v, want prefix %v", reranked, ranked[1:])
+		}
+	}
+
+	all, _ := hasher.RankInstances("object1", 10)
+	if len(all) != len(instances) {
+		t.Fatalf("RankInstances() returned %d instances, want %d", len(all), len(instances))
+	}
+
+	if _, err := hasher.RankInstances("", 1); err == nil {
+		t.Fatal("expected error for empty object ID")
+	}
+}
+
+func TestConsistentHasher_Weights(t *testing.T) {
+	instances := []string{"instance-1", "instance-2", "instance-3"}
+	plain, _ := NewConsistentHasher(instances)
+
+	// Equal weights place objects like plain hashing.
+	equal, _ := NewConsistentHasher(instances)
+	if err := equal.UpdateWeightedInstances(instances, map[string]int{"instance-1": 4, "instance-2": 4, "instance-3": 4}); err != nil {
+		t.Fatalf("UpdateWeightedInstances() unexpected error: %v", err)
+	}
+
+	weighted, _ := NewConsistentHasher(instances)
+	if err := weighted.UpdateWeightedInstances(instances, map[string]int{"instance-1": 4}); err != nil {
+		t.Fatalf("UpdateWeightedInstances() unexpected error: %v", err)
+	}
+
+	counts := make(map[string]int)
+	const objects = 6000
+	for i := 0; i < objects; i++ {
+		objectKey := fmt.Sprintf("object%d", i)
+		want, _ := plain.SelectInstance(objectKey)
+		if got, _ := equal.SelectInstance(objectKey); got != want {
+			t.Fatalf("equal weights placed %s on %s, want %s", objectKey, got, want)
+		}
+		selected, _ := weighted.SelectInstance(objectKey)
+		counts[selected]++
+	}
+
+	// Weights 4:1:1 give the heavy instance about two thirds of the objects.
+	if share := float64(counts["instance-1"]) / objects; share < 0.6 || share > 0.73 {
+		t.Fatalf("weighted instance received %.2f of objects, want about 0.67 (counts %v)", share, counts)
+	}
+}
+
+func TestConsistentHasher_WeightChangeMovesOnlyItsObjects(t *testing.T) {
+	instances := []string{"instance-1", "instance-2", "instance-3", "instance-4"}
+	hasher, _ := NewConsistentHasher(instances)
+
+	const objects = 4000
+	owners := make(map[string]string, objects)
+	for i := 0; i < objects; i++ {
+		objectKey := fmt.Sprintf("object%d", i)
+		owners[objectKey], _ = hasher.SelectInstance(objectKey)
+	}
+
+	tests := []struct {
+		name    string
+		weights map[string]int
+		changed string
+		grows   bool
+	}{
+		{name: "raise one weight", weights: map[string]int{"instance-2": 3}, changed: "instance-2", grows: true},
+		{name: "lower it again", weights: nil, changed: "instance-2", grows: false},
+		{name: "raise the others", weights: map[string]int{"instance-1": 2, "instance-2": 2, "instance-4": 2}, changed: "instance-3", grows: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := hasher.UpdateWeightedInstances(instances, tt.weights); err != nil {
+				t.Fatalf("UpdateWeightedInstances() unexpected error: %v", err)
+			}
+
+			moved := 0
+			for objectKey, previous := range owners {
+				owner, _ := hasher.SelectInstance(objectKey)
+				if owner == previous {
+					continue
+				}
+				moved++
+				if tt.grows && owner != tt.changed {
+					t.Fatalf("%s moved from %s to %s, want moves only to %s", objectKey, previous, owner, tt.changed)
+				}
+				if !tt.grows && previous != tt.changed && owner != tt.changed {
+					t.Fatalf("%s moved from %s to %s, want moves only to or from %s", objectKey, previous, owner, tt.changed)
+				}
+				owners[objectKey] = owner
+			}
+			if moved == 0 {
+				t.Fatal("no object moved")
+			}
+		})
+	}
+}
+
+func slicesWithout(values []string, drop string) []string {
+	out := make([]string, 0, len(values))
+	for _, value := range values {
+		if value != drop {
+			out = append(out, value)
+		}
+	}
+	return out
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// defaultMaxKeyLength is the key length allowed by the strict default policy.
+	defaultMaxKeyLength = 32
+	// maxObjectKeyLength keeps object keys, including the internal prefixes
+	// of shards and blob references, within the 1024 byte S3 key limit.
+	maxObjectKeyLength = 896
+)
+
+// KeyPolicy describes which object keys the gateway accepts. Letters and
+// digits are always allowed; the other characters are opt-in. Keys never
+// start with a dot, which keeps them apart from internal entries such as
+// .dedup/ and .erasure/.
+type KeyPolicy struct {
+	// MaxLength is the maximum key length in bytes.
+	MaxLength int `json:"maxLength" yaml:"maxLength"`
+	// AllowSlashes permits hierarchical keys such as reports/2026/summary.
+	// Segments cannot be empty, ".", or "..".
+	AllowSlashes bool `json:"allowSlashes" yaml:"allowSlashes"`
+	// AllowDots permits '.' anywhere but at the start of the key.
+	AllowDots bool `json:"allowDots" yaml:"allowDots"`
+	// AllowDashes permits '-'.
+	AllowDashes bool `json:"allowDashes" yaml:"allowDashes"`
+	// AllowUnderscores permits '_'.
+	AllowUnderscores bool `json:"allowUnderscores" yaml:"allowUnderscores"`
+}
+
+// DefaultKeyPolicy returns the strict policy of 1-32 alphanumeric characters.
+func DefaultKeyPolicy() KeyPolicy {
+	return KeyPolicy{MaxLength: defaultMaxKeyLength}
+}
+
+func (p KeyPolicy) validate() error {
+	if p.MaxLength < 1 || p.MaxLength > maxObjectKeyLength {
+		return fmt.Errorf("key policy max length must be between 1 and %d", maxObjectKeyLength)
+	}
+	return nil
+}
+
+func (p KeyPolicy) allows(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	case c == '/':
+		return p.AllowSlashes
+	case c == '.':
+		return p.AllowDots
+	case c == '-':
+		return p.AllowDashes
+	case c == '_':
+		return p.AllowUnderscores
+	default:
+		return false
+	}
+}
+
+// describe names the allowed characters for error messages.
+func (p KeyPolicy) describe() string {
+	var extra []string
+	if p.AllowSlashes {
+		extra = append(extra, "slashes")
+	}
+	if p.AllowDots {
+		extra = append(extra, "dots")
+	}
+	if p.AllowDashes {
+		extra = append(extra, "dashes")
+	}
+	if p.AllowUnderscores {
+		extra = append(extra, "underscores")
+	}
+	if len(extra) == 0 {
+		return "alphanumeric characters"
+	}
+	return "letters, digits, " + strings.Join(extra, ", ")
+}
+
+// Validate checks objectKey against the policy.
+func (p KeyPolicy) Validate(objectKey string) error {
+	if len(objectKey) == 0 || len(objectKey) > p.MaxLength {
+		return fmt.Errorf("%w: expected 1-%d %s", ErrInvalidObjectID, p.MaxLength, p.describe())
+	}
+	for i := 0; i < len(objectKey); i++ {
+		if !p.allows(objectKey[i]) {
+			return fmt.Errorf("%w: expected 1-%d %s", ErrInvalidObjectID, p.MaxLength, p.describe())
+		}
+	}
+
+	if objectKey[0] == '.' {
+		return fmt.Errorf("%w: keys starting with a dot are reserved", ErrInvalidObjectID)
+	}
+	if p.AllowSlashes {
+		for _, segment := range strings.Split(objectKey, "/") {
+			if segment == "" || segment == "." || segment == ".." {
+				return fmt.Errorf("%w: path segments cannot be empty, \".\" or \"..\"", ErrInvalidObjectID)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ValidateObjectKey checks objectKey against the key policy of the gateway.
+func (g *Gateway) ValidateObjectKey(objectKey string) error {
+	return g.keys.Validate(objectKey)
+}
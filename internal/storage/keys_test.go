@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestKeyPolicyValidate(t *testing.T) {
+	relaxed := KeyPolicy{MaxLength: 64, AllowSlashes: true, AllowDots: true, AllowDashes: true, AllowUnderscores: true}
+
+	tests := []struct {
+		name      string
+		policy    KeyPolicy
+		objectKey string
+		wantErr   bool
+	}{
+		{name: "strict alphanumeric", policy: DefaultKeyPolicy(), objectKey: "abc123"},
+		{name: "strict rejects slash", policy: DefaultKeyPolicy(), objectKey: "reports/summary", wantErr: true},
+		{name: "strict rejects long key", policy: DefaultKeyPolicy(), objectKey: strings.Repeat("a", 33), wantErr: true},
+		{name: "hierarchical path", policy: relaxed, objectKey: "reports/2026/10/summary.json"},
+		{name: "dashes and underscores", policy: relaxed, objectKey: "build-42/app_v1.tar.gz"},
+		{name: "dot inside segment", policy: relaxed, objectKey: "a/.hidden"},
+		{name: "leading dot is reserved", policy: relaxed, objectKey: ".dedup/blobs/x", wantErr: true},
+		{name: "leading slash", policy: relaxed, objectKey: "/reports", wantErr: true},
+		{name: "trailing slash", policy: relaxed, objectKey: "reports/", wantErr: true},
+		{name: "empty segment", policy: relaxed, objectKey: "reports//summary", wantErr: true},
+		{name: "dot segment", policy: relaxed, objectKey: "reports/./summary", wantErr: true},
+		{name: "parent segment", policy: relaxed, objectKey: "reports/../summary", wantErr: true},
+		{name: "space", policy: relaxed, objectKey: "two words", wantErr: true},
+		{name: "over max length", policy: relaxed, objectKey: strings.Repeat("a", 65), wantErr: true},
+		{name: "slashes not enabled", policy: KeyPolicy{MaxLength: 64, AllowDots: true}, objectKey: "a/b.txt", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate(tt.objectKey)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidObjectID) {
+					t.Fatalf("Validate(%q) expected ErrInvalidObjectID, got %v", tt.objectKey, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Validate(%q) unexpected error: %v", tt.objectKey, err)
+			}
+		})
+	}
+}
+
+func TestGatewayHierarchicalKeys(t *testing.T) {
+	gateway, store := newTestGateway(t, WithKeyPolicy(KeyPolicy{MaxLength: 128, AllowSlashes: true, AllowDots: true}))
+	ctx := context.Background()
+
+	objectKey := "reports/2026/10/summary.json"
+	if _, err := gateway.PutObject(ctx, "", objectKey, strings.NewReader("{}"), 2, PutOptions{}); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if !store.hasObject(objectKey) {
+		t.Fatalf("object not stored under %q", objectKey)
+	}
+	if _, err := gateway.StatObject(ctx, "", objectKey, GetOptions{}); err != nil {
+		t.Fatalf("stat failed: %v", err)
+	}
+
+	if _, err := gateway.PutObject(ctx, "", "reports/with-dash", strings.NewReader("{}"), 2, PutOptions{}); !errors.Is(err, ErrInvalidObjectID) {
+		t.Fatalf("expected ErrInvalidObjectID, got %v", err)
+	}
+}
+
+func TestNewGatewayRejectsInvalidKeyPolicy(t *testing.T) {
+	for _, maxLength := range []int{0, maxObjectKeyLength + 1} {
+		if _, err := NewGateway(testInstances(1), WithKeyPolicy(KeyPolicy{MaxLength: maxLength})); err == nil {
+			t.Fatalf("expected max length %d to be rejected", maxLength)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package storage
 import (
 	"fmt"
 	"log"
+	"net"
 	"sync"
 
 	"github.com/irensaltali/object-storage-gateway/internal/discovery"
@@ -25,56 +26,69 @@ func NewMinioClientManager() *MinioClientManager {
 	}
 }
 
-// UpdateInstances updates the set of known Minio instances and creates clients.
+// UpdateInstances replaces the set of known Minio instances, creating clients
+// for new ones and for known ones whose address or credentials changed. The
+// clients are created before anything is replaced, so on error the previous
+// set stays in place, and requests still holding a replaced client finish
+// with it.
 func (mcm *MinioClientManager) UpdateInstances(instances []discovery.MinioInstance) error {
 	mcm.mu.Lock()
 	defer mcm.mu.Unlock()
 
 	log.Printf("Updating Minio instances: %d instances provided", len(instances))
 
-	// Close clients for removed instances
-	for id := range mcm.clients {
-		found := false
-		for _, inst := range instances {
-			if inst.ID == id {
-				found = true
-				break
-			}
-		}
-		if !found {
-			log.Printf("Removing client for instance %s (instance no longer exists)", id)
-			delete(mcm.clients, id)
-		}
-	}
-
-	// Create clients for new instances
+	clients := make(map[string]*minio.Client, len(instances))
+	known := make(map[string]discovery.MinioInstance, len(instances))
 	for _, inst := range instances {
-		if _, exists := mcm.clients[inst.ID]; !exists {
-			log.Printf("Creating new client for instance %s at %s:%s", inst.ID, inst.Host, inst.Port)
-			client, err := mcm.createClient(inst)
+		client, exists := mcm.clients[inst.ID]
+		if exists && !sameConnection(mcm.instances[inst.ID], inst) {
+			log.Printf("Rebuilding client for instance %s: address or credentials changed", inst.ID)
+			exists = false
+		}
+		if !exists {
+			log.Printf("Creating new client for instance %s at %s:%s (zone %q, tls %t)", inst.ID, inst.Host, inst.Port, inst.Zone, inst.Secure)
+			var err error
+			client, err = mcm.createClient(inst)
 			if err != nil {
 				log.Printf("Failed to create client for instance %s: %v", inst.ID, err)
 				return fmt.Errorf("failed to create client for instance %s: %w", inst.ID, err)
 			}
-			mcm.clients[inst.ID] = client
 			log.Printf("Successfully created client for instance %s", inst.ID)
 		}
 
-		mcm.instances[inst.ID] = inst
+		clients[inst.ID] = client
+		known[inst.ID] = inst
 	}
 
+	for id := range mcm.clients {
+		if _, kept := clients[id]; !kept {
+			log.Printf("Removing client for instance %s (instance no longer exists)", id)
+		}
+	}
+
+	mcm.clients = clients
+	mcm.instances = known
+
 	log.Printf("Minio instances updated: %d active clients", len(mcm.clients))
 	return nil
 }
 
+// sameConnection reports whether a client made for a can serve b.
+func sameConnection(a, b discovery.MinioInstance) bool {
+	return a.Host == b.Host && a.Port == b.Port && a.Secure == b.Secure &&
+		a.AccessKey == b.AccessKey && a.SecretKey == b.SecretKey
+}
+
 // createClient creates a Minio client for the given instance.
 func (mcm *MinioClientManager) createClient(inst discovery.MinioInstance) (*minio.Client, error) {
-	endpoint := fmt.Sprintf("%s:%s", inst.Host, inst.Port)
+	endpoint := net.JoinHostPort(inst.Host, inst.Port)
 	log.Printf("Creating Minio client for instance %s: endpoint=%s", inst.ID, endpoint)
 
 	client, err := minio.New(endpoint, &minio.Options{
 		Creds:  credentials.NewStaticV4(inst.AccessKey, inst.SecretKey, ""),
-		Secure: false,
+		Secure: inst.Secure,
+		// Trailing headers carry the SHA-256 computed while uploading.
+		TrailingHeaders: true,
 	})
 
 	if err != nil {
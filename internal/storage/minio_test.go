@@ -294,6 +294,78 @@ func TestMinioClientManager_UpdateInstancesWithInvalidClient(t *testing.T) {
 	_ = err
 }
 
+func TestMinioClientManager_UpdateInstancesReplacesSet(t *testing.T) {
+	mcm := NewMinioClientManager()
+	if err := mcm.UpdateInstances(testInstances(2)); err != nil {
+		t.Fatalf("UpdateInstances() unexpected error = %v", err)
+	}
+	kept, _ := mcm.GetClient("instance-1")
+
+	if err := mcm.UpdateInstances(testInstances(1)); err != nil {
+		t.Fatalf("UpdateInstances() unexpected error = %v", err)
+	}
+	if _, err := mcm.GetInstance("instance-2"); err == nil {
+		t.Error("removed instance is still known")
+	}
+	if _, err := mcm.GetClient("instance-2"); err == nil {
+		t.Error("removed instance still has a client")
+	}
+	if client, _ := mcm.GetClient("instance-1"); client != kept {
+		t.Error("client of a kept instance was recreated")
+	}
+
+	// A failing client leaves the previous set in place.
+	invalid := append(testInstances(1), discovery.MinioInstance{ID: "bad", Host: "not a host", Port: "9000", AccessKey: "a", SecretKey: "b"})
+	if err := mcm.UpdateInstances(invalid); err == nil {
+		t.Fatal("UpdateInstances() expected error for an invalid endpoint")
+	}
+	if _, err := mcm.GetInstance("bad"); err == nil {
+		t.Error("failed update was partly applied")
+	}
+	if _, err := mcm.GetClient("instance-1"); err != nil {
+		t.Errorf("failed update removed instance-1: %v", err)
+	}
+}
+
+func TestMinioClientManager_UpdateInstancesRebuildsChanged(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*discovery.MinioInstance)
+	}{
+		{name: "host", change: func(inst *discovery.MinioInstance) { inst.Host = "10.0.0.9" }},
+		{name: "port", change: func(inst *discovery.MinioInstance) { inst.Port = "9100" }},
+		{name: "secret key", change: func(inst *discovery.MinioInstance) { inst.SecretKey = "rotated" }},
+		{name: "tls", change: func(inst *discovery.MinioInstance) { inst.Secure = true }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mcm := NewMinioClientManager()
+			if err := mcm.UpdateInstances(testInstances(2)); err != nil {
+				t.Fatalf("UpdateInstances() unexpected error = %v", err)
+			}
+			stale, _ := mcm.GetClient("instance-1")
+			unchanged, _ := mcm.GetClient("instance-2")
+
+			instances := testInstances(2)
+			tt.change(&instances[0])
+			if err := mcm.UpdateInstances(instances); err != nil {
+				t.Fatalf("UpdateInstances() unexpected error = %v", err)
+			}
+
+			if client, _ := mcm.GetClient("instance-1"); client == stale {
+				t.Error("client of a changed instance was reused")
+			}
+			if client, _ := mcm.GetClient("instance-2"); client != unchanged {
+				t.Error("client of an unchanged instance was recreated")
+			}
+			if inst, _ := mcm.GetInstance("instance-1"); inst != instances[0] {
+				t.Errorf("instance = %+v, want %+v", inst, instances[0])
+			}
+		})
+	}
+}
+
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(substr) == 0 ||
 		(len(s) > len(substr) && (s[:len(substr)] == substr ||
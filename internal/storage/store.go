@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+const (
+	// streamingPartSize bounds the buffer minio-go allocates for uploads of unknown length.
+	streamingPartSize = 16 << 20
+	// maxSinglePutSize is the largest object S3 accepts in one PUT request.
+	maxSinglePutSize = 5 << 30
+)
+
+// objectStore is the subset of MinIO operations the gateway relies on.
+type objectStore interface {
+	BucketExists(ctx context.Context, bucketName string) (bool, error)
+	MakeBucket(ctx context.Context, bucketName string) error
+	RemoveBucket(ctx context.Context, bucketName string) error
+	ListBuckets(ctx context.Context) ([]string, error)
+	PutObject(ctx context.Context, bucketName, objectKey string, data io.Reader, size int64, opts storeObject) error
+	StatObject(ctx context.Context, bucketName, objectKey string) (storeObject, error)
+	GetObject(ctx context.Context, bucketName, objectKey string) (io.ReadCloser, error)
+	ReplaceMetadata(ctx context.Context, bucketName, objectKey string, opts storeObject) error
+	RemoveObject(ctx context.Context, bucketName, objectKey string) error
+	ListObjects(ctx context.Context, bucketName, prefix string) ([]storeObject, error)
+	PrefixEmpty(ctx context.Context, bucketName, prefix string) (bool, error)
+}
+
+// storeObject carries the backend attributes of a stored object.
+type storeObject struct {
+	Key         string
+	Size        int64
+	ETag        string
+	ContentType string
+	Metadata    map[string]string
+	// RecordSHA256 asks PutObject to have the backend keep the SHA-256 it
+	// computes while the body streams, which StatObject then reports as
+	// metaSHA256. The body must fit in a single PUT request.
+	RecordSHA256 bool
+}
+
+// minioStore adapts a MinIO client to objectStore.
+type minioStore struct {
+	client *minio.Client
+}
+
+func (s minioStore) BucketExists(ctx context.Context, bucketName string) (bool, error) {
+	return s.client.BucketExists(ctx, bucketName)
+}
+
+func (s minioStore) MakeBucket(ctx context.Context, bucketName string) error {
+	err := s.client.MakeBucket(ctx, bucketName, minio.MakeBucketOptions{})
+	if err != nil {
+		errResp := minio.ToErrorResponse(err)
+		if errResp.Code == "BucketAlreadyOwnedByYou" || errResp.Code == "BucketAlreadyExists" {
+			return nil
+		}
+	}
+	return err
+}
+
+// RemoveBucket removes an empty bucket. A missing bucket is not an error.
+func (s minioStore) RemoveBucket(ctx context.Context, bucketName string) error {
+	err := s.client.RemoveBucket(ctx, bucketName)
+	if err != nil {
+		switch minio.ToErrorResponse(err).Code {
+		case "NoSuchBucket":
+			return nil
+		case "BucketNotEmpty":
+			return fmt.Errorf("%w: %s", ErrBucketNotEmpty, bucketName)
+		}
+	}
+	return err
+}
+
+func (s minioStore) ListBuckets(ctx context.Context) ([]string, error) {
+	buckets, err := s.client.ListBuckets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(buckets))
+	for i, bucket := range buckets {
+		names[i] = bucket.Name
+	}
+	return names, nil
+}
+
+func (s minioStore) PutObject(ctx context.Context, bucketName, objectKey string, data io.Reader, size int64, opts storeObject) error {
+	putOpts := minio.PutObjectOptions{
+		ContentType:  opts.ContentType,
+		UserMetadata: opts.Metadata,
+	}
+	if size < 0 {
+		putOpts.PartSize = streamingPartSize
+	}
+	if opts.RecordSHA256 {
+		// A multipart upload would only keep a checksum of the part
+		// checksums, so the body goes up in one request with the digest
+		// sent as a trailer.
+		putOpts.Checksum = minio.ChecksumSHA256
+		putOpts.DisableMultipart = true
+	}
+
+	_, err := s.client.PutObject(ctx, bucketName, objectKey, data, size, putOpts)
+	return err
+}
+
+func (s minioStore) StatObject(ctx context.Context, bucketName, objectKey string) (storeObject, error) {
+	info, err := s.client.StatObject(ctx, bucketName, objectKey, minio.StatObjectOptions{Checksum: true})
+	if err != nil {
+		if isNotFoundError(err) {
+			return storeObject{}, fmt.Errorf("%w: %s", ErrObjectNotFound, objectKey)
+		}
+		return storeObject{}, err
+	}
+
+	metadata := info.UserMetadata
+	if metadata[metaSHA256] == "" {
+		if checksum, ok := recordedSHA256(info.ChecksumSHA256); ok {
+			if metadata == nil {
+				metadata = make(map[string]string, 1)
+			}
+			metadata[metaSHA256] = checksum
+		}
+	}
+
+	return storeObject{
+		Key:         info.Key,
+		Size:        info.Size,
+		ETag:        info.ETag,
+		ContentType: info.ContentType,
+		Metadata:    metadata,
+	}, nil
+}
+
+// recordedSHA256 converts a base64 SHA-256 checksum kept by the backend to
+// hex. Checksums of multipart uploads, suffixed with the part count, do not
+// cover the object bytes and are rejected.
+func recordedSHA256(checksum string) (string, bool) {
+	sum, err := base64.StdEncoding.DecodeString(checksum)
+	if err != nil || len(sum) != sha256.Size {
+		return "", false
+	}
+	return hex.EncodeToString(sum), true
+}
+
+func (s minioStore) GetObject(ctx context.Context, bucketName, objectKey string) (io.ReadCloser, error) {
+	return s.client.GetObject(ctx, bucketName, objectKey, minio.GetObjectOptions{})
+}
+
+// ReplaceMetadata rewrites the content type and user metadata of an existing
+// object with a server-side copy onto itself.
+func (s minioStore) ReplaceMetadata(ctx context.Context, bucketName, objectKey string, opts storeObject) error {
+	_, err := s.client.CopyObject(ctx,
+		minio.CopyDestOptions{
+			Bucket:          bucketName,
+			Object:          objectKey,
+			ContentType:     opts.ContentType,
+			UserMetadata:    opts.Metadata,
+			ReplaceMetadata: true,
+		},
+		minio.CopySrcOptions{Bucket: bucketName, Object: objectKey},
+	)
+	return err
+}
+
+func (s minioStore) RemoveObject(ctx context.Context, bucketName, objectKey string) error {
+	return s.client.RemoveObject(ctx, bucketName, objectKey, minio.RemoveObjectOptions{})
+}
+
+// ListObjects returns every object under prefix. A missing bucket lists as empty.
+func (s minioStore) ListObjects(ctx context.Context, bucketName, prefix string) ([]storeObject, error) {
+	var objects []storeObject
+	listOpts := minio.ListObjectsOptions{Prefix: prefix, Recursive: true, WithMetadata: true}
+	for info := range s.client.ListObjects(ctx, bucketName, listOpts) {
+		if info.Err != nil {
+			if isNotFoundError(info.Err) {
+				return nil, nil
+			}
+			return nil, info.Err
+		}
+		objects = append(objects, storeObject{
+			Key:         info.Key,
+			Size:        info.Size,
+			ETag:        info.ETag,
+			ContentType: info.ContentType,
+			Metadata:    listedMetadata(info.UserMetadata),
+		})
+	}
+
+	return objects, nil
+}
+
+// PrefixEmpty reports whether bucketName holds no objects under prefix,
+// listing at most one. A missing bucket is empty.
+func (s minioStore) PrefixEmpty(ctx context.Context, bucketName, prefix string) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	listOpts := minio.ListObjectsOptions{Prefix: prefix, Recursive: true, MaxKeys: 1}
+	for info := range s.client.ListObjects(ctx, bucketName, listOpts) {
+		if info.Err != nil {
+			if isNotFoundError(info.Err) {
+				return true, nil
+			}
+			return false, info.Err
+		}
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// listedMetadata normalizes listing metadata, which MinIO returns with the
+// X-Amz-Meta- prefix, to the keys StatObject reports.
+func listedMetadata(raw minio.StringMap) map[string]string {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	metadata := make(map[string]string, len(raw))
+	for key, value := range raw {
+		canonical := textproto.CanonicalMIMEHeaderKey(key)
+		if name, ok := strings.CutPrefix(canonical, "X-Amz-Meta-"); ok {
+			metadata[name] = value
+		}
+	}
+	return metadata
+}
+
+func isNotFoundError(err error) bool {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NoSuchBucket", "NoSuchObject":
+		return true
+	default:
+		return false
+	}
+}
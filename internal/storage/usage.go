@@ -0,0 +1,443 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// metaTenant is the metadata key naming the tenant an object is charged to.
+	metaTenant = "Gateway-Tenant"
+	// defaultTenant is charged for objects without a tenant identity.
+	defaultTenant = "default"
+)
+
+// Quota limits stored bytes and objects. Zero values mean unlimited.
+type Quota struct {
+	MaxBytes   int64 `json:"maxBytes" yaml:"maxBytes"`
+	MaxObjects int64 `json:"maxObjects" yaml:"maxObjects"`
+}
+
+// QuotaConfig configures usage tracking and the quotas enforced on uploads.
+type QuotaConfig struct {
+	// Tenant is the quota of every tenant without an entry in Tenants.
+	Tenant Quota `json:"tenant" yaml:"tenant"`
+	// Tenants overrides Tenant per tenant.
+	Tenants map[string]Quota `json:"tenants" yaml:"tenants"`
+	// Instance limits the physical bytes and objects stored on each instance.
+	Instance Quota `json:"instance" yaml:"instance"`
+	// TenantPrefixLength charges uploads without a tenant identity to the
+	// first TenantPrefixLength characters of the object ID.
+	TenantPrefixLength int `json:"tenantPrefixLength" yaml:"tenantPrefixLength"`
+}
+
+// Usage is the stored volume of a tenant or instance.
+type Usage struct {
+	Bytes   int64 `json:"bytes"`
+	Objects int64 `json:"objects"`
+	Quota   Quota `json:"quota"`
+}
+
+// UsageReport lists usage per tenant and per instance.
+type UsageReport struct {
+	Enabled   bool             `json:"enabled"`
+	Tenants   map[string]Usage `json:"tenants,omitempty"`
+	Instances map[string]Usage `json:"instances,omitempty"`
+}
+
+type usageCounter struct {
+	bytes   int64
+	objects int64
+}
+
+// usageTracker keeps running totals of logical bytes per tenant and physical
+// bytes per instance. Writes reserve their growth before touching a backend so
+// concurrent uploads cannot overshoot a quota together.
+type usageTracker struct {
+	cfg QuotaConfig
+
+	mu        sync.Mutex
+	tenants   map[string]*usageCounter
+	instances map[string]*usageCounter
+}
+
+func newUsageTracker(cfg QuotaConfig) *usageTracker {
+	return &usageTracker{
+		cfg:       cfg,
+		tenants:   make(map[string]*usageCounter),
+		instances: make(map[string]*usageCounter),
+	}
+}
+
+// tenantFor returns the tenant charged for objectKey.
+func (u *usageTracker) tenantFor(objectKey, identity string) string {
+	if identity = strings.TrimSpace(identity); identity != "" {
+		return identity
+	}
+	if n := u.cfg.TenantPrefixLength; n > 0 && len(objectKey) >= n {
+		return objectKey[:n]
+	}
+	return defaultTenant
+}
+
+func (u *usageTracker) tenantQuota(tenant string) Quota {
+	if quota, ok := u.cfg.Tenants[tenant]; ok {
+		return quota
+	}
+	return u.cfg.Tenant
+}
+
+// reserve adds the deltas to the counter of name unless that takes it over
+// quota. Shrinking is always allowed.
+func reserve(counters map[string]*usageCounter, name string, quota Quota, bytes, objects int64) error {
+	counter, ok := counters[name]
+	if !ok {
+		counter = &usageCounter{}
+		counters[name] = counter
+	}
+
+	if bytes > 0 && quota.MaxBytes > 0 && counter.bytes+bytes > quota.MaxBytes {
+		return fmt.Errorf("%w: %s would store %d of %d bytes", ErrQuotaExceeded, name, counter.bytes+bytes, quota.MaxBytes)
+	}
+	if objects > 0 && quota.MaxObjects > 0 && counter.objects+objects > quota.MaxObjects {
+		return fmt.Errorf("%w: %s would store %d of %d objects", ErrQuotaExceeded, name, counter.objects+objects, quota.MaxObjects)
+	}
+
+	counter.bytes += bytes
+	counter.objects += objects
+	return nil
+}
+
+func (u *usageTracker) reserveTenant(tenant string, bytes, objects int64) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return reserve(u.tenants, "tenant "+tenant, u.tenantQuota(tenant), bytes, objects)
+}
+
+func (u *usageTracker) adjustTenant(tenant string, bytes, objects int64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	reserve(u.tenants, "tenant "+tenant, Quota{}, bytes, objects)
+}
+
+func (u *usageTracker) reserveInstance(instanceID string, bytes, objects int64) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return reserve(u.instances, "instance "+instanceID, u.cfg.Instance, bytes, objects)
+}
+
+func (u *usageTracker) adjustInstance(instanceID string, bytes, objects int64) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	reserve(u.instances, "instance "+instanceID, Quota{}, bytes, objects)
+}
+
+func (u *usageTracker) report() UsageReport {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	report := UsageReport{
+		Enabled:   true,
+		Tenants:   make(map[string]Usage, len(u.tenants)),
+		Instances: make(map[string]Usage, len(u.instances)),
+	}
+	for name, counter := range u.tenants {
+		tenant := strings.TrimPrefix(name, "tenant ")
+		report.Tenants[tenant] = Usage{Bytes: counter.bytes, Objects: counter.objects, Quota: u.tenantQuota(tenant)}
+	}
+	for name, counter := range u.instances {
+		report.Instances[strings.TrimPrefix(name, "instance ")] = Usage{Bytes: counter.bytes, Objects: counter.objects, Quota: u.cfg.Instance}
+	}
+	return report
+}
+
+// reset replaces all counters, used when rebuilding from listings.
+func (u *usageTracker) reset(tenants, instances map[string]*usageCounter) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.tenants = make(map[string]*usageCounter, len(tenants))
+	for tenant, counter := range tenants {
+		u.tenants["tenant "+tenant] = counter
+	}
+	u.instances = make(map[string]*usageCounter, len(instances))
+	for instanceID, counter := range instances {
+		u.instances["instance "+instanceID] = counter
+	}
+}
+
+// logicalSize returns the size of the original object bytes behind a stored entry.
+func logicalSize(stat storeObject) int64 {
+	if size, err := strconv.ParseInt(stat.Metadata[metaOriginalSize], 10, 64); err == nil {
+		return size
+	}
+	return stat.Size
+}
+
+// Usage reports stored bytes and objects per tenant and per instance.
+func (g *Gateway) Usage() UsageReport {
+	if g.usage == nil {
+		return UsageReport{}
+	}
+	return g.usage.report()
+}
+
+// RebuildUsage recomputes every usage counter from the object listings of
+// all instances, replacing the running totals.
+func (g *Gateway) RebuildUsage(ctx context.Context) error {
+	if g.usage == nil {
+		return nil
+	}
+
+	tenants := make(map[string]*usageCounter)
+	instances := make(map[string]*usageCounter)
+	for _, instanceID := range g.hasher.Instances() {
+		store, err := g.storeFor(instanceID)
+		if err != nil {
+			return err
+		}
+		buckets, err := store.ListBuckets(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list buckets on instance %s: %w", instanceID, err)
+		}
+
+		var objects []storeObject
+		for _, bucketName := range buckets {
+			listed, err := store.ListObjects(ctx, bucketName, "")
+			if err != nil {
+				return fmt.Errorf("failed to list objects in bucket %q on instance %s: %w", bucketName, instanceID, err)
+			}
+			objects = append(objects, listed...)
+		}
+
+		instance := &usageCounter{}
+		instances[instanceID] = instance
+		for _, object := range objects {
+			instance.bytes += object.Size
+			instance.objects++
+
+			// Internal entries are charged through the objects pointing at
+			// them, and erasure manifests only count on their owner.
+			if strings.HasPrefix(object.Key, ".") {
+				continue
+			}
+			if owner, err := g.hasher.SelectInstance(object.Key); err != nil || owner != instanceID {
+				continue
+			}
+
+			tenant := object.Metadata[metaTenant]
+			if tenant == "" {
+				tenant = g.usage.tenantFor(object.Key, "")
+			}
+			counter, ok := tenants[tenant]
+			if !ok {
+				counter = &usageCounter{}
+				tenants[tenant] = counter
+			}
+			counter.bytes += logicalSize(object)
+			counter.objects++
+		}
+	}
+
+	g.usage.reset(tenants, instances)
+	log.Printf("rebuilt usage counters for %d tenant(s) on %d instance(s)", len(tenants), len(instances))
+	return nil
+}
+
+// chargeUpload reserves tenant usage for an upload of size bytes to objectKey
+// in bucketName and returns the tenant and a function settling the
+// reservation once the upload has succeeded or failed.
+func (g *Gateway) chargeUpload(ctx context.Context, bucketName, objectKey string, size int64, identity string) (string, func(stored bool), error) {
+	tenant := g.usage.tenantFor(objectKey, identity)
+
+	previous, exists, err := g.statEntry(ctx, bucketName, objectKey)
+	if err != nil {
+		return "", nil, err
+	}
+	previousTenant, previousSize := "", int64(0)
+	if exists {
+		previousTenant = previous.Metadata[metaTenant]
+		if previousTenant == "" {
+			previousTenant = g.usage.tenantFor(objectKey, "")
+		}
+		previousSize = logicalSize(previous)
+	}
+
+	bytes, objects := size, int64(1)
+	if exists && previousTenant == tenant {
+		bytes, objects = size-previousSize, 0
+	}
+	if err := g.usage.reserveTenant(tenant, bytes, objects); err != nil {
+		return "", nil, err
+	}
+
+	settle := func(stored bool) {
+		if !stored {
+			g.usage.adjustTenant(tenant, -bytes, -objects)
+			return
+		}
+		if exists && previousTenant != tenant {
+			g.usage.adjustTenant(previousTenant, -previousSize, -1)
+		}
+	}
+	return tenant, settle, nil
+}
+
+// releaseObject credits the tenant of a deleted object.
+func (g *Gateway) releaseObject(stat storeObject, objectKey string) {
+	tenant := stat.Metadata[metaTenant]
+	if tenant == "" {
+		tenant = g.usage.tenantFor(objectKey, "")
+	}
+	g.usage.adjustTenant(tenant, -logicalSize(stat), -1)
+}
+
+// statEntry stats the entry stored under objectKey on its owner, or on a
+// manifest replica with erasure coding, without following it.
+func (g *Gateway) statEntry(ctx context.Context, bucketName, objectKey string) (storeObject, bool, error) {
+	store, err := g.selectStore(objectKey)
+	var stat storeObject
+	if err == nil {
+		stat, err = store.StatObject(ctx, bucketName, objectKey)
+	}
+	if err == nil {
+		return stat, true, nil
+	}
+
+	if g.erasure.enabled() {
+		if _, replicaStat, ok := g.statManifestReplica(ctx, bucketName, objectKey); ok {
+			return replicaStat, true, nil
+		}
+	}
+	if errors.Is(err, ErrObjectNotFound) {
+		return storeObject{}, false, nil
+	}
+	return storeObject{}, false, fmt.Errorf("failed to stat object: %w", err)
+}
+
+type entryCacheKey struct{}
+
+// entryCache remembers, for the duration of one write or delete, the size of
+// what each instance stores under the keys the operation touched. It lets
+// meteredStore settle usage from the stat the gateway made anyway, which is
+// only sound while the gateway holds the object's lock.
+type entryCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedEntry
+}
+
+type cachedEntry struct {
+	size   int64
+	exists bool
+}
+
+func withEntryCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, entryCacheKey{}, &entryCache{entries: make(map[string]cachedEntry)})
+}
+
+// meteredStore charges the writes and removals of one instance to its usage
+// counter and enforces the instance quota.
+type meteredStore struct {
+	objectStore
+	instanceID string
+	usage      *usageTracker
+}
+
+func (m meteredStore) remember(ctx context.Context, bucketName, objectKey string, entry cachedEntry) {
+	if cache, ok := ctx.Value(entryCacheKey{}).(*entryCache); ok {
+		cache.mu.Lock()
+		cache.entries[m.instanceID+"\x00"+objectPath(bucketName, objectKey)] = entry
+		cache.mu.Unlock()
+	}
+}
+
+// previous returns what the instance stores under objectKey, from the entry
+// cache of ctx when the operation has already looked.
+func (m meteredStore) previous(ctx context.Context, bucketName, objectKey string) (cachedEntry, error) {
+	if cache, ok := ctx.Value(entryCacheKey{}).(*entryCache); ok {
+		cache.mu.Lock()
+		entry, found := cache.entries[m.instanceID+"\x00"+objectPath(bucketName, objectKey)]
+		cache.mu.Unlock()
+		if found {
+			return entry, nil
+		}
+	}
+
+	stat, err := m.StatObject(ctx, bucketName, objectKey)
+	if err == nil {
+		return cachedEntry{size: stat.Size, exists: true}, nil
+	}
+	if errors.Is(err, ErrObjectNotFound) {
+		return cachedEntry{}, nil
+	}
+	return cachedEntry{}, err
+}
+
+func (m meteredStore) StatObject(ctx context.Context, bucketName, objectKey string) (storeObject, error) {
+	stat, err := m.objectStore.StatObject(ctx, bucketName, objectKey)
+	if err == nil {
+		m.remember(ctx, bucketName, objectKey, cachedEntry{size: stat.Size, exists: true})
+	} else if errors.Is(err, ErrObjectNotFound) {
+		m.remember(ctx, bucketName, objectKey, cachedEntry{})
+	}
+	return stat, err
+}
+
+func (m meteredStore) PutObject(ctx context.Context, bucketName, objectKey string, data io.Reader, size int64, opts storeObject) error {
+	previous, err := m.previous(ctx, bucketName, objectKey)
+	if err != nil {
+		return err
+	}
+	previousSize, objects := int64(0), int64(1)
+	if previous.exists {
+		previousSize, objects = previous.size, 0
+	}
+
+	// Uploads of unknown length are charged once their size is known.
+	reserved := int64(0)
+	if size >= 0 {
+		reserved = size - previousSize
+	}
+	if err := m.usage.reserveInstance(m.instanceID, reserved, objects); err != nil {
+		return err
+	}
+
+	counter := &countingReader{r: data}
+	if err := m.objectStore.PutObject(ctx, bucketName, objectKey, counter, size, opts); err != nil {
+		m.usage.adjustInstance(m.instanceID, -reserved, -objects)
+		return err
+	}
+
+	m.usage.adjustInstance(m.instanceID, counter.n-previousSize-reserved, 0)
+	m.remember(ctx, bucketName, objectKey, cachedEntry{size: counter.n, exists: true})
+	return nil
+}
+
+func (m meteredStore) RemoveObject(ctx context.Context, bucketName, objectKey string) error {
+	previous, previousErr := m.previous(ctx, bucketName, objectKey)
+	if err := m.objectStore.RemoveObject(ctx, bucketName, objectKey); err != nil {
+		return err
+	}
+	if previousErr == nil && previous.exists {
+		m.usage.adjustInstance(m.instanceID, -previous.size, -1)
+	}
+	m.remember(ctx, bucketName, objectKey, cachedEntry{})
+	return nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
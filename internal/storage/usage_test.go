@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGatewayTenantQuota(t *testing.T) {
+	gateway, _ := newTestGateway(t, WithQuotas(QuotaConfig{
+		Tenant:  Quota{MaxBytes: 10, MaxObjects: 2},
+		Tenants: map[string]Quota{"big": {MaxBytes: 100}},
+	}))
+	ctx := context.Background()
+
+	put := func(objectKey, data, tenant string) error {
+		_, err := gateway.PutObject(ctx, "", objectKey, strings.NewReader(data), int64(len(data)), PutOptions{Tenant: tenant})
+		return err
+	}
+
+	if err := put("object1", "123456", "team"); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if err := put("object2", "12345", "team"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded over the byte quota, got %v", err)
+	}
+
+	// Overwrites are charged by their growth only.
+	if err := put("object1", "1234567890", "team"); err != nil {
+		t.Fatalf("overwrite failed: %v", err)
+	}
+	if err := put("object1", "1", "team"); err != nil {
+		t.Fatalf("shrinking overwrite failed: %v", err)
+	}
+	if err := put("object2", "1", "team"); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if err := put("object3", "1", "team"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded over the object quota, got %v", err)
+	}
+
+	if err := put("object3", strings.Repeat("x", 50), "big"); err != nil {
+		t.Fatalf("put within tenant override failed: %v", err)
+	}
+
+	if err := gateway.DeleteObject(ctx, "", "object1"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+
+	report := gateway.Usage()
+	if got := report.Tenants["team"]; got.Bytes != 1 || got.Objects != 1 || got.Quota.MaxBytes != 10 {
+		t.Fatalf("unexpected usage for team: %+v", got)
+	}
+	if got := report.Tenants["big"]; got.Bytes != 50 || got.Objects != 1 || got.Quota.MaxBytes != 100 {
+		t.Fatalf("unexpected usage for big: %+v", got)
+	}
+}
+
+func TestGatewayUsageConcurrentOverwrite(t *testing.T) {
+	gateway, store := newTestGateway(t, WithQuotas(QuotaConfig{}))
+	store.statDelay = time.Millisecond
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data := strings.Repeat("x", i+1)
+			if _, err := gateway.PutObject(ctx, "", "object1", strings.NewReader(data), int64(len(data)), PutOptions{Tenant: "team"}); err != nil {
+				t.Errorf("PutObject() unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	stored := int64(len(store.object("object1").data))
+	report := gateway.Usage()
+	if got := report.Tenants["team"]; got.Objects != 1 || got.Bytes != stored {
+		t.Fatalf("team usage = %+v, want 1 object of %d bytes", got, stored)
+	}
+	var objects, bytes int64
+	for _, usage := range report.Instances {
+		objects += usage.Objects
+		bytes += usage.Bytes
+	}
+	if objects != 1 || bytes != stored {
+		t.Fatalf("instance usage = %d object(s) of %d bytes, want 1 of %d", objects, bytes, stored)
+	}
+}
+
+func TestGatewayUsageStatsOnce(t *testing.T) {
+	gateway, store := newTestGateway(t, WithQuotas(QuotaConfig{}))
+	ctx := context.Background()
+
+	for _, data := range []string{"first", "second"} {
+		store.stats = 0
+		if _, err := gateway.PutObject(ctx, "", "object1", strings.NewReader(data), int64(len(data)), PutOptions{}); err != nil {
+			t.Fatalf("PutObject() unexpected error: %v", err)
+		}
+		if store.stats != 1 {
+			t.Fatalf("PutObject() made %d stat(s), want 1", store.stats)
+		}
+	}
+
+	store.stats = 0
+	if err := gateway.DeleteObject(ctx, "", "object1"); err != nil {
+		t.Fatalf("DeleteObject() unexpected error: %v", err)
+	}
+	if store.stats != 1 {
+		t.Fatalf("DeleteObject() made %d stat(s), want 1", store.stats)
+	}
+	if got := gateway.Usage().Tenants[defaultTenant]; got.Objects != 0 || got.Bytes != 0 {
+		t.Fatalf("usage after delete = %+v, want none", got)
+	}
+}
+
+func TestGatewayTenantFromKeyPrefix(t *testing.T) {
+	gateway, _ := newTestGateway(t, WithQuotas(QuotaConfig{TenantPrefixLength: 3}))
+
+	for _, objectKey := range []string{"abc1", "abc2", "xyz1", "a"} {
+		if _, err := gateway.PutObject(context.Background(), "", objectKey, strings.NewReader("data"), 4, PutOptions{}); err != nil {
+			t.Fatalf("put %s failed: %v", objectKey, err)
+		}
+	}
+
+	report := gateway.Usage()
+	want := map[string]int64{"abc": 2, "xyz": 1, defaultTenant: 1}
+	for tenant, objects := range want {
+		if got := report.Tenants[tenant].Objects; got != objects {
+			t.Fatalf("tenant %s has %d objects, want %d", tenant, got, objects)
+		}
+	}
+}
+
+func TestGatewayInstanceQuota(t *testing.T) {
+	gateway, _ := newTestGateway(t, WithQuotas(QuotaConfig{Instance: Quota{MaxBytes: 8}}))
+	ctx := context.Background()
+
+	if _, err := gateway.PutObject(ctx, "", "object1", strings.NewReader("12345678"), 8, PutOptions{}); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+
+	owner, err := gateway.hasher.SelectInstance("object1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := gateway.Usage().Instances[owner]; got.Bytes != 8 || got.Objects != 1 {
+		t.Fatalf("unexpected usage for %s: %+v", owner, got)
+	}
+
+	// Any other key landing on the same full instance is rejected.
+	for _, objectKey := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		instanceID, _ := gateway.hasher.SelectInstance(objectKey)
+		if instanceID != owner {
+			continue
+		}
+		_, err := gateway.PutObject(ctx, "", objectKey, strings.NewReader("1"), 1, PutOptions{})
+		if !errors.Is(err, ErrQuotaExceeded) {
+			t.Fatalf("expected ErrQuotaExceeded on full instance, got %v", err)
+		}
+		return
+	}
+	t.Fatal("no test key maps to the owner instance")
+}
+
+func TestGatewayRebuildUsage(t *testing.T) {
+	gateway, stores, _ := newErasureTestGateway(t, 3, 2, 1)
+	gateway.usage = newUsageTracker(QuotaConfig{})
+	ctx := context.Background()
+
+	if _, err := gateway.PutObject(ctx, "", "object1", strings.NewReader("payload"), 7, PutOptions{Tenant: "team"}); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if _, err := gateway.PutObject(ctx, "", "object2", strings.NewReader("more"), 4, PutOptions{}); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	live := gateway.Usage()
+
+	gateway.usage = newUsageTracker(QuotaConfig{})
+	if err := gateway.RebuildUsage(ctx); err != nil {
+		t.Fatalf("rebuild failed: %v", err)
+	}
+	rebuilt := gateway.Usage()
+
+	for tenant, usage := range live.Tenants {
+		if got := rebuilt.Tenants[tenant]; got.Bytes != usage.Bytes || got.Objects != usage.Objects {
+			t.Fatalf("tenant %s rebuilt as %+v, live %+v", tenant, got, usage)
+		}
+	}
+	if rebuilt.Tenants["team"].Bytes != 7 || rebuilt.Tenants[defaultTenant].Bytes != 4 {
+		t.Fatalf("unexpected tenants %+v", rebuilt.Tenants)
+	}
+
+	for instanceID, store := range stores {
+		objects, _ := store.ListObjects(ctx, defaultBucketName, "")
+		var bytes int64
+		for _, object := range objects {
+			bytes += object.Size
+		}
+		got := rebuilt.Instances[instanceID]
+		if got.Bytes != bytes || got.Objects != int64(len(objects)) {
+			t.Fatalf("instance %s rebuilt as %+v, stores %d objects with %d bytes", instanceID, got, len(objects), bytes)
+		}
+		if live := live.Instances[instanceID]; live.Bytes != got.Bytes || live.Objects != got.Objects {
+			t.Fatalf("instance %s tracked as %+v, rebuilt as %+v", instanceID, live, got)
+		}
+	}
+}
+
+func TestGatewayUsageDisabled(t *testing.T) {
+	gateway, _ := newTestGateway(t)
+
+	if report := gateway.Usage(); report.Enabled {
+		t.Fatalf("expected usage tracking to be disabled, got %+v", report)
+	}
+	if err := gateway.RebuildUsage(context.Background()); err != nil {
+		t.Fatalf("rebuild failed: %v", err)
+	}
+}
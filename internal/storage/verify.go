@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+)
+
+// metaSHA256 is the metadata key holding the hex SHA-256 of the original object bytes.
+const metaSHA256 = "Gateway-Sha256"
+
+// verifyingReader hashes an upload while it streams, counts its bytes against
+// the declared size and checks the client supplied digests once that size has
+// been read. The final chunk is withheld on any failure so the backend never
+// receives a complete object.
+type verifyingReader struct {
+	r          io.Reader
+	size       int64
+	remaining  int64
+	sha256     hash.Hash
+	md5        hash.Hash
+	wantSHA256 []byte
+	wantMD5    []byte
+	checked    bool
+	err        error
+}
+
+// newVerifyingReader wraps data of the given size. contentMD5 is the base64
+// Content-MD5 header value and checksumSHA256 a hex SHA-256 digest; either may
+// be empty.
+func newVerifyingReader(data io.Reader, size int64, contentMD5, checksumSHA256 string) (*verifyingReader, error) {
+	v := &verifyingReader{
+		r:         data,
+		size:      size,
+		remaining: size,
+		sha256:    sha256.New(),
+	}
+
+	if contentMD5 = strings.TrimSpace(contentMD5); contentMD5 != "" {
+		digest, err := base64.StdEncoding.DecodeString(contentMD5)
+		if err != nil || len(digest) != md5.Size {
+			return nil, fmt.Errorf("%w: malformed Content-MD5", ErrInvalidChecksum)
+		}
+		v.md5 = md5.New()
+		v.wantMD5 = digest
+	}
+
+	if checksumSHA256 = strings.TrimSpace(checksumSHA256); checksumSHA256 != "" {
+		digest, err := hex.DecodeString(checksumSHA256)
+		if err != nil || len(digest) != sha256.Size {
+			return nil, fmt.Errorf("%w: malformed SHA-256 checksum", ErrInvalidChecksum)
+		}
+		v.wantSHA256 = digest
+	}
+
+	return v, nil
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	if v.err != nil {
+		return 0, v.err
+	}
+	if v.checked {
+		return 0, io.EOF
+	}
+
+	var n int
+	var err error
+	if v.remaining > 0 {
+		if int64(len(p)) > v.remaining {
+			p = p[:v.remaining]
+		}
+		n, err = v.r.Read(p)
+		v.sha256.Write(p[:n])
+		if v.md5 != nil {
+			v.md5.Write(p[:n])
+		}
+		v.remaining -= int64(n)
+	}
+
+	if v.remaining > 0 {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			v.err = fmt.Errorf("%w: received %d of %d bytes", ErrIncompleteUpload, v.size-v.remaining, v.size)
+			return 0, v.err
+		}
+		if err != nil {
+			v.err = err
+			return 0, err
+		}
+		return n, nil
+	}
+
+	// All declared bytes have arrived: make sure nothing follows them before
+	// the digests are checked and the last chunk is released.
+	if err == nil {
+		err = v.expectEOF()
+	}
+	if err != io.EOF {
+		v.err = err
+		return 0, err
+	}
+	if err := v.check(); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// expectEOF returns io.EOF when the underlying reader holds no more data.
+func (v *verifyingReader) expectEOF() error {
+	var probe [1]byte
+	n, err := io.ReadFull(v.r, probe[:])
+	if n > 0 {
+		return fmt.Errorf("%w: received more than the declared %d bytes", ErrIncompleteUpload, v.size)
+	}
+	return err
+}
+
+// check compares the digests of everything read so far with the expected ones.
+func (v *verifyingReader) check() error {
+	v.checked = true
+
+	if v.wantMD5 != nil && !bytes.Equal(v.md5.Sum(nil), v.wantMD5) {
+		v.err = fmt.Errorf("%w: Content-MD5 does not match uploaded data", ErrChecksumMismatch)
+		return v.err
+	}
+	if v.wantSHA256 != nil && !bytes.Equal(v.sha256.Sum(nil), v.wantSHA256) {
+		v.err = fmt.Errorf("%w: SHA-256 does not match uploaded data", ErrChecksumMismatch)
+		return v.err
+	}
+
+	return nil
+}
+
+// sha256Hex returns the hex SHA-256 of the data read so far.
+func (v *verifyingReader) sha256Hex() string {
+	return hex.EncodeToString(v.sha256.Sum(nil))
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestVerifyingReader(t *testing.T) {
+	payload := "hello, world"
+	sum := sha256.Sum256([]byte(payload))
+	wantSHA256 := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name     string
+		checksum string
+		wantErr  error
+	}{
+		{name: "matching digest", checksum: wantSHA256},
+		{name: "no digest"},
+		{name: "mismatched digest", checksum: strings.Repeat("ab", sha256.Size), wantErr: ErrChecksumMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier, err := newVerifyingReader(iotest.OneByteReader(strings.NewReader(payload)), int64(len(payload)), "", tt.checksum)
+			if err != nil {
+				t.Fatalf("newVerifyingReader() unexpected error: %v", err)
+			}
+
+			body, err := io.ReadAll(verifier)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ReadAll() error = %v, want %v", err, tt.wantErr)
+				}
+				if len(body) >= len(payload) {
+					t.Fatalf("read %d bytes, want the final chunk withheld", len(body))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadAll() unexpected error: %v", err)
+			}
+			if string(body) != payload {
+				t.Fatalf("body = %q, want %q", body, payload)
+			}
+			if verifier.sha256Hex() != wantSHA256 {
+				t.Fatalf("sha256Hex() = %q, want %q", verifier.sha256Hex(), wantSHA256)
+			}
+		})
+	}
+}
+
+func TestVerifyingReader_ReadFullSeesMismatch(t *testing.T) {
+	payload := "exact length"
+	verifier, err := newVerifyingReader(strings.NewReader(payload), int64(len(payload)), "", strings.Repeat("0", 64))
+	if err != nil {
+		t.Fatalf("newVerifyingReader() unexpected error: %v", err)
+	}
+
+	buf := make([]byte, len(payload))
+	if _, err := io.ReadFull(verifier, buf); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("ReadFull() error = %v, want ErrChecksumMismatch", err)
+	}
+}
+
+func TestVerifyingReader_SizeMismatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    io.Reader
+		size    int64
+		wantErr string
+	}{
+		{name: "truncated", data: strings.NewReader("short"), size: 10, wantErr: "received 5 of 10 bytes"},
+		{name: "unexpected eof", data: io.MultiReader(strings.NewReader("abc"), iotest.ErrReader(io.ErrUnexpectedEOF)), size: 10, wantErr: "received 3 of 10 bytes"},
+		{name: "oversized", data: strings.NewReader("longer than declared"), size: 4, wantErr: "more than the declared 4 bytes"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier, err := newVerifyingReader(tt.data, tt.size, "", "")
+			if err != nil {
+				t.Fatalf("newVerifyingReader() unexpected error: %v", err)
+			}
+
+			body, err := io.ReadAll(verifier)
+			if !errors.Is(err, ErrIncompleteUpload) {
+				t.Fatalf("ReadAll() error = %v, want ErrIncompleteUpload", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want containing %q", err, tt.wantErr)
+			}
+			if int64(len(body)) >= tt.size {
+				t.Fatalf("read %d bytes, want fewer than %d", len(body), tt.size)
+			}
+		})
+	}
+}
+
+func TestRecordedSHA256(t *testing.T) {
+	sum := sha256.Sum256([]byte("hello world"))
+
+	tests := []struct {
+		name     string
+		checksum string
+		want     string
+		wantOK   bool
+	}{
+		{name: "single part", checksum: "uU0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek=", want: hex.EncodeToString(sum[:]), wantOK: true},
+		{name: "multipart", checksum: "uU0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek=-3"},
+		{name: "missing"},
+		{name: "wrong length", checksum: "AAAA"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := recordedSHA256(tt.checksum)
+			if got != tt.want || ok != tt.wantOK {
+				t.Fatalf("recordedSHA256(%q) = %q, %v, want %q, %v", tt.checksum, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}